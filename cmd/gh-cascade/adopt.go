@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+
+	"github.com/134130/gh-cascade/pkg/cascade"
+	"github.com/cli/go-gh/v2/pkg/term"
+	"github.com/fatih/color"
+)
+
+type AdoptOptions struct {
+	Yes         bool
+	DryRun      bool
+	Metadata    bool
+	Verbose     bool
+	Debug       bool
+	Authors     StringsFlag
+	AllAuthors  bool
+	Patterns    StringsFlag
+	Keywords    StringsFlag
+	FetchRemote string
+	PushRemote  string
+}
+
+func parseAdoptOptions(ctx context.Context, args []string) (*AdoptOptions, error) {
+	opts := &AdoptOptions{}
+	fs := flag.NewFlagSet("adopt", flag.ContinueOnError)
+	fs.BoolVar(&opts.Yes, "yes", false, "update the pull request bodies without asking for confirmation")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "print the inferred dependencies without updating anything")
+	fs.BoolVar(&opts.Metadata, "metadata", false, "declare dependencies in a cascade block instead of \"Depends on\" lines")
+	fs.BoolVar(&opts.Verbose, "verbose", false, "log every git and gh command with its duration")
+	fs.BoolVar(&opts.Debug, "debug", false, "like --verbose, and also log the output of every command")
+	fs.Var(&opts.Authors, "author", "only adopt pull requests of this author (repeatable, default: @me)")
+	fs.BoolVar(&opts.AllAuthors, "all-authors", false, "adopt pull requests of every author")
+	addPatternFlags(fs, &opts.Patterns, &opts.Keywords)
+	addRemoteFlags(fs, &opts.FetchRemote, &opts.PushRemote)
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+
+	if err := cascade.Preflight(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := applyDefaults(ctx, fs, "adopt"); err != nil {
+		return nil, err
+	}
+
+	if opts.AllAuthors && len(opts.Authors) > 0 {
+		return nil, errors.New("--author cannot be used with --all-authors")
+	}
+	if !opts.Yes && !opts.DryRun && !term.IsTerminal(os.Stdin) {
+		return nil, errors.New("--yes or --dry-run is required when not running in a terminal")
+	}
+
+	if err := installDependOnPatterns(opts.Patterns, opts.Keywords); err != nil {
+		return nil, err
+	}
+
+	if _, err := cascade.SetupRepository(ctx, &opts.FetchRemote, &opts.PushRemote); err != nil {
+		return nil, err
+	}
+
+	return opts, nil
+}
+
+// runAdopt infers the dependencies of pull requests stacked on each other
+// without declaring it from the ancestry of their heads, and adds them to
+// their bodies.
+func runAdopt(args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts, err := parseAdoptOptions(ctx, args)
+	if err != nil {
+		return reportOptionsError(err)
+	}
+
+	setupLogging(opts.Verbose, opts.Debug)
+
+	sp := newSpinner()
+	sp.Suffix = " Inferring dependencies..."
+	sp.Start()
+	byNumber, inferred, err := inferDependOns(ctx, opts)
+	sp.Stop()
+	if err != nil {
+		fmt.Fprintln(color.Error, red("error:"), err)
+		return exitError
+	}
+
+	if len(inferred) == 0 {
+		fmt.Fprintf(color.Output, "%s%s\n", green("✔"), " No pull requests to adopt.")
+		return exitNothingToDo
+	}
+
+	numbers := make([]int, 0, len(inferred))
+	for number := range inferred {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+
+	for _, number := range numbers {
+		pr, dependency := byNumber[number], byNumber[inferred[number]]
+		fmt.Fprintf(color.Output, "%s %s %s Depends on: #%d %s\n",
+			blue(fmt.Sprintf("#%d", pr.Number)), pr.HeadRefName, hiBlack("←"), dependency.Number, hiBlack(dependency.HeadRefName))
+	}
+
+	if opts.DryRun {
+		return exitOK
+	}
+	if !opts.Yes {
+		fmt.Fprintf(color.Output, "Add these dependencies to %d pull request bodies? [y/N] ", len(numbers))
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			return exitOK
+		}
+	}
+
+	code := exitOK
+	for _, number := range numbers {
+		pr := byNumber[number]
+		body := cascade.AddDependOn(pr.Body, inferred[number])
+		if opts.Metadata {
+			body = cascade.AddMetadataDependOn(pr.Body, inferred[number])
+		}
+		if err := cascade.UpdatePullRequestBody(ctx, number, body); err != nil {
+			fmt.Fprintln(color.Error, red("x"), fmt.Errorf("#%d: %w", number, err))
+			code = exitFailed
+			continue
+		}
+		fmt.Fprintf(color.Output, "%s Updated #%d\n", green("✔"), number)
+	}
+
+	return code
+}
+
+// inferDependOns lists the pull requests to adopt, fetches their heads and
+// infers their dependencies.
+func inferDependOns(ctx context.Context, opts *AdoptOptions) (map[int]cascade.PullRequest, map[int]int, error) {
+	defaultBranch, err := cascade.GetDefaultBranch(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("resolve default branch: %w", err)
+	}
+
+	filter := cascade.PullRequestFilter{Authors: opts.Authors}
+	if !opts.AllAuthors && len(opts.Authors) == 0 {
+		filter.Authors = []string{"@me"}
+	}
+	pullRequests, err := cascade.ListPullRequests(ctx, filter)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list pull requests: %w", err)
+	}
+
+	base := cascade.RemoteBranchRef(opts.FetchRemote, defaultBranch)
+	refspecs := []string{"+refs/heads/" + defaultBranch + ":" + base}
+	byNumber := map[int]cascade.PullRequest{}
+	for _, pr := range pullRequests {
+		byNumber[pr.Number] = pr
+		refspecs = append(refspecs, cascade.PullRequestHeadRef(pr.Number))
+	}
+	if err = cascade.FetchRefs(ctx, opts.FetchRemote, refspecs...); err != nil {
+		return nil, nil, fmt.Errorf("fetch from %s: %w", opts.FetchRemote, err)
+	}
+
+	inferred, err := cascade.InferDependOns(ctx, base, pullRequests)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return byNumber, inferred, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/134130/gh-cascade/pkg/cascade"
+	"github.com/fatih/color"
+)
+
+// printAnnotations emits a workflow error annotation for every pull request
+// that failed to rebase.
+func printAnnotations(processedPullRequests []cascade.ProcessedPullRequest) {
+	for _, pr := range processedPullRequests {
+		if pr.Result() != cascade.ResultFailed {
+			continue
+		}
+		fmt.Fprintf(color.Output, "::error title=%s::%s\n", escapeAnnotationProperty(fmt.Sprintf("#%d %s", pr.Number, pr.Title)), escapeAnnotationData(pr.Error.Error()))
+	}
+}
+
+// WriteStepSummary appends the run report to the job summary, if the job has one.
+func WriteStepSummary(processedPullRequests []cascade.ProcessedPullRequest) error {
+	path := os.Getenv("GITHUB_STEP_SUMMARY")
+	if path == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err = fmt.Fprintf(f, "### gh cascade\n\n%s\n", formatMarkdownReport(processedPullRequests)); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// escapeAnnotationData and escapeAnnotationProperty escape workflow command
+// values the way the Actions runner unescapes them.
+func escapeAnnotationData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func escapeAnnotationProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/134130/gh-cascade/pkg/cascade"
+	"github.com/fatih/color"
+)
+
+// subcommands are the subcommands of gh cascade, with what they do.
+var subcommands = []completion{
+	{"merge", "land a chain of pull requests bottom-up"},
+	{"undo", "restore branches to their tip before the last run"},
+	{"status", "report where each pull request with a dependency stands"},
+	{"create", "push a stack of branches and open a pull request for each"},
+	{"adopt", "declare the dependencies of an existing stack"},
+	{"ui", "open the interactive dashboard"},
+	{"doctor", "check the environment gh cascade runs in"},
+	{"up", "check out the pull request depending on the checked out one"},
+	{"down", "check out the pull request the checked out one depends on"},
+	{"top", "check out the last pull request of the stack"},
+	{"prune-metadata", "remove dependencies on pull requests merged or closed long ago"},
+	{"sync", "rebase, push and retarget after a merge"},
+	{"repos", "run gh cascade in each of several repositories"},
+	{"completion", "print a shell completion script"},
+	{"version", "print the version of gh cascade, git and gh"},
+}
+
+// completionScripts are the scripts of gh cascade completion, by shell.
+var completionScripts = map[string]string{
+	"bash":       bashCompletion,
+	"zsh":        zshCompletion,
+	"fish":       fishCompletion,
+	"powershell": powershellCompletion,
+}
+
+// completion is a candidate for the word being completed.
+type completion struct {
+	Value       string
+	Description string
+}
+
+func parseCompletionOptions(args []string) (string, error) {
+	fs := flag.NewFlagSet("completion", flag.ContinueOnError)
+	if err := parseFlags(fs, args); err != nil {
+		return "", err
+	}
+
+	if fs.NArg() != 1 {
+		return "", errors.New("usage: gh cascade completion bash|zsh|fish|powershell")
+	}
+	if _, ok := completionScripts[fs.Arg(0)]; !ok {
+		return "", fmt.Errorf("invalid shell %q: must be one of bash, zsh, fish, powershell", fs.Arg(0))
+	}
+
+	return fs.Arg(0), nil
+}
+
+// runCompletion prints the completion script of a shell.
+func runCompletion(args []string) int {
+	shell, err := parseCompletionOptions(args)
+	if err != nil {
+		return reportOptionsError(err)
+	}
+
+	fmt.Fprint(color.Output, completionScripts[shell])
+	return exitOK
+}
+
+// runComplete prints the candidates for the last of args, the words after
+// gh cascade on a command line being completed, one per line and each
+// followed by a tab and its description. It is what the completion scripts
+// run, as gh cascade __complete.
+func runComplete(args []string) int {
+	// Completion waits on it, so a slow lookup is better left out.
+	cascade.SetCommandTimeout(5 * time.Second)
+
+	for _, c := range complete(context.Background(), args) {
+		fmt.Fprintf(color.Output, "%s\t%s\n", c.Value, c.Description)
+	}
+	return exitOK
+}
+
+// complete returns the candidates for the last of args that start with it:
+// subcommands, flags, values of a flag, or the arguments of the subcommand.
+func complete(ctx context.Context, args []string) []completion {
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	args, split := joinEquals(args)
+	words, current := args[:len(args)-1], args[len(args)-1]
+
+	command := ""
+	if len(words) > 0 && isSubcommand(words[0]) {
+		command, words = words[0], words[1:]
+	}
+	fs := flagSetOf(command)
+	if fs == nil {
+		return nil
+	}
+
+	var candidates []completion
+	prefix := current
+	switch name, value, hasValue := strings.Cut(strings.TrimLeft(current, "-"), "="); {
+	case strings.HasPrefix(current, "-") && hasValue:
+		// bash replaces only what follows the "=".
+		flagPrefix := current[:len(current)-len(value)]
+		if split {
+			flagPrefix = ""
+		}
+		for _, c := range flagValues(ctx, name) {
+			if strings.HasPrefix(c.Value, value) {
+				candidates = append(candidates, completion{flagPrefix + c.Value, c.Description})
+			}
+		}
+		return candidates
+	case strings.HasPrefix(current, "-"):
+		fs.VisitAll(func(f *flag.Flag) {
+			candidates = append(candidates, completion{flagName(f.Name), f.Usage})
+		})
+	case len(words) > 0 && takesValue(fs, words[len(words)-1]):
+		candidates = flagValues(ctx, strings.TrimLeft(words[len(words)-1], "-"))
+	default:
+		if command == "" && len(words) == 0 {
+			candidates = append(candidates, subcommands...)
+		}
+		candidates = append(candidates, arguments(ctx, command)...)
+	}
+
+	var matching []completion
+	for _, c := range candidates {
+		if strings.HasPrefix(c.Value, prefix) {
+			matching = append(matching, c)
+		}
+	}
+	return matching
+}
+
+// joinEquals joins the "--flag", "=", "value" that bash splits --flag=value
+// into, as the other shells do not. It reports whether the word being
+// completed was joined.
+func joinEquals(args []string) ([]string, bool) {
+	var joined []string
+	split := false
+	for i := 0; i < len(args); i++ {
+		if args[i] != "=" || len(joined) == 0 || !strings.HasPrefix(joined[len(joined)-1], "-") {
+			joined = append(joined, args[i])
+			split = false
+			continue
+		}
+
+		joined[len(joined)-1] += "="
+		if i+1 < len(args) {
+			i++
+			joined[len(joined)-1] += args[i]
+		}
+		split = true
+	}
+	return joined, split
+}
+
+func isSubcommand(word string) bool {
+	for _, c := range subcommands {
+		if c.Value == word {
+			return true
+		}
+	}
+	return false
+}
+
+// flagName returns how the flag named name is written on the command line.
+func flagName(name string) string {
+	if len(name) == 1 {
+		return "-" + name
+	}
+	return "--" + name
+}
+
+// takesValue reports whether word is a flag of fs whose value is the next
+// word.
+func takesValue(fs *flag.FlagSet, word string) bool {
+	if !strings.HasPrefix(word, "-") || strings.Contains(word, "=") {
+		return false
+	}
+	f := fs.Lookup(strings.TrimLeft(word, "-"))
+	if f == nil {
+		return false
+	}
+	boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return !ok || !boolFlag.IsBoolFlag()
+}
+
+// completing makes parseFlags return the flag set it is given in a
+// *completingError instead of parsing, so that flagSetOf gets the flags of a
+// subcommand from the parser that defines them, before it looks at anything
+// else.
+var completing bool
+
+type completingError struct {
+	fs *flag.FlagSet
+}
+
+func (e *completingError) Error() string {
+	return "completing the flags of " + e.fs.Name()
+}
+
+// flagSetOf returns the flags of command, "" for gh cascade itself, or nil if
+// there is no such subcommand.
+func flagSetOf(command string) *flag.FlagSet {
+	completing = true
+	defer func() { completing = false }()
+
+	ctx := context.Background()
+	var err error
+	switch command {
+	case "", "ui":
+		_, err = parseOptions(ctx, nil)
+	case "sync":
+		_, err = parseRunOptions(ctx, "sync", nil)
+	case "merge":
+		_, err = parseMergeOptions(ctx, nil)
+	case "undo":
+		_, err = parseUndoOptions(ctx, nil)
+	case "status":
+		_, err = parseStatusOptions(ctx, nil)
+	case "create":
+		_, err = parseCreateOptions(ctx, nil)
+	case "adopt":
+		_, err = parseAdoptOptions(ctx, nil)
+	case "doctor":
+		_, err = parseDoctorOptions(nil)
+	case "up", "down", "top":
+		_, err = parseNavigateOptions(ctx, command, nil)
+	case "prune-metadata":
+		_, err = parsePruneMetadataOptions(ctx, nil)
+	case "repos":
+		_, err = parseReposOptions(ctx, nil)
+	case "completion":
+		_, err = parseCompletionOptions(nil)
+	case "version":
+		err = parseVersionOptions(nil)
+	}
+
+	var completingErr *completingError
+	if errors.As(err, &completingErr) {
+		return completingErr.fs
+	}
+	return nil
+}
+
+// flagValues returns the candidates for the value of the flag named name.
+func flagValues(ctx context.Context, name string) []completion {
+	switch name {
+	case "chain", "report-issue", "assume-merged", "onto-map":
+		return pullRequestNumbers(ctx)
+	case "onto":
+		return branchNames(ctx)
+	case "remote", "fetch-remote", "push-remote":
+		remotes, _ := cascade.ListRemotes(ctx)
+		var candidates []completion
+		for _, remote := range remotes {
+			candidates = append(candidates, completion{remote.Name, remote.URL})
+		}
+		return candidates
+	case "on-conflict":
+		return []completion{{cascade.OnConflictRebase, "rebase, and abort on conflict"}, {cascade.OnConflictSkip, "skip them"}, {cascade.OnConflictStop, "stop before rebasing anything"}}
+	case "strategy":
+		return []completion{{cascade.StrategyRebase, "git rebase --onto"}, {cascade.StrategyCherryPick, "cherry-pick their own commits onto a fresh branch"}, {cascade.StrategyMergeTree, "replay their own commits without a working tree"}}
+	case "method", "auto-merge":
+		return []completion{{"merge", ""}, {"squash", ""}, {"rebase", ""}}
+	case "output":
+		return []completion{{"text", ""}, {"markdown", "a table to paste into a tracking issue"}, {"json", ""}}
+	case "notify-format":
+		return []completion{{"slack", "a Slack-compatible message"}, {"json", ""}}
+	case "theme":
+		return []completion{{themeDefault, ""}, {themeColorblind, "does not rely on telling red from green"}, {themeSymbols, "also spells out states"}}
+	}
+	return nil
+}
+
+// arguments returns the candidates for the arguments of command.
+func arguments(ctx context.Context, command string) []completion {
+	switch command {
+	case "", "sync", "ui":
+		return pullRequestNumbers(ctx)
+	case "undo":
+		backups, _ := cascade.ListBackups(ctx)
+		var candidates []completion
+		for _, backup := range backups {
+			if number, ok := cascade.ParsePullRequestBranch(backup.Branch); ok {
+				candidates = append(candidates, completion{strconv.Itoa(number), "backed up at " + backup.Oid[:min(7, len(backup.Oid))]})
+			}
+		}
+		return candidates
+	case "create":
+		return branchNames(ctx)
+	case "completion":
+		shells := make([]completion, 0, len(completionScripts))
+		for shell := range completionScripts {
+			shells = append(shells, completion{shell, ""})
+		}
+		sort.Slice(shells, func(i, j int) bool { return shells[i].Value < shells[j].Value })
+		return shells
+	}
+	return nil
+}
+
+// pullRequestCompletionLimit caps the open pull requests offered, newest
+// first.
+const pullRequestCompletionLimit = 100
+
+func pullRequestNumbers(ctx context.Context) []completion {
+	pullRequests, _ := cascade.ListPullRequests(ctx, cascade.PullRequestFilter{Limit: pullRequestCompletionLimit})
+	candidates := make([]completion, 0, len(pullRequests))
+	for _, pr := range pullRequests {
+		candidates = append(candidates, completion{strconv.Itoa(pr.Number), pr.Title})
+	}
+	return candidates
+}
+
+func branchNames(ctx context.Context) []completion {
+	branches, _ := cascade.ListBranches(ctx)
+	candidates := make([]completion, 0, len(branches))
+	for _, branch := range branches {
+		candidates = append(candidates, completion{branch, ""})
+	}
+	return candidates
+}
+
+const bashCompletion = `# bash completion for gh cascade. Load it after that of gh, e.g. in ~/.bashrc:
+#   eval "$(gh completion -s bash)"
+#   eval "$(gh cascade completion bash)"
+if [[ $(complete -p gh 2>/dev/null) != *__gh_cascade_complete* ]]; then
+	__gh_cascade_complete_gh=$(complete -p gh 2>/dev/null | sed -n 's/.*-F \([^ ]*\).*/\1/p')
+fi
+
+__gh_cascade_complete() {
+	if [[ $COMP_CWORD -lt 2 || ${COMP_WORDS[1]} != cascade ]]; then
+		[[ -n $__gh_cascade_complete_gh ]] && "$__gh_cascade_complete_gh" "$@"
+		return
+	fi
+
+	local IFS=$'\n' line
+	COMPREPLY=()
+	for line in $(gh cascade __complete "${COMP_WORDS[@]:2:COMP_CWORD-1}" 2>/dev/null); do
+		COMPREPLY+=("${line%%$'\t'*}")
+	done
+}
+
+complete -o default -F __gh_cascade_complete gh
+`
+
+const zshCompletion = `# zsh completion for gh cascade. Load it after compinit, e.g. in ~/.zshrc:
+#   eval "$(gh cascade completion zsh)"
+__gh_cascade_complete() {
+	if (( CURRENT < 3 )) || [[ ${words[2]} != cascade ]]; then
+		(( $+functions[_gh] )) && _gh "$@"
+		return
+	fi
+
+	local -a candidates
+	local line
+	for line in "${(@f)$(gh cascade __complete "${(@)words[3,CURRENT]}" 2>/dev/null)}"; do
+		[[ -n $line ]] && candidates+=("${${line%%$'\t'*}//:/\\:}:${line#*$'\t'}")
+	done
+	_describe -t values 'gh cascade' candidates || _files
+}
+
+compdef __gh_cascade_complete gh
+`
+
+const fishCompletion = `# fish completion for gh cascade, e.g. in ~/.config/fish/config.fish:
+#   gh cascade completion fish | source
+complete -c gh -n '__fish_seen_subcommand_from cascade' -f -a '(gh cascade __complete (commandline -opc)[3..] (commandline -ct) 2>/dev/null)'
+`
+
+const powershellCompletion = `# PowerShell completion for gh cascade, e.g. in $PROFILE:
+#   gh cascade completion powershell | Out-String | Invoke-Expression
+# It takes over the completion of gh, and falls back to that of gh itself for
+# its other commands.
+Register-ArgumentCompleter -Native -CommandName gh -ScriptBlock {
+	param($wordToComplete, $commandAst, $cursorPosition)
+
+	$words = @($commandAst.CommandElements | Select-Object -Skip 1 | ForEach-Object { $_.ToString() })
+	if ($wordToComplete -eq '') {
+		$words += ''
+	}
+
+	if ($words.Count -gt 1 -and $words[0] -eq 'cascade') {
+		$lines = gh cascade __complete @($words | Select-Object -Skip 1) 2>$null
+	} else {
+		$lines = gh __complete @words 2>$null | Where-Object { $_ -notlike ':*' }
+	}
+
+	foreach ($line in $lines) {
+		$candidate, $description = $line -split "` + "`" + `t", 2
+		if (-not $description) {
+			$description = $candidate
+		}
+		[System.Management.Automation.CompletionResult]::new($candidate, $candidate, 'ParameterValue', $description)
+	}
+}
+`
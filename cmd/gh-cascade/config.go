@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/134130/gh-cascade/pkg/cascade"
+	"github.com/cli/go-gh/v2/pkg/repository"
+	"gopkg.in/yaml.v3"
+)
+
+// repoConfigFile is looked up at the root of the repository being cascaded.
+const repoConfigFile = ".cascade.yml"
+
+// Config holds the settings of the configuration files. Keys are flag names
+// and values are what would be passed on the command line; lists set
+// repeatable flags. Subcommands read their flags from a section named after
+// them, on top of the top-level settings they share with the main command.
+type Config map[string]any
+
+// configAliases maps plural keys, which read more naturally for lists, to the
+// repeatable flag they set.
+var configAliases = map[string]string{
+	"patterns": "pattern",
+	"keywords": "keyword",
+	"hooks":    "hook",
+}
+
+// configSections are the subcommands that have their own section.
+var configSections = map[string]bool{
+	"adopt":  true,
+	"create": true,
+	"status": true,
+	"merge":  true,
+	"undo":   true,
+	// up, down and top share theirs.
+	"navigate":       true,
+	"sync":           true,
+	"prune-metadata": true,
+	"repos":          true,
+}
+
+// LoadConfig reads the user configuration and the repository configuration.
+// Settings of the repository configuration replace those of the user one.
+// Outside of a repository, as gh cascade repos may run, there is only the
+// user configuration.
+func LoadConfig(ctx context.Context) (Config, error) {
+	config := Config{}
+
+	if path, err := userConfigPath(); err == nil {
+		if err = mergeConfigFile(config, path); err != nil {
+			return nil, err
+		}
+	}
+
+	root, err := cascade.RepositoryRoot(ctx)
+	if err != nil {
+		return config, nil
+	}
+	if err = mergeConfigFile(config, filepath.Join(root, repoConfigFile)); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// userConfigPath returns ~/.config/gh-cascade/config.yml, honoring
+// XDG_CONFIG_HOME, or %AppData%\gh-cascade\config.yml on Windows, as gh does
+// for its own.
+func userConfigPath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" && runtime.GOOS == "windows" {
+		var err error
+		if dir, err = os.UserConfigDir(); err != nil {
+			return "", err
+		}
+	} else if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "gh-cascade", "config.yml"), nil
+}
+
+// newCache returns the cache of repo in cacheDir.
+func newCache(repo repository.Repository, ttl time.Duration) (*cascade.Cache, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return nil, err
+	}
+	return &cascade.Cache{
+		Dir: filepath.Join(dir, strings.ToLower(repo.Host), strings.ToLower(repo.Owner), strings.ToLower(repo.Name)),
+		TTL: ttl,
+	}, nil
+}
+
+// cacheDir returns ~/.cache/gh-cascade, honoring XDG_CACHE_HOME, or
+// %LocalAppData%\gh-cascade on Windows.
+func cacheDir() (string, error) {
+	dir := os.Getenv("XDG_CACHE_HOME")
+	if dir == "" && runtime.GOOS == "windows" {
+		var err error
+		if dir, err = os.UserCacheDir(); err != nil {
+			return "", err
+		}
+	} else if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".cache")
+	}
+	return filepath.Join(dir, "gh-cascade"), nil
+}
+
+func mergeConfigFile(config Config, path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var file map[string]any
+	if err = yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	for key, value := range file {
+		if section, ok := value.(map[string]any); ok && configSections[key] {
+			merged, _ := config[key].(map[string]any)
+			if merged == nil {
+				merged = map[string]any{}
+			}
+			for k, v := range section {
+				merged[k] = v
+			}
+			config[key] = merged
+			continue
+		}
+		config[key] = value
+	}
+
+	return nil
+}
+
+// commandLineOnlyFlags are the flags that take effect before the configuration
+// is loaded, so that it is recorded too, and may not be set in it or in the
+// environment.
+var commandLineOnlyFlags = []string{"record", "replay"}
+
+// applyDefaults sets every flag of fs that was not given on the command line
+// from the environment or, failing that, the configuration files. section
+// names the subcommand fs belongs to, or is empty for the main command.
+func applyDefaults(ctx context.Context, fs *flag.FlagSet, section string) error {
+	config, err := LoadConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+
+	values := map[string]any{}
+	for key, value := range config {
+		if !configSections[key] {
+			values[configFlagName(key)] = value
+		}
+	}
+	inSection := map[string]bool{}
+	sectionValues, _ := config[section].(map[string]any)
+	for key, value := range sectionValues {
+		values[configFlagName(key)] = value
+		inSection[configFlagName(key)] = true
+	}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if value, ok := lookupEnv(section, f.Name); ok {
+			values[f.Name] = envValue(f, value)
+		}
+	})
+
+	for _, name := range commandLineOnlyFlags {
+		if _, ok := values[name]; ok && fs.Lookup(name) != nil {
+			return fmt.Errorf("load config: %q can only be given on the command line", name)
+		}
+	}
+
+	return applyFlagValues(fs, values, func(name string) error {
+		// Top-level settings may belong to the main command only.
+		if section != "" && !inSection[name] {
+			return nil
+		}
+		return fmt.Errorf("load config: unknown option %q", name)
+	})
+}
+
+// applyFlagValues sets the flags of fs named by values, skipping those given
+// on the command line. unknown is called for names that are not flags of fs.
+func applyFlagValues(fs *flag.FlagSet, values map[string]any, unknown func(name string) error) error {
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if fs.Lookup(name) == nil {
+			if err := unknown(name); err != nil {
+				return err
+			}
+			continue
+		}
+		if given[name] {
+			continue
+		}
+
+		value := values[name]
+		// YAML decodes mappings with keys that are not all strings, such as
+		// pull request numbers, differently.
+		if mapping, ok := value.(map[any]any); ok {
+			converted := make(map[string]any, len(mapping))
+			for key, v := range mapping {
+				converted[fmt.Sprint(key)] = v
+			}
+			value = converted
+		}
+
+		var items []any
+		switch value := value.(type) {
+		case nil:
+			continue
+		case []any:
+			items = value
+		case map[string]any:
+			// Hooks read best as a mapping of events to commands, and the
+			// branches and commits to rebase onto as one of pull requests to
+			// them.
+			switch fs.Lookup(name).Value.(type) {
+			case *HooksFlag, *OntoFlag, *OntoMapFlag:
+			default:
+				return fmt.Errorf("load config: option %q must not be a mapping", name)
+			}
+			keys := make([]string, 0, len(value))
+			for key := range value {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				items = append(items, key+"="+fmt.Sprint(value[key]))
+			}
+		default:
+			items = []any{value}
+		}
+
+		for _, item := range items {
+			if err := fs.Set(name, fmt.Sprint(item)); err != nil {
+				return fmt.Errorf("load config: option %q: %w", name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// lookupEnv returns the value of CASCADE_<FLAG>, e.g. CASCADE_DRY_RUN for
+// --dry-run. Flags of subcommands may also be set as CASCADE_<SUBCOMMAND>_<FLAG>,
+// which takes precedence.
+func lookupEnv(section, name string) (string, bool) {
+	key := strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+	if section != "" {
+		prefix := strings.ToUpper(strings.ReplaceAll(section, "-", "_"))
+		if value, ok := os.LookupEnv("CASCADE_" + prefix + "_" + key); ok {
+			return value, true
+		}
+	}
+	return os.LookupEnv("CASCADE_" + key)
+}
+
+// envValue splits the value of a repeatable flag on commas, since environment
+// variables can't hold lists.
+func envValue(f *flag.Flag, value string) any {
+	switch f.Value.(type) {
+	case *StringsFlag, *AssumeMergedFlag, *OntoMapFlag:
+	default:
+		return value
+	}
+
+	var items []any
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func configFlagName(key string) string {
+	if name, ok := configAliases[key]; ok {
+		return name
+	}
+	return key
+}
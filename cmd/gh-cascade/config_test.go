@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useConfig runs the test in a repository whose .cascade.yml is repoConfig,
+// with the user configuration userConfig and no CASCADE_* variables set.
+// Empty configurations are not written.
+func useConfig(t *testing.T, userConfig, repoConfig string) {
+	t.Helper()
+	newTestRepository(t)
+
+	for _, env := range os.Environ() {
+		if name, _, _ := strings.Cut(env, "="); strings.HasPrefix(name, "CASCADE_") {
+			t.Setenv(name, "")
+			os.Unsetenv(name)
+		}
+	}
+
+	configHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+	if userConfig != "" {
+		if err := os.MkdirAll(filepath.Join(configHome, "gh-cascade"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, filepath.Join(configHome, "gh-cascade", "config.yml"), userConfig)
+	}
+	if repoConfig != "" {
+		writeFile(t, repoConfigFile, repoConfig)
+	}
+}
+
+func TestApplyDefaultsRecordAndReplay(t *testing.T) {
+	tests := []struct {
+		name       string
+		repoConfig string
+		env        map[string]string
+		args       []string
+		wantErr    string
+	}{
+		{
+			name: "command line",
+			args: []string{"--record", "dir"},
+		},
+		{
+			name:       "config",
+			repoConfig: "record: dir\n",
+			wantErr:    `load config: "record" can only be given on the command line`,
+		},
+		{
+			name:    "environment",
+			env:     map[string]string{"CASCADE_REPLAY": "dir"},
+			wantErr: `load config: "replay" can only be given on the command line`,
+		},
+		{
+			name:    "environment of a subcommand",
+			env:     map[string]string{"CASCADE_SYNC_RECORD": "dir"},
+			wantErr: `load config: "record" can only be given on the command line`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useConfig(t, "", tt.repoConfig)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+			fs.String("record", "", "")
+			fs.String("replay", "", "")
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			err := applyDefaults(context.Background(), fs, "sync")
+			if errorText(err) != tt.wantErr {
+				t.Errorf("applyDefaults() error = %q, want %q", errorText(err), tt.wantErr)
+			}
+		})
+	}
+}
+
+// errorText returns the message of err, or "" if it is nil.
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func TestApplyDefaults(t *testing.T) {
+	tests := []struct {
+		name       string
+		section    string
+		userConfig string
+		repoConfig string
+		env        map[string]string
+		args       []string
+		want       map[string]string
+		wantErr    string
+	}{
+		{
+			name:       "user config",
+			userConfig: "onto: user\n",
+			want:       map[string]string{"onto": "user"},
+		},
+		{
+			name:       "repo config over user config",
+			userConfig: "onto: user\npush: true\n",
+			repoConfig: "onto: repo\n",
+			want:       map[string]string{"onto": "repo", "push": "true"},
+		},
+		{
+			name:       "environment over repo config",
+			repoConfig: "onto: repo\npush: true\n",
+			env:        map[string]string{"CASCADE_ONTO": "env", "CASCADE_PUSH": "false"},
+			want:       map[string]string{"onto": "env", "push": "false"},
+		},
+		{
+			name:       "flags over environment",
+			repoConfig: "onto: repo\n",
+			env:        map[string]string{"CASCADE_ONTO": "env"},
+			args:       []string{"--onto", "flag"},
+			want:       map[string]string{"onto": "flag"},
+		},
+		{
+			name:       "flags over config",
+			repoConfig: "onto: repo\n",
+			args:       []string{"--onto", "flag"},
+			want:       map[string]string{"onto": "flag"},
+		},
+		{
+			name:       "repeatable flags",
+			repoConfig: "keywords:\n  - Blocked by\n  - Requires\n",
+			want:       map[string]string{"keyword": "Blocked by,Requires"},
+		},
+		{
+			name: "repeatable flags from the environment",
+			env:  map[string]string{"CASCADE_KEYWORD": "Blocked by, Requires"},
+			want: map[string]string{"keyword": "Blocked by,Requires"},
+		},
+		{
+			name:       "section over top level",
+			section:    "sync",
+			userConfig: "sync:\n  push: true\n",
+			repoConfig: "onto: top\nsync:\n  onto: section\n",
+			want:       map[string]string{"onto": "section", "push": "true"},
+		},
+		{
+			name:       "sections of other subcommands",
+			section:    "sync",
+			repoConfig: "merge:\n  onto: merge\n",
+			want:       map[string]string{"onto": ""},
+		},
+		{
+			name:    "subcommand environment over environment",
+			section: "sync",
+			env:     map[string]string{"CASCADE_ONTO": "env", "CASCADE_SYNC_ONTO": "sync"},
+			want:    map[string]string{"onto": "sync"},
+		},
+		{
+			name:       "unknown option",
+			repoConfig: "nope: true\n",
+			wantErr:    `load config: unknown option "nope"`,
+		},
+		{
+			name:       "top-level option of the main command under a subcommand",
+			section:    "sync",
+			repoConfig: "nope: true\nonto: top\n",
+			want:       map[string]string{"onto": "top"},
+		},
+		{
+			name:       "unknown option in a section",
+			section:    "sync",
+			repoConfig: "sync:\n  nope: true\n",
+			wantErr:    `load config: unknown option "nope"`,
+		},
+		{
+			name:       "mapping for a plain option",
+			repoConfig: "onto:\n  a: b\n",
+			wantErr:    `load config: option "onto" must not be a mapping`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useConfig(t, tt.userConfig, tt.repoConfig)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			var keywords StringsFlag
+			fs := flag.NewFlagSet(tt.section, flag.ContinueOnError)
+			fs.String("onto", "", "")
+			fs.Bool("push", false, "")
+			fs.Var(&keywords, "keyword", "")
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			err := applyDefaults(context.Background(), fs, tt.section)
+			if errorText(err) != tt.wantErr {
+				t.Fatalf("applyDefaults() error = %q, want %q", errorText(err), tt.wantErr)
+			}
+			for name, want := range tt.want {
+				if got := fs.Lookup(name).Value.String(); got != want {
+					t.Errorf("--%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLookupEnv(t *testing.T) {
+	t.Setenv("CASCADE_DRY_RUN", "1")
+	t.Setenv("CASCADE_PRUNE_METADATA_DRY_RUN", "0")
+
+	tests := []struct {
+		section string
+		want    string
+	}{
+		{"", "1"},
+		{"merge", "1"},
+		{"prune-metadata", "0"},
+	}
+	for _, tt := range tests {
+		if got, ok := lookupEnv(tt.section, "dry-run"); !ok || got != tt.want {
+			t.Errorf("lookupEnv(%q, dry-run) = %q, %t, want %q", tt.section, got, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/134130/gh-cascade/pkg/cascade"
+	"github.com/cli/go-gh/v2/pkg/repository"
+	"github.com/fatih/color"
+)
+
+type CreateOptions struct {
+	Draft       bool
+	DryRun      bool
+	Metadata    bool
+	Verbose     bool
+	Debug       bool
+	FetchRemote string
+	PushRemote  string
+	// Branches are the stack to open pull requests for, bottom first. The
+	// stack of the checked out branch is inferred if it is empty.
+	Branches []string
+	// Repository is the base repository, resolved after parsing.
+	Repository repository.Repository
+}
+
+func parseCreateOptions(ctx context.Context, args []string) (*CreateOptions, error) {
+	opts := &CreateOptions{}
+	fs := flag.NewFlagSet("create", flag.ContinueOnError)
+	fs.BoolVar(&opts.Draft, "draft", false, "open the pull requests as drafts")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "print the pull requests that would be opened without pushing or opening anything")
+	fs.BoolVar(&opts.Metadata, "metadata", false, "declare dependencies in a cascade block instead of \"Depends on\" lines")
+	fs.BoolVar(&opts.Verbose, "verbose", false, "log every git and gh command with its duration")
+	fs.BoolVar(&opts.Debug, "debug", false, "like --verbose, and also log the output of every command")
+	addRemoteFlags(fs, &opts.FetchRemote, &opts.PushRemote)
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+
+	if err := cascade.Preflight(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := applyDefaults(ctx, fs, "create"); err != nil {
+		return nil, err
+	}
+
+	opts.Branches = fs.Args()
+
+	var err error
+	if opts.Repository, err = cascade.SetupRepository(ctx, &opts.FetchRemote, &opts.PushRemote); err != nil {
+		return nil, err
+	}
+
+	return opts, nil
+}
+
+// runCreate opens a pull request for each branch of a local stack that has
+// none yet, based on the branch below it and depending on its pull request.
+func runCreate(args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts, err := parseCreateOptions(ctx, args)
+	if err != nil {
+		return reportOptionsError(err)
+	}
+
+	setupLogging(opts.Verbose, opts.Debug)
+
+	defaultBranch, branches, existing, err := resolveStack(ctx, opts)
+	if err != nil {
+		fmt.Fprintln(color.Error, red("error:"), err)
+		return exitError
+	}
+
+	// Pull requests from a fork can only be based on branches of the base
+	// repository, so there the stack is held together by the Depends on
+	// lines alone.
+	headPrefix, err := forkHeadPrefix(ctx, opts)
+	if err != nil {
+		fmt.Fprintln(color.Error, red("error:"), err)
+		return exitError
+	}
+
+	code := exitNothingToDo
+	var parent *cascade.PullRequest
+	for i, branch := range branches {
+		if pr, ok := existing[branch]; ok {
+			fmt.Fprintf(color.Output, "%s %s %s\n", hiBlack("-"), branch, hiBlack(fmt.Sprintf("already has #%d", pr.Number)))
+			parent = &pr
+			continue
+		}
+
+		base := defaultBranch
+		if i > 0 && headPrefix == "" {
+			base = branches[i-1]
+		}
+
+		if opts.DryRun {
+			dependency := ""
+			if i > 0 {
+				dependency = hiBlack(" depending on the pull request of " + branches[i-1])
+			}
+			fmt.Fprintf(color.Output, "%s %s onto %s%s\n", blue("+"), branch, base, dependency)
+			code = exitOK
+			continue
+		}
+
+		pr, err := createPullRequest(ctx, opts, headPrefix+branch, branch, base, parent)
+		if err != nil {
+			// The rest of the stack would have nothing to depend on.
+			fmt.Fprintln(color.Error, red("x"), fmt.Errorf("%s: %w", branch, err))
+			return exitFailed
+		}
+		fmt.Fprintf(color.Output, "%s Opened #%d for %s %s\n", green("✔"), pr.Number, branch, hiBlack(pr.URL))
+		parent = pr
+		code = exitOK
+	}
+
+	if code == exitNothingToDo {
+		fmt.Fprintf(color.Output, "%s%s\n", green("✔"), " Every branch already has a pull request.")
+	}
+
+	return code
+}
+
+// resolveStack returns the default branch, the branches of the stack bottom
+// first, and the open pull requests of those that have one.
+func resolveStack(ctx context.Context, opts *CreateOptions) (string, []string, map[string]cascade.PullRequest, error) {
+	defaultBranch, err := cascade.GetDefaultBranch(ctx)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("resolve default branch: %w", err)
+	}
+
+	branches := opts.Branches
+	if len(branches) == 0 {
+		base := cascade.RemoteBranchRef(opts.FetchRemote, defaultBranch)
+		if err = cascade.FetchRefs(ctx, opts.FetchRemote, "+refs/heads/"+defaultBranch+":"+base); err != nil {
+			return "", nil, nil, fmt.Errorf("fetch from %s: %w", opts.FetchRemote, err)
+		}
+
+		current, err := cascade.GetCurrentRef(ctx)
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("resolve current branch: %w", err)
+		}
+		if current == defaultBranch {
+			return "", nil, nil, fmt.Errorf("%s is the default branch; check out the top of the stack or give its branches", current)
+		}
+		if branches, err = cascade.InferBranchStack(ctx, current, base); err != nil {
+			return "", nil, nil, fmt.Errorf("infer stack: %w", err)
+		}
+	}
+
+	pullRequests, err := cascade.ListPullRequests(ctx, cascade.PullRequestFilter{})
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("list pull requests: %w", err)
+	}
+	existing := map[string]cascade.PullRequest{}
+	for _, pr := range pullRequests {
+		existing[pr.HeadRefName] = pr
+	}
+
+	return defaultBranch, branches, existing, nil
+}
+
+// forkHeadPrefix returns the "<owner>:" prefix of the heads of pull requests
+// pushed to opts.PushRemote, which is empty unless it is a fork.
+func forkHeadPrefix(ctx context.Context, opts *CreateOptions) (string, error) {
+	remotes, err := cascade.ListRemotes(ctx)
+	if err != nil {
+		return "", fmt.Errorf("list remotes: %w", err)
+	}
+
+	for _, remote := range remotes {
+		if remote.Name == opts.PushRemote && !strings.EqualFold(remote.Repository.Owner, opts.Repository.Owner) {
+			return remote.Repository.Owner + ":", nil
+		}
+	}
+
+	return "", nil
+}
+
+// createPullRequest pushes branch and opens a pull request for it, titled
+// and described after its newest commit and depending on parent, if any.
+func createPullRequest(ctx context.Context, opts *CreateOptions, head, branch, base string, parent *cascade.PullRequest) (*cascade.PullRequest, error) {
+	title, body, err := cascade.GetCommitMessage(ctx, "refs/heads/"+branch)
+	if err != nil {
+		return nil, fmt.Errorf("read commit message: %w", err)
+	}
+	if parent != nil {
+		if opts.Metadata {
+			body = cascade.AddMetadataDependOn(body, parent.Number)
+		} else {
+			body = cascade.AddDependOn(body, parent.Number)
+		}
+	}
+
+	if err = cascade.PushNewBranch(ctx, opts.PushRemote, branch); err != nil {
+		return nil, fmt.Errorf("push: %w", err)
+	}
+
+	pr, err := cascade.CreatePullRequest(ctx, cascade.NewPullRequest{
+		Head:  head,
+		Base:  base,
+		Title: title,
+		Body:  body,
+		Draft: opts.Draft,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create pull request: %w", err)
+	}
+
+	return pr, nil
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/134130/gh-cascade/pkg/cascade"
+	"github.com/fatih/color"
+)
+
+type DoctorOptions struct {
+	Verbose bool
+	Debug   bool
+}
+
+// doctorCheck is a check of gh cascade doctor.
+type doctorCheck struct {
+	// Essential checks stop the checks after them when they fail, as those
+	// would fail for the same reason.
+	Essential bool
+	Run       func(ctx context.Context) doctorResult
+}
+
+// doctorResult is the outcome of a doctorCheck. Err and Warning may be a
+// *cascade.CheckError to tell how to fix them.
+type doctorResult struct {
+	Detail  string
+	Warning error
+	Err     error
+}
+
+func parseDoctorOptions(args []string) (*DoctorOptions, error) {
+	opts := &DoctorOptions{}
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	fs.BoolVar(&opts.Verbose, "verbose", false, "log every git and gh command with its duration")
+	fs.BoolVar(&opts.Debug, "debug", false, "like --verbose, and also log the output of every command")
+	// The configuration is checked rather than applied, as it may be what
+	// is broken.
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+
+	return opts, nil
+}
+
+// runDoctor checks the environment gh cascade runs in, and prints how to fix
+// each problem found.
+func runDoctor(args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts, err := parseDoctorOptions(args)
+	if err != nil {
+		return reportOptionsError(err)
+	}
+
+	setupLogging(opts.Verbose, opts.Debug)
+
+	code := exitOK
+	for _, check := range doctorChecks() {
+		result := check.Run(ctx)
+		switch {
+		case result.Err != nil:
+			fmt.Fprintln(color.Output, red("x"), result.Err)
+			printFix(color.Output, result.Err)
+			code = exitFailed
+		case result.Warning != nil:
+			fmt.Fprintln(color.Output, hiYellow("!"), result.Detail, hiYellow(result.Warning))
+			printFix(color.Output, result.Warning)
+		default:
+			fmt.Fprintln(color.Output, green("✔"), result.Detail)
+		}
+
+		if result.Err != nil && check.Essential {
+			fmt.Fprintln(color.Output, hiBlack("Fix the problem above and run gh cascade doctor again to check the rest."))
+			break
+		}
+	}
+
+	return code
+}
+
+// printFix prints how to fix err to w, if it tells.
+func printFix(w io.Writer, err error) {
+	var checkErr *cascade.CheckError
+	if errors.As(err, &checkErr) && checkErr.Fix != "" {
+		fmt.Fprintf(w, "  %s %s\n", hiBlack("→"), checkErr.Fix)
+	}
+}
+
+// doctorChecks returns the checks of gh cascade doctor, in order. Later checks
+// use what earlier ones resolved.
+func doctorChecks() []doctorCheck {
+	var host string
+	var opts *Options
+
+	return []doctorCheck{
+		{Essential: true, Run: func(ctx context.Context) doctorResult {
+			version, warning, err := cascade.CheckGit(ctx)
+			result := doctorResult{Detail: "git " + version, Err: err}
+			if warning != "" {
+				result.Warning = &cascade.CheckError{Err: errors.New(warning), Fix: "upgrade git: https://git-scm.com/downloads"}
+			}
+			return result
+		}},
+		{Essential: true, Run: func(ctx context.Context) doctorResult {
+			// Without gh, the API is talked to directly, if there is a token
+			// for it, which the login check checks.
+			if !cascade.GhInstalled() {
+				return doctorResult{Detail: "gh", Warning: &cascade.CheckError{
+					Err: errors.New("is not installed, so GitHub is talked to directly with GH_TOKEN or GITHUB_TOKEN"),
+					Fix: "install the GitHub CLI to use its login and gh repo set-default: https://cli.github.com",
+				}}
+			}
+			version, err := cascade.CheckGh(ctx)
+			return doctorResult{Detail: "gh " + version, Err: err}
+		}},
+		{Essential: true, Run: func(ctx context.Context) doctorResult {
+			root, err := cascade.CheckWorkTree(ctx)
+			return doctorResult{Detail: "Git repository at " + root, Err: err}
+		}},
+		{Essential: true, Run: func(ctx context.Context) doctorResult {
+			var err error
+			host, err = cascade.CheckRemoteHost(ctx)
+			return doctorResult{Detail: "Remote on " + host, Err: err}
+		}},
+		{Essential: true, Run: func(ctx context.Context) doctorResult {
+			err := cascade.CheckAuth(ctx, host)
+			if err == nil {
+				err = cascade.SetupForge(ctx)
+			}
+			return doctorResult{Detail: "Logged in to " + host, Err: err}
+		}},
+		{Essential: true, Run: func(ctx context.Context) doctorResult {
+			repo, err := cascade.SetupBaseRepository(ctx)
+			return doctorResult{Detail: fmt.Sprintf("Repository %s/%s", repo.Owner, repo.Name), Err: err}
+		}},
+		{Essential: true, Run: func(ctx context.Context) doctorResult {
+			var err error
+			if opts, err = parseOptions(ctx, nil); err != nil {
+				var checkErr *cascade.CheckError
+				if errors.As(err, &checkErr) {
+					return doctorResult{Err: err}
+				}
+				return doctorResult{Err: &cascade.CheckError{Err: err, Fix: configFix(ctx)}}
+			}
+			return doctorResult{Detail: fmt.Sprintf("Configuration, fetching from %s and pushing to %s", opts.FetchRemote, opts.PushRemote)}
+		}},
+		{Run: func(ctx context.Context) doctorResult {
+			return doctorResult{Detail: "Push access to " + opts.PushRemote, Err: cascade.CheckPushAccess(ctx, opts.PushRemote)}
+		}},
+		{Run: func(ctx context.Context) doctorResult {
+			enabled, err := cascade.IsRerereEnabled(ctx)
+			result := doctorResult{Detail: "git rerere", Err: err}
+			if err == nil && !enabled {
+				result.Warning = &cascade.CheckError{
+					Err: errors.New("does not record resolutions, so --rerere has none to replay"),
+					Fix: "git config rerere.enabled true",
+				}
+			}
+			return result
+		}},
+		{Run: func(ctx context.Context) doctorResult {
+			format, err := cascade.CheckSigning(ctx, false)
+			if format == "" && err == nil {
+				return doctorResult{Detail: "Commit signing is off"}
+			}
+			return doctorResult{Detail: "Commit signing with " + format, Err: err}
+		}},
+		{Run: func(ctx context.Context) doctorResult {
+			return doctorResult{Detail: "git worktree", Err: cascade.CheckWorktrees(ctx)}
+		}},
+		{Run: func(ctx context.Context) doctorResult {
+			shallow, err := cascade.IsShallowRepository(ctx)
+			if err != nil {
+				return doctorResult{Err: err}
+			}
+			filter, err := cascade.PartialCloneFilter(ctx, opts.FetchRemote)
+			if err != nil {
+				return doctorResult{Err: err}
+			}
+			sparse, err := cascade.IsSparseCheckout(ctx)
+			detail := "Full history"
+			if shallow {
+				detail = "Shallow history, deepened as far as rebasing needs"
+			}
+			if filter != "" {
+				detail += fmt.Sprintf(", partial clone of %s with %s", opts.FetchRemote, filter)
+			}
+			if sparse {
+				detail += ", sparse checkout"
+			}
+			return doctorResult{Detail: detail, Err: err}
+		}},
+	}
+}
+
+// configFix tells where to fix an invalid option, which is either given by
+// the environment or a configuration file.
+func configFix(ctx context.Context) string {
+	var paths []string
+	if path, err := userConfigPath(); err == nil {
+		paths = append(paths, path)
+	}
+	if root, err := cascade.RepositoryRoot(ctx); err == nil {
+		paths = append(paths, filepath.Join(root, repoConfigFile))
+	}
+
+	var existing []string
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			existing = append(existing, path)
+		}
+	}
+	if len(existing) == 0 {
+		return "check the CASCADE_ environment variables"
+	}
+	return "fix the setting in " + strings.Join(existing, " or ") + ", or in the CASCADE_ environment variables"
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/134130/gh-cascade/pkg/cascade"
+	"github.com/briandowns/spinner"
+	"github.com/fatih/color"
+)
+
+// logLevel is the minimum level printed by the default logger. Nothing is
+// logged unless --verbose (info) or --debug (debug) is given.
+var logLevel = new(slog.LevelVar)
+
+func init() {
+	logLevel.Set(slog.LevelWarn)
+	slog.SetDefault(slog.New(slog.NewTextHandler(redactingWriter{os.Stderr}, &slog.HandlerOptions{Level: logLevel})))
+}
+
+// redactingWriter masks what cascade.Redact does in everything written to w.
+// Each line printed or logged is a single write, so nothing to mask is split
+// across writes.
+type redactingWriter struct {
+	w io.Writer
+}
+
+func (r redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, cascade.Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// redactOutput masks tokens and credentials in everything printed to stdout
+// and stderr, e.g. in the errors of failed pushes.
+func redactOutput() {
+	color.Output = redactingWriter{color.Output}
+	color.Error = redactingWriter{color.Error}
+}
+
+// setupQuiet silences everything but errors, which go to stderr, for
+// --quiet.
+func setupQuiet() {
+	color.Output = io.Discard
+}
+
+func setupLogging(verbose, debug bool) {
+	switch {
+	case debug:
+		logLevel.Set(slog.LevelDebug)
+		logBuildInfo()
+	case verbose:
+		logLevel.Set(slog.LevelInfo)
+	}
+}
+
+// newSpinner returns the progress spinner used throughout the tool. It is
+// disabled while logging, since it would keep redrawing over the log lines.
+func newSpinner() *spinner.Spinner {
+	sp := spinner.New(spinner.CharSets[14], 40*time.Millisecond)
+	if logLevel.Level() < slog.LevelWarn || color.Output == io.Discard {
+		sp.Disable()
+	}
+	return sp
+}
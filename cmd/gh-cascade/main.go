@@ -0,0 +1,530 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/134130/gh-cascade/pkg/cascade"
+	"github.com/fatih/color"
+)
+
+var (
+	bold     = color.New(color.Bold).SprintFunc()
+	white    = color.New(color.FgWhite).SprintFunc()
+	hiBlack  = color.New(color.FgHiBlack).SprintFunc()
+	hiYellow = color.New(color.FgHiYellow).SprintFunc()
+	red      = color.New(color.FgRed).SprintFunc()
+	green    = color.New(color.FgGreen).SprintFunc()
+	blue     = color.New(color.FgBlue).SprintFunc()
+	purple   = color.New(color.FgMagenta).SprintFunc()
+)
+
+var _ flag.Value = (*RepositoryFlag)(nil)
+
+type RepositoryFlag string
+
+func (r *RepositoryFlag) String() string {
+	return string(*r)
+}
+
+func (r *RepositoryFlag) Set(s string) error {
+	*r = RepositoryFlag(s)
+	return nil
+}
+
+// Exit codes, documented in the README.
+const (
+	// exitOK means every pull request that was due has been rebased.
+	exitOK = 0
+	// exitError means the run failed before or outside of any single pull
+	// request.
+	exitError = 1
+	// exitFailed means some pull requests could not be rebased, or were
+	// skipped with --fail-on-skip.
+	exitFailed = 2
+	// exitNothingToDo means no pull request was due for a rebase.
+	exitNothingToDo = 3
+	// exitInterrupted means the run was interrupted with Ctrl-C, like a
+	// shell reports a command killed by SIGINT.
+	exitInterrupted = 130
+)
+
+func main() {
+	// client, err := api.DefaultRESTClient()
+	// if err != nil {
+	// 	fmt.Println(err)
+	// 	return
+	// }
+
+	applyColorEnv()
+	redactOutput()
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "merge":
+			os.Exit(runMerge(os.Args[2:]))
+		case "undo":
+			os.Exit(runUndo(os.Args[2:]))
+		case "status":
+			os.Exit(runStatus(os.Args[2:]))
+		case "create":
+			os.Exit(runCreate(os.Args[2:]))
+		case "adopt":
+			os.Exit(runAdopt(os.Args[2:]))
+		case "ui":
+			os.Exit(runUI(os.Args[2:]))
+		case "doctor":
+			os.Exit(runDoctor(os.Args[2:]))
+		case "up", "down", "top":
+			os.Exit(runNavigate(os.Args[1], os.Args[2:]))
+		case "prune-metadata":
+			os.Exit(runPruneMetadata(os.Args[2:]))
+		case "sync":
+			os.Exit(run("sync", os.Args[2:]))
+		case "repos":
+			os.Exit(runRepos(os.Args[2:]))
+		case "version", "--version":
+			os.Exit(runVersion(os.Args[2:]))
+		case "completion":
+			os.Exit(runCompletion(os.Args[2:]))
+		case "__complete":
+			os.Exit(runComplete(os.Args[2:]))
+		}
+	}
+
+	os.Exit(run("", os.Args[1:]))
+}
+
+// errTimedOut is the error of pull requests left when --timeout elapsed.
+var errTimedOut = errors.New("not rebased, --timeout elapsed")
+
+// errInterrupted is the error of pull requests left when the run was
+// interrupted.
+var errInterrupted = errors.New("not rebased, interrupted")
+
+// errFailedFast is the error of pull requests left when one failed with
+// --fail-fast.
+var errFailedFast = cascade.Skipf("not rebased, an earlier pull request failed and --fail-fast is given")
+
+// run runs gh cascade, or gh cascade sync for section "sync", and returns its
+// exit code.
+func run(section string, args []string) int {
+	started := time.Now()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	// The first Ctrl-C winds the run down, a second one kills it.
+	context.AfterFunc(ctx, stop)
+
+	opts, err := parseRunOptions(ctx, section, args)
+	if err != nil {
+		return reportOptionsError(err)
+	}
+	if opts.stopRecording != nil {
+		defer func() {
+			if err := opts.stopRecording(); err != nil {
+				fmt.Fprintln(color.Error, red("error:"), err)
+			}
+		}()
+	}
+
+	setupLogging(opts.Verbose, opts.Debug)
+	// The JSON report is all --output json prints to standard output.
+	if opts.Quiet || opts.Output == "json" {
+		setupQuiet()
+	}
+
+	if opts.CI {
+		if err = cascade.SetupCI(ctx, opts.FetchRemote); err != nil {
+			fmt.Fprintln(color.Error, red("error:"), err)
+			return exitError
+		}
+	}
+
+	closeAuditLog, err := openAuditLog(opts)
+	if err != nil {
+		fmt.Fprintln(color.Error, red("error:"), err)
+		return exitError
+	}
+	defer closeAuditLog()
+
+	// A dry run checks nothing out, so it needs neither a clean workspace nor
+	// a restore.
+	restore, release := func() {}, func() {}
+	if !opts.DryRun {
+		restore, release, err = prepareWorkspace(ctx, opts.ForceUnlock, opts.Autostash)
+		if errors.Is(err, cascade.ErrDirtyWorkspace) {
+			fmt.Fprintln(color.Error, red("x"), "current branch is dirty. please retry after stashing or committing your changes, or with --autostash.")
+			return exitError
+		} else if err != nil {
+			fmt.Fprintln(color.Error, red("error:"), err)
+			return exitError
+		}
+	}
+	defer release()
+
+	if opts.Watch {
+		runWatch(ctx, opts, restore)
+		return exitOK
+	}
+
+	sp := newSpinner()
+	defer sp.Stop()
+
+	sp.Suffix = " Fetching pull requests..."
+	sp.Start()
+
+	defaultBranch, pullRequests, err := fetchPullRequests(ctx, opts)
+	if err != nil {
+		sp.Stop()
+		fmt.Fprintln(color.Error, red("x"), err)
+		return errorCode(ctx)
+	}
+	sp.Stop()
+
+	fmt.Fprintf(color.Output, "%s%s\n", green("✔"), " Fetching pull requests...")
+
+	if len(pullRequests) == 0 {
+		fmt.Fprintf(color.Output, "%s%s\n", green("✔"), " No open or draft pull requests found.")
+		return exitNothingToDo
+	} else {
+		fmt.Fprintf(color.Output, "%s%s\n", green("✔"), fmt.Sprintf(" Found %d open or draft pull requests.", len(pullRequests)))
+	}
+
+	sp = newSpinner()
+	sp.Suffix = " Planning rebases..."
+	sp.Start()
+	defer sp.Stop()
+
+	plan, err := cascade.Plan(ctx, &opts.Options, defaultBranch, pullRequests)
+	if err != nil {
+		sp.Stop()
+		fmt.Fprintln(color.Error, red("x"), err)
+		return errorCode(ctx)
+	}
+
+	sp.Stop()
+	fmt.Fprintf(color.Output, "%s%s\n", green("✔"), " Planning rebases...")
+
+	if opts.DryRun {
+		if opts.Output == "json" {
+			if err = printJSONReport(opts, plan, true); err != nil {
+				fmt.Fprintln(color.Error, red("error:"), err)
+			}
+		} else {
+			printPlan(plan, opts)
+		}
+		return exitCode(opts, plan)
+	}
+
+	if opts.OnConflict == cascade.OnConflictStop {
+		if n := countConflicts(plan); n > 0 {
+			printPlan(plan, opts)
+			fmt.Fprintln(color.Error, red("x"), fmt.Sprintf("%d pull requests are predicted to conflict, nothing was rebased.", n))
+			return exitFailed
+		}
+	}
+
+	sp = newSpinner()
+	sp.Suffix = " Rebasing pull requests..."
+	sp.Start()
+	defer sp.Stop()
+
+	failedFast := false
+	index := map[int]int{}
+	for i, processed := range plan {
+		index[processed.Number] = i
+		if processed.Error == nil {
+			// The rebase in flight is left to finish, as killing it would
+			// leave the workspace mid-rebase.
+			switch {
+			case ctx.Err() != nil:
+				processed.Error = errInterrupted
+			case opts.Timeout > 0 && time.Since(started) > opts.Timeout:
+				processed.Error = errTimedOut
+			case failedFast:
+				processed.Error = errFailedFast
+			default:
+				// Plan orders each pull request after its dependency, so that
+				// of a chained pull request is done by now.
+				if processed.Chained() {
+					if processed = cascade.Restack(ctx, &opts.Options, processed, plan[index[processed.DependedPullRequest.Number]]); processed.Error != nil {
+						break
+					}
+				}
+				// On Ctrl-C the rebase in flight is aborted rather than
+				// pushed half done.
+				rebaseStarted := time.Now()
+				processed = cascade.Rebase(ctx, &opts.Options, defaultBranch, processed)
+				slog.Info("rebase", slog.Int("pr", processed.Number), slog.String("result", string(processed.Result())), slog.Duration("duration", time.Since(rebaseStarted)))
+				if processed.Error != nil && ctx.Err() != nil {
+					processed.Error = fmt.Errorf("interrupted: %w", processed.Error)
+				}
+				if processed.Result() == cascade.ResultFailed {
+					cascade.SkipDescendants(plan, processed.Number)
+					failedFast = opts.FailFast
+				}
+			}
+		}
+		plan[i] = processed
+	}
+	processedPullRequests := plan
+
+	sp.Stop()
+	fmt.Fprintf(color.Output, "%s%s\n", green("✔"), " Rebasing pull requests...")
+
+	// What was done is still reported after Ctrl-C, while nothing else is
+	// changed.
+	interrupted := ctx.Err() != nil
+	ctx = context.WithoutCancel(ctx)
+
+	if opts.NumberTitles && !interrupted {
+		numberTitles(ctx, pullRequests)
+	}
+
+	if opts.Template != nil {
+		if err = printFormatted(opts.Template, processedPullRequests); err != nil {
+			fmt.Fprintln(color.Error, red("error:"), fmt.Errorf("format: %w", err))
+		}
+	} else if opts.Output == "markdown" {
+		fmt.Fprintf(color.Output, "\n%s", formatMarkdownReport(processedPullRequests))
+	} else if opts.Output == "json" {
+		if err = printJSONReport(opts, processedPullRequests, false); err != nil {
+			fmt.Fprintln(color.Error, red("error:"), err)
+		}
+	} else if opts.Quiet {
+		printAttention(processedPullRequests, opts)
+	} else {
+		printReport(processedPullRequests, opts)
+		fmt.Fprintf(color.Output, "\n%s\n", formatSummary(processedPullRequests, time.Since(started)))
+	}
+
+	if opts.Prune && !interrupted {
+		prune(ctx, opts, processedPullRequests)
+	}
+
+	if opts.ReportIssue != 0 {
+		if err = cascade.CreateIssueComment(ctx, opts.ReportIssue, "### gh cascade\n\n"+formatMarkdownReport(processedPullRequests)); err != nil {
+			fmt.Fprintln(color.Error, red("error:"), fmt.Errorf("comment on #%d: %w", opts.ReportIssue, err))
+		}
+	}
+
+	if opts.NotifyWebhook != "" {
+		if err = postNotification(ctx, opts, processedPullRequests); err != nil {
+			fmt.Fprintln(color.Error, red("error:"), fmt.Errorf("notify webhook: %w", err))
+		}
+	}
+
+	if opts.CI {
+		printAnnotations(processedPullRequests)
+		if err = WriteStepSummary(processedPullRequests); err != nil {
+			fmt.Fprintln(color.Error, red("error:"), fmt.Errorf("write job summary: %w", err))
+		}
+	}
+
+	if interrupted {
+		fmt.Fprintln(color.Error, red("x"), "interrupted, the remaining pull requests were not rebased.")
+		return exitInterrupted
+	}
+
+	cascade.LogRateLimits(ctx)
+
+	return exitCode(opts, processedPullRequests)
+}
+
+// errorCode returns the exit code of a run that failed before rebasing
+// anything, which may be due to Ctrl-C.
+func errorCode(ctx context.Context) int {
+	if ctx.Err() != nil {
+		return exitInterrupted
+	}
+	return exitError
+}
+
+// numberTitles brings the [i/n] prefixes of the titles of pullRequests in
+// line with their chains.
+func numberTitles(ctx context.Context, pullRequests []cascade.PullRequest) {
+	for number, title := range cascade.NumberedTitles(pullRequests) {
+		if err := cascade.UpdatePullRequestTitle(ctx, number, title); err != nil {
+			fmt.Fprintln(color.Error, red("error:"), fmt.Errorf("retitle #%d: %w", number, err))
+		}
+	}
+}
+
+// exitCode computes the exit code of a run from its results. Pull requests
+// without dependencies and those already up to date never count as skipped.
+func exitCode(opts *Options, processedPullRequests []cascade.ProcessedPullRequest) int {
+	due := false
+	for _, pr := range processedPullRequests {
+		switch pr.Result() {
+		case cascade.ResultFailed:
+			return exitFailed
+		case cascade.ResultSkipped:
+			if opts.FailOnSkip && pr.Error != cascade.ErrNoDependOn && pr.Error != cascade.ErrUpToDate {
+				return exitFailed
+			}
+		case cascade.ResultRebased:
+			due = true
+		}
+	}
+
+	if !due {
+		return exitNothingToDo
+	}
+	return exitOK
+}
+
+// reportOptionsError prints an error returned while parsing options and
+// returns the exit code for it.
+func reportOptionsError(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if !errors.Is(err, errReported) {
+		fmt.Fprintln(color.Error, red("error:"), err)
+		printFix(color.Error, err)
+	}
+	return exitError
+}
+
+// prepareWorkspace takes the lock, stashes uncommitted changes with
+// cascade.Autostash if autostash, and calls cascade.PrepareWorkspace. It
+// returns a restore that checks the original branch back out, which may be
+// called after every pass of --watch, and a release that restores, applies the
+// stash back and releases the lock, to be called once at exit. Both report
+// their own errors, since they are deferred.
+func prepareWorkspace(ctx context.Context, forceUnlock, autostash bool) (restore, release func(), err error) {
+	unlock, err := lock(ctx, forceUnlock)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	unstash := func() error { return nil }
+	if autostash {
+		if unstash, err = cascade.Autostash(ctx); err != nil {
+			unlock()
+			return nil, nil, err
+		}
+	}
+
+	restoreBranch, err := cascade.PrepareWorkspace(ctx)
+	if err != nil {
+		reportUnstash(unstash())
+		unlock()
+		return nil, nil, err
+	}
+
+	restore = func() {
+		if err := restoreBranch(); err != nil {
+			fmt.Fprintln(color.Error, red("error:"), err)
+		}
+	}
+	return restore, func() {
+		restore()
+		reportUnstash(unstash())
+		unlock()
+	}, nil
+}
+
+// reportUnstash reports the error of applying the autostash back, if any.
+func reportUnstash(err error) {
+	switch {
+	case errors.Is(err, cascade.ErrAutostashConflict):
+		fmt.Fprintln(color.Error, red("x"), err)
+		fmt.Fprintf(color.Error, "  %s %s\n", hiBlack("→"), "resolve the conflicts and run git stash drop, or run git reset --hard and apply the changes again with git stash pop")
+	case err != nil:
+		fmt.Fprintln(color.Error, red("error:"), err)
+	}
+}
+
+// lock is cascade.Lock with an unlock that reports its own error, and an
+// error that tells how to break a stale lock.
+func lock(ctx context.Context, force bool) (func(), error) {
+	unlock, err := cascade.Lock(ctx, force)
+	var lockedErr *cascade.LockedError
+	if errors.As(err, &lockedErr) {
+		return nil, fmt.Errorf("%w; if it is no longer running, retry with --force-unlock", err)
+	} else if err != nil {
+		return nil, fmt.Errorf("lock: %w", err)
+	}
+
+	return func() {
+		if err := unlock(); err != nil {
+			fmt.Fprintln(color.Error, red("error:"), err)
+		}
+	}, nil
+}
+
+// openAuditLog sets up cascade.Options.AuditLog if --audit-log is given, and
+// returns a function that closes it.
+func openAuditLog(opts *Options) (func(), error) {
+	if opts.AuditLogPath == "" {
+		return func() {}, nil
+	}
+	auditLog, err := cascade.OpenAuditLog(opts.AuditLogPath)
+	if err != nil {
+		return nil, err
+	}
+	opts.AuditLog = auditLog
+
+	return func() {
+		if err := auditLog.Close(); err != nil {
+			fmt.Fprintln(color.Error, red("error:"), err)
+		}
+	}, nil
+}
+
+// fetchPullRequests resolves the default branch and lists the pull requests
+// to process, or gets those given by number. With --current, those listed
+// are narrowed down to the pull request of the current branch and its
+// descendants. Their commits are fetched by cascade.Plan.
+func fetchPullRequests(ctx context.Context, opts *Options) (string, []cascade.PullRequest, error) {
+	defaultBranch, err := cascade.GetDefaultBranch(ctx)
+	if err != nil {
+		return "", nil, fmt.Errorf("resolve default branch: %w", err)
+	}
+
+	if len(opts.Numbers) > 0 {
+		var pullRequests []cascade.PullRequest
+		seen := map[int]bool{}
+		for _, number := range opts.Numbers {
+			if seen[number] {
+				continue
+			}
+			seen[number] = true
+			pr, err := cascade.GetPullRequest(ctx, number)
+			if err != nil {
+				return "", nil, fmt.Errorf("get PR #%d: %w", number, err)
+			}
+			if pr.State != "OPEN" {
+				return "", nil, fmt.Errorf("PR #%d is %s", number, strings.ToLower(pr.State))
+			}
+			pullRequests = append(pullRequests, *pr)
+		}
+		return defaultBranch, pullRequests, nil
+	}
+
+	pullRequests, err := cascade.ListPullRequests(ctx, opts.PullRequestFilter())
+	if err != nil {
+		return "", nil, fmt.Errorf("list pull requests: %w", err)
+	}
+
+	if opts.Current {
+		i := slices.IndexFunc(pullRequests, func(pr cascade.PullRequest) bool {
+			return pr.HeadRefName == opts.CurrentBranch
+		})
+		if i < 0 {
+			return "", nil, fmt.Errorf("no open pull request found for the current branch %s", opts.CurrentBranch)
+		}
+		pullRequests = cascade.Descendants(pullRequests[i].Number, pullRequests)
+	}
+
+	return defaultBranch, pullRequests, nil
+}
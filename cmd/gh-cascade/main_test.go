@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+// newTestRepository creates a repository with a committed file on main,
+// changes the working directory to it until the test ends and returns a
+// function that runs git in it and returns what it printed.
+func newTestRepository(t *testing.T) func(args ...string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	for _, name := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(name, "gh-cascade")
+	}
+	for _, name := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(name, "gh-cascade@example.com")
+	}
+
+	dir := t.TempDir()
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(previous); err != nil {
+			t.Error(err)
+		}
+	})
+
+	git := func(args ...string) string {
+		t.Helper()
+		out, err := exec.Command("git", args...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %s: %v", strings.Join(args, " "), out, err)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "--quiet", "--initial-branch=main")
+	writeFile(t, filepath.Join(dir, "file"), "committed\n")
+	git("add", "file")
+	git("commit", "--quiet", "--message=initial")
+	git("branch", "other")
+	return git
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPrepareWorkspaceAutostashAcrossPasses(t *testing.T) {
+	git := newTestRepository(t)
+	writeFile(t, "file", "uncommitted\n")
+
+	var stderr bytes.Buffer
+	previousError := color.Error
+	color.Error = &stderr
+	t.Cleanup(func() { color.Error = previousError })
+
+	ctx := context.Background()
+	restore, release, err := prepareWorkspace(ctx, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each pass of --watch checks another branch out and restores.
+	for pass := 1; pass <= 2; pass++ {
+		git("checkout", "--quiet", "other")
+		restore()
+
+		if status := git("status", "--porcelain"); status != "" {
+			t.Fatalf("pass %d: working tree is dirty after restore:\n%s", pass, status)
+		}
+		if stashes := git("stash", "list"); strings.Count(stashes, "\n") != 0 || stashes == "" {
+			t.Fatalf("pass %d: stash = %q, want the autostash alone", pass, stashes)
+		}
+		if branch := git("branch", "--show-current"); branch != "main" {
+			t.Fatalf("pass %d: on %s, want main", pass, branch)
+		}
+	}
+
+	release()
+
+	data, err := os.ReadFile("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "uncommitted\n" {
+		t.Errorf("file = %q after release, want the uncommitted changes back", data)
+	}
+	if stashes := git("stash", "list"); stashes != "" {
+		t.Errorf("stash = %q after release, want it empty", stashes)
+	}
+	if _, err := os.Stat(filepath.Join(".git", "cascade.lock")); !os.IsNotExist(err) {
+		t.Errorf("lock file left behind: %v", err)
+	}
+	if stderr.Len() > 0 {
+		t.Errorf("reported errors:\n%s", stderr.String())
+	}
+}
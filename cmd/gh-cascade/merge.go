@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/134130/gh-cascade/pkg/cascade"
+	"github.com/briandowns/spinner"
+	"github.com/cli/go-gh/v2/pkg/repository"
+	"github.com/fatih/color"
+)
+
+type MergeOptions struct {
+	Chain        int
+	Method       string
+	WaitChecks   bool
+	PollInterval time.Duration
+	Timeout      time.Duration
+	Rerere       bool
+	Sign         bool
+	Verbose      bool
+	Debug        bool
+	ForceUnlock  bool
+	Autostash    bool
+	Patterns     StringsFlag
+	Keywords     StringsFlag
+	FetchRemote  string
+	PushRemote   string
+	// Repository is the base repository, resolved after parsing.
+	Repository repository.Repository
+}
+
+func parseMergeOptions(ctx context.Context, args []string) (*MergeOptions, error) {
+	opts := &MergeOptions{}
+	fs := flag.NewFlagSet("merge", flag.ContinueOnError)
+	fs.IntVar(&opts.Chain, "chain", 0, "number of the pull request at the bottom of the chain to land")
+	fs.StringVar(&opts.Method, "method", "merge", "merge method: merge, squash or rebase")
+	fs.BoolVar(&opts.WaitChecks, "wait-checks", true, "wait for checks to pass before merging each pull request")
+	fs.DurationVar(&opts.PollInterval, "poll-interval", 15*time.Second, "how often to poll pull request state")
+	fs.DurationVar(&opts.Timeout, "timeout", 30*time.Minute, "how long to wait for checks or a merge of a single pull request")
+	fs.BoolVar(&opts.Rerere, "rerere", true, "resolve conflicts that have a recorded resolution (see git rerere) instead of aborting")
+	fs.BoolVar(&opts.Sign, "sign", false, "sign rebased commits with the key git is configured with, as commit.gpgSign does")
+	fs.BoolVar(&opts.Verbose, "verbose", false, "log every git and gh command with its duration")
+	fs.BoolVar(&opts.Debug, "debug", false, "like --verbose, and also log the output of every command")
+	fs.BoolVar(&opts.ForceUnlock, "force-unlock", false, "break the lock of another run, e.g. one that was killed")
+	fs.BoolVar(&opts.Autostash, "autostash", false, "stash uncommitted changes at the start and apply them back at the end, instead of refusing to run")
+	addPatternFlags(fs, &opts.Patterns, &opts.Keywords)
+	addRemoteFlags(fs, &opts.FetchRemote, &opts.PushRemote)
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+
+	if err := cascade.Preflight(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := applyDefaults(ctx, fs, "merge"); err != nil {
+		return nil, err
+	}
+
+	if opts.Chain == 0 {
+		return nil, errors.New("--chain is required")
+	}
+	switch opts.Method {
+	case "merge", "squash", "rebase":
+	default:
+		return nil, fmt.Errorf("invalid merge method %q: must be one of merge, squash, rebase", opts.Method)
+	}
+	if _, err := cascade.CheckSigning(ctx, opts.Sign); err != nil {
+		return nil, err
+	}
+
+	if err := installDependOnPatterns(opts.Patterns, opts.Keywords); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if opts.Repository, err = cascade.SetupRepository(ctx, &opts.FetchRemote, &opts.PushRemote); err != nil {
+		return nil, err
+	}
+
+	return opts, nil
+}
+
+// runMerge lands a chain of pull requests bottom-up: each pull request is
+// merged, and its child is rebased onto the merge commit, retargeted, and
+// merged once its checks pass.
+func runMerge(args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts, err := parseMergeOptions(ctx, args)
+	if err != nil {
+		return reportOptionsError(err)
+	}
+
+	setupLogging(opts.Verbose, opts.Debug)
+
+	_, release, err := prepareWorkspace(ctx, opts.ForceUnlock, opts.Autostash)
+	if errors.Is(err, cascade.ErrDirtyWorkspace) {
+		fmt.Fprintln(color.Error, red("x"), "current branch is dirty. please retry after stashing or committing your changes, or with --autostash.")
+		return exitError
+	} else if err != nil {
+		fmt.Fprintln(color.Error, red("error:"), err)
+		return exitError
+	}
+	defer release()
+
+	sp := newSpinner()
+	defer sp.Stop()
+
+	sp.Suffix = " Resolving chain..."
+	sp.Start()
+
+	root, err := cascade.GetPullRequest(ctx, opts.Chain)
+	if err != nil {
+		sp.Stop()
+		fmt.Fprintln(color.Error, red("x"), fmt.Errorf("get PR #%d: %w", opts.Chain, err))
+		return exitError
+	}
+
+	pullRequests, err := cascade.ListPullRequests(ctx, cascade.PullRequestFilter{Authors: []string{"@me"}})
+	if err != nil {
+		sp.Stop()
+		fmt.Fprintln(color.Error, red("x"), fmt.Errorf("list pull requests: %w", err))
+		return exitError
+	}
+
+	chain, err := cascade.ResolveChain(*root, pullRequests)
+	if err != nil {
+		sp.Stop()
+		fmt.Fprintln(color.Error, red("x"), err)
+		return exitError
+	}
+	sp.Stop()
+
+	numbers := make([]string, 0, len(chain))
+	for _, pr := range chain {
+		numbers = append(numbers, fmt.Sprintf("#%d", pr.Number))
+	}
+	fmt.Fprintf(color.Output, "%s Resolved chain %s\n", green("✔"), strings.Join(numbers, " → "))
+
+	var parent *cascade.PullRequest
+	for _, pr := range chain {
+		if parent, err = landPullRequest(ctx, sp, opts, pr, parent); err != nil {
+			sp.Stop()
+			fmt.Fprintln(color.Error, red("x"), fmt.Errorf("#%d: %w", pr.Number, err))
+			return exitFailed
+		}
+		fmt.Fprintf(color.Output, "%s Merged #%d %s\n", green("✔"), pr.Number, pr.URL)
+	}
+
+	return exitOK
+}
+
+// landPullRequest merges pr and returns its merged state. If parent is set, pr
+// is first rebased onto the parent's merge commit, pushed, and retargeted.
+func landPullRequest(ctx context.Context, sp *spinner.Spinner, opts *MergeOptions, pr cascade.PullRequest, parent *cascade.PullRequest) (*cascade.PullRequest, error) {
+	defer sp.Stop()
+
+	var headOid string
+	if parent != nil {
+		sp.Suffix = fmt.Sprintf(" Rebasing #%d onto #%d...", pr.Number, parent.Number)
+		sp.Start()
+
+		branch := cascade.PullRequestBranch(pr.Number)
+		if err := cascade.FetchRefs(ctx, opts.FetchRemote, parent.BaseRefName, cascade.PullRequestHeadRef(pr.Number)); err != nil {
+			return nil, fmt.Errorf("fetch from %s: %w", opts.FetchRemote, err)
+		}
+		if err := cascade.CheckoutPullRequest(ctx, pr); err != nil {
+			return nil, fmt.Errorf("checkout: %w", err)
+		}
+		if err := cascade.BackupBranch(ctx, branch); err != nil {
+			return nil, fmt.Errorf("back up: %w", err)
+		}
+		if _, err := cascade.RebaseOntoPullRequest(ctx, parent.MergeCommit.Oid, parent.HeadRefOid, branch, cascade.RebaseOptions{Rerere: opts.Rerere, Sign: opts.Sign}); err != nil {
+			return nil, fmt.Errorf("rebase: %w", err)
+		}
+		remote, err := cascade.HeadRemote(ctx, pr, opts.FetchRemote, opts.PushRemote)
+		if err != nil {
+			return nil, fmt.Errorf("push: %w", err)
+		}
+		if err := cascade.PushBranch(ctx, remote, pr.HeadRefName, branch, pr.HeadRefOid); err != nil {
+			return nil, fmt.Errorf("push: %w", err)
+		}
+		if err := cascade.BackupRemoteBranch(ctx, branch, pr.HeadRefOid); err != nil {
+			return nil, fmt.Errorf("back up remote tip: %w", err)
+		}
+
+		if headOid, err = cascade.RevParse(ctx, branch); err != nil {
+			return nil, err
+		}
+
+		if pr.BaseRefName == parent.HeadRefName {
+			if err := cascade.RetargetPullRequest(ctx, pr.Number, parent.BaseRefName); err != nil {
+				return nil, fmt.Errorf("retarget onto %s: %w", parent.BaseRefName, err)
+			}
+		}
+	}
+
+	if opts.WaitChecks {
+		sp.Suffix = fmt.Sprintf(" Waiting for checks of #%d...", pr.Number)
+		sp.Start()
+
+		if err := cascade.WaitForChecks(ctx, pr.Number, headOid, opts.PollInterval, opts.Timeout); err != nil {
+			return nil, err
+		}
+	}
+
+	queue, err := cascade.GetMergeQueueStatus(ctx, pr.Number)
+	if err != nil {
+		return nil, fmt.Errorf("check the merge queue: %w", err)
+	}
+	if queue.Enabled {
+		return enqueuePullRequest(ctx, sp, opts, pr, headOid)
+	}
+
+	sp.Suffix = fmt.Sprintf(" Merging #%d...", pr.Number)
+	sp.Start()
+
+	if err := cascade.MergePullRequest(ctx, pr.Number, opts.Method); err != nil {
+		return nil, fmt.Errorf("merge: %w", err)
+	}
+
+	return cascade.WaitForMerge(ctx, pr.Number, opts.PollInterval, opts.Timeout)
+}
+
+// enqueuePullRequest adds pr to the merge queue of its base branch, which
+// merges it as it is configured to rather than with opts.Method, and waits
+// for it to merge. headOid, if set, is the head pr was pushed at.
+func enqueuePullRequest(ctx context.Context, sp *spinner.Spinner, opts *MergeOptions, pr cascade.PullRequest, headOid string) (*cascade.PullRequest, error) {
+	sp.Suffix = fmt.Sprintf(" Adding #%d to the merge queue...", pr.Number)
+	sp.Start()
+
+	if err := cascade.EnqueuePullRequest(ctx, pr.ID, headOid); err != nil {
+		return nil, fmt.Errorf("add to the merge queue: %w", err)
+	}
+
+	return cascade.WaitForQueuedMerge(ctx, pr.Number, opts.PollInterval, opts.Timeout, func(queue cascade.MergeQueueStatus) {
+		if queue.State == cascade.MergeQueueMerging {
+			sp.Suffix = fmt.Sprintf(" Merging #%d in the merge queue...", pr.Number)
+		} else {
+			sp.Suffix = fmt.Sprintf(" Waiting for #%d at position %d in the merge queue...", pr.Number, queue.Position)
+		}
+	})
+}
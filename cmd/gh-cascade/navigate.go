@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/134130/gh-cascade/pkg/cascade"
+	"github.com/fatih/color"
+)
+
+type NavigateOptions struct {
+	Verbose     bool
+	Debug       bool
+	Authors     StringsFlag
+	AllAuthors  bool
+	Patterns    StringsFlag
+	Keywords    StringsFlag
+	FetchRemote string
+	PushRemote  string
+}
+
+func parseNavigateOptions(ctx context.Context, direction string, args []string) (*NavigateOptions, error) {
+	opts := &NavigateOptions{}
+	fs := flag.NewFlagSet(direction, flag.ContinueOnError)
+	fs.BoolVar(&opts.Verbose, "verbose", false, "log every git and gh command with its duration")
+	fs.BoolVar(&opts.Debug, "debug", false, "like --verbose, and also log the output of every command")
+	fs.Var(&opts.Authors, "author", "only follow pull requests of this author (repeatable, default: @me)")
+	fs.BoolVar(&opts.AllAuthors, "all-authors", false, "follow pull requests of every author")
+	addPatternFlags(fs, &opts.Patterns, &opts.Keywords)
+	addRemoteFlags(fs, &opts.FetchRemote, &opts.PushRemote)
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+
+	if err := cascade.Preflight(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := applyDefaults(ctx, fs, "navigate"); err != nil {
+		return nil, err
+	}
+
+	if opts.AllAuthors && len(opts.Authors) > 0 {
+		return nil, errors.New("--author cannot be used with --all-authors")
+	}
+
+	if err := installDependOnPatterns(opts.Patterns, opts.Keywords); err != nil {
+		return nil, err
+	}
+
+	if _, err := cascade.SetupRepository(ctx, &opts.FetchRemote, &opts.PushRemote); err != nil {
+		return nil, err
+	}
+
+	return opts, nil
+}
+
+// PullRequestFilter returns the filter that selects the pull requests to
+// navigate between.
+func (o *NavigateOptions) PullRequestFilter() cascade.PullRequestFilter {
+	return (&Options{Authors: o.Authors, AllAuthors: o.AllAuthors}).PullRequestFilter()
+}
+
+// runNavigate checks out the head branch of the pull request the current one
+// depends on for down, of the one that depends on it for up, or of the last
+// one of its stack for top.
+func runNavigate(direction string, args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts, err := parseNavigateOptions(ctx, direction, args)
+	if err != nil {
+		return reportOptionsError(err)
+	}
+
+	setupLogging(opts.Verbose, opts.Debug)
+
+	branch, err := cascade.GetCurrentRef(ctx)
+	if err != nil {
+		fmt.Fprintln(color.Error, red("error:"), "resolve current branch:", err)
+		return exitError
+	}
+
+	pullRequests, err := cascade.ListPullRequests(ctx, opts.PullRequestFilter())
+	if err != nil {
+		fmt.Fprintln(color.Error, red("error:"), "list pull requests:", err)
+		return exitError
+	}
+
+	var current *cascade.PullRequest
+	for i := range pullRequests {
+		if pullRequests[i].HeadRefName == branch {
+			current = &pullRequests[i]
+			break
+		}
+	}
+	if current == nil {
+		fmt.Fprintln(color.Error, red("x"), "no open pull request found for the current branch", branch)
+		return exitError
+	}
+
+	target, err := navigate(ctx, direction, *current, pullRequests)
+	if err != nil {
+		fmt.Fprintln(color.Error, red("x"), err)
+		return exitNothingToDo
+	}
+	if target.IsCrossRepository {
+		fmt.Fprintf(color.Error, "%s #%d is from a fork, check it out with gh pr checkout %d\n", red("x"), target.Number, target.Number)
+		return exitError
+	}
+
+	if err = cascade.SwitchBranch(ctx, opts.FetchRemote, target.HeadRefName); err != nil {
+		fmt.Fprintln(color.Error, red("error:"), err)
+		return exitError
+	}
+	fmt.Fprintf(color.Output, "%s Switched to %s %s %s\n", green("✔"), bold(target.HeadRefName), blue(fmt.Sprintf("#%d", target.Number)), hiBlack(target.Title))
+	return exitOK
+}
+
+// navigate returns the pull request to check out from current. It fails at
+// either end of the stack, and where the stack forks, as the way up would be
+// ambiguous.
+func navigate(ctx context.Context, direction string, current cascade.PullRequest, pullRequests []cascade.PullRequest) (cascade.PullRequest, error) {
+	if direction == "down" {
+		dependOns := cascade.DependOnsOf(current)
+		if len(dependOns) == 0 {
+			return cascade.PullRequest{}, fmt.Errorf("#%d is at the bottom of its stack", current.Number)
+		}
+		if len(dependOns) > 1 {
+			return cascade.PullRequest{}, fmt.Errorf("#%d depends on several pull requests: %s", current.Number, formatNumbers(dependOns))
+		}
+		for _, pr := range pullRequests {
+			if pr.Number == dependOns[0] {
+				return pr, nil
+			}
+		}
+		parent, err := cascade.GetPullRequest(ctx, dependOns[0])
+		if err != nil {
+			return cascade.PullRequest{}, fmt.Errorf("get PR #%d: %w", dependOns[0], err)
+		}
+		if parent.State != "OPEN" {
+			return cascade.PullRequest{}, fmt.Errorf("#%d is at the bottom of its stack, as #%d is %s", current.Number, parent.Number, strings.ToLower(parent.State))
+		}
+		return *parent, nil
+	}
+
+	for {
+		var children []cascade.PullRequest
+		for _, pr := range pullRequests {
+			if dependOns := cascade.DependOnsOf(pr); len(dependOns) == 1 && dependOns[0] == current.Number {
+				children = append(children, pr)
+			}
+		}
+
+		switch {
+		case len(children) == 0 && direction == "up":
+			return cascade.PullRequest{}, fmt.Errorf("#%d is at the top of its stack", current.Number)
+		case len(children) == 0:
+			return current, nil
+		case len(children) > 1:
+			numbers := make([]int, 0, len(children))
+			for _, child := range children {
+				numbers = append(numbers, child.Number)
+			}
+			return cascade.PullRequest{}, fmt.Errorf("the stack forks at #%d, which %s depend on", current.Number, formatNumbers(numbers))
+		case direction == "up":
+			return children[0], nil
+		}
+		current = children[0]
+	}
+}
+
+// formatNumbers formats pull request numbers as "#1, #2".
+func formatNumbers(numbers []int) string {
+	parts := make([]string, 0, len(numbers))
+	for _, number := range numbers {
+		parts = append(parts, fmt.Sprintf("#%d", number))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/134130/gh-cascade/pkg/cascade"
+)
+
+// notifyTimeout bounds how long posting the summary may hold up the end of a
+// run.
+const notifyTimeout = 10 * time.Second
+
+// notificationPullRequest is a pull request in the generic JSON payload.
+type notificationPullRequest struct {
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	URL    string `json:"url"`
+	Result string `json:"result"`
+	Pushed bool   `json:"pushed"`
+	Error  string `json:"error,omitempty"`
+	// Warnings are only printed with --output json.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// resultPlanned is the result of the pull requests a dry run would rebase in
+// the JSON report.
+const resultPlanned = "planned"
+
+// notification is the generic JSON payload posted with --notify-format json,
+// and printed with --output json.
+type notification struct {
+	Repository string `json:"repository"`
+	// Planned is set instead of Rebased for a dry run.
+	Planned      int                       `json:"planned,omitempty"`
+	Rebased      int                       `json:"rebased"`
+	Failed       int                       `json:"failed"`
+	Skipped      int                       `json:"skipped"`
+	PullRequests []notificationPullRequest `json:"pullRequests"`
+}
+
+// newNotification summarizes a run. Pull requests without dependencies and
+// those already up to date are left out, as they are not news.
+func newNotification(repository string, processedPullRequests []cascade.ProcessedPullRequest) notification {
+	n := notification{Repository: repository, PullRequests: []notificationPullRequest{}}
+	for _, pr := range processedPullRequests {
+		if pr.Error == cascade.ErrNoDependOn || pr.Error == cascade.ErrUpToDate {
+			continue
+		}
+
+		switch pr.Result() {
+		case cascade.ResultRebased:
+			n.Rebased++
+		case cascade.ResultFailed:
+			n.Failed++
+		case cascade.ResultSkipped:
+			n.Skipped++
+		}
+
+		item := notificationPullRequest{Number: pr.Number, Title: pr.Title, URL: pr.URL, Result: string(pr.Result()), Pushed: pr.Pushed}
+		if pr.Error != nil {
+			item.Error = cascade.Redact(pr.Error.Error())
+		}
+		n.PullRequests = append(n.PullRequests, item)
+	}
+	return n
+}
+
+// slackPayload renders n as a Slack incoming webhook message.
+func (n notification) slackPayload() map[string]string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*gh cascade* on %s: %d rebased, %d failed, %d skipped", n.Repository, n.Rebased, n.Failed, n.Skipped)
+	for _, pr := range n.PullRequests {
+		fmt.Fprintf(&b, "\n%s <%s|#%d> %s", resultEmoji(cascade.Result(pr.Result)), pr.URL, pr.Number, slackEscape(pr.Title))
+		if pr.Error != "" {
+			fmt.Fprintf(&b, ": _%s_", slackEscape(pr.Error))
+		}
+	}
+	return map[string]string{"text": b.String()}
+}
+
+// slackEscape escapes the characters Slack reserves for its markup.
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// printJSONReport prints the result of a run, or the plan of a dry run with
+// planned, as the JSON payload of --notify-format json.
+func printJSONReport(opts *Options, processedPullRequests []cascade.ProcessedPullRequest, planned bool) error {
+	n := newNotification(opts.Repository.Owner+"/"+opts.Repository.Name, processedPullRequests)
+	warnings := map[int][]string{}
+	for _, pr := range processedPullRequests {
+		for _, warning := range pr.Warnings {
+			warnings[pr.Number] = append(warnings[pr.Number], cascade.Redact(warning.Error()))
+		}
+	}
+	for i, pr := range n.PullRequests {
+		n.PullRequests[i].Warnings = warnings[pr.Number]
+	}
+	if planned {
+		n.Planned, n.Rebased = n.Rebased, 0
+		for i, pr := range n.PullRequests {
+			if pr.Result == string(cascade.ResultRebased) {
+				n.PullRequests[i].Result = resultPlanned
+			}
+		}
+	}
+
+	encoder := json.NewEncoder(redactingWriter{os.Stdout})
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(n)
+}
+
+// postNotification posts the summary of a run to a webhook.
+func postNotification(ctx context.Context, opts *Options, processedPullRequests []cascade.ProcessedPullRequest) error {
+	n := newNotification(opts.Repository.Owner+"/"+opts.Repository.Name, processedPullRequests)
+
+	var payload any = n
+	if opts.NotifyFormat == "slack" {
+		payload = n.slackPayload()
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, opts.NotifyWebhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// The URL of a webhook is its secret, so it is left out of the error.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
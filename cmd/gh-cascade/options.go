@@ -0,0 +1,677 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/134130/gh-cascade/pkg/cascade"
+	"github.com/cli/go-gh/v2/pkg/repository"
+)
+
+// Options are the flags of gh cascade. Those that control planning and
+// rebasing are passed on to the cascade package as they are.
+type Options struct {
+	cascade.Options
+	Watch         bool
+	Interval      time.Duration
+	CI            bool
+	Verbose       bool
+	Debug         bool
+	Patterns      StringsFlag
+	Keywords      StringsFlag
+	DryRun        bool
+	Output        string
+	NoTitles      bool
+	ShowRangeDiff bool
+	FailOnSkip    bool
+	Format        string
+	ReportIssue   int
+	Authors       StringsFlag
+	AllAuthors    bool
+	Assignee      string
+	Labels        StringsFlag
+	Milestone     string
+	Search        string
+	Limit         int
+	NumberTitles  bool
+	NotifyWebhook string
+	Timeout       time.Duration
+	// FailFast stops the run at the first pull request that fails.
+	FailFast bool
+	// CommandTimeout is passed to cascade.SetCommandTimeout.
+	CommandTimeout time.Duration
+	NotifyFormat   string
+	ForceUnlock    bool
+	Autostash      bool
+	Theme          string
+	// Quiet prints nothing but what needs attention, see printAttention.
+	Quiet bool
+	// Numbers are the pull requests to process instead of those listed, given
+	// as arguments or, with Stdin, on standard input.
+	Numbers []int
+	Stdin   bool
+	// Current limits the run to the pull request of CurrentBranch, the
+	// branch checked out when the run started, and its descendants.
+	Current       bool
+	CurrentBranch string
+	// Prune deletes the local branches of merged dependencies once their
+	// dependents are rebased, and PruneRemote their remote branches too.
+	Prune       bool
+	PruneRemote bool
+	// UseCache and CacheTTL set up cascade.Options.Cache.
+	UseCache bool
+	CacheTTL time.Duration
+	// AuditLogPath sets up cascade.Options.AuditLog.
+	AuditLogPath string
+	// Record and Replay are directories to record the git, gh and shell
+	// commands of the run to, or to replay them from, see
+	// cascade.StartRecording. stopRecording stops recording to Record.
+	Record        string
+	Replay        string
+	stopRecording func() error
+	// Repository is the base repository, resolved after parsing.
+	Repository repository.Repository
+	// Template is Format, parsed.
+	Template *template.Template
+}
+
+// syncDefaults are the flags gh cascade sync turns on by default, the chores
+// recommended after a merge.
+var syncDefaults = []string{"push", "retarget", "update-body", "comment"}
+
+// parseOptions parses the command line, then fills in every flag that was not
+// given from the environment and the configuration files.
+func parseOptions(ctx context.Context, args []string) (*Options, error) {
+	return parseRunOptions(ctx, "", args)
+}
+
+// parseRunOptions is parseOptions for section, "" for gh cascade itself or
+// "sync" for gh cascade sync, which defaults to syncDefaults and is also
+// configured by its section of the configuration files.
+func parseRunOptions(ctx context.Context, section string, args []string) (*Options, error) {
+	opts := &Options{}
+	fs := flag.NewFlagSet(strings.TrimSpace("gh cascade "+section), flag.ContinueOnError)
+	fs.BoolVar(&opts.Push, "push", false, "force-push rebased branches")
+	fs.BoolVar(&opts.Retarget, "retarget", false, "base pushed pull requests on the branch they were rebased onto (requires --push)")
+	fs.BoolVar(&opts.Comment, "comment", false, "leave a comment on each rebased pull request (requires --push)")
+	fs.BoolVar(&opts.UpdateBody, "update-body", false, "strike through satisfied \"Depends on\" lines in rebased pull request bodies")
+	fs.BoolVar(&opts.Ready, "ready", false, "mark rebased draft pull requests as ready for review")
+	fs.Var((*AutoMergeFlag)(&opts.AutoMerge), "auto-merge", "enable auto-merge on rebased pull requests, optionally with a merge method: merge, squash or rebase (requires --push)")
+	fs.BoolVar(&opts.RequireChecks, "require-checks", false, "skip pull requests whose dependency's checks failed")
+	fs.BoolVar(&opts.Watch, "watch", false, "keep running and rebase pull requests as soon as their dependency merges")
+	fs.DurationVar(&opts.Interval, "interval", time.Minute, "how often to poll pull requests in --watch mode")
+	fs.DurationVar(&opts.Timeout, "timeout", 0, "stop rebasing once the run has taken this long, and report the pull requests left as failed (default: no limit)")
+	fs.BoolVar(&opts.FailFast, "fail-fast", false, "stop rebasing at the first pull request that fails to rebase or push, and skip those left")
+	fs.DurationVar(&opts.CommandTimeout, "command-timeout", 10*time.Minute, "how long a single git or gh command may run before it fails (0: no limit)")
+	fs.BoolVar(&opts.ForceUnlock, "force-unlock", false, "break the lock of another run, e.g. one that was killed")
+	fs.BoolVar(&opts.Autostash, "autostash", false, "stash uncommitted changes at the start and apply them back at the end, instead of refusing to run")
+	fs.BoolVar(&opts.CI, "ci", os.Getenv("GITHUB_ACTIONS") == "true", "run headless: authenticate with GH_TOKEN or GITHUB_TOKEN and write a GitHub Actions job summary")
+	fs.BoolVar(&opts.Verbose, "verbose", false, "log every git and gh command with its duration")
+	fs.BoolVar(&opts.Debug, "debug", false, "like --verbose, and also log the output of every command")
+	addPatternFlags(fs, &opts.Patterns, &opts.Keywords)
+	fs.Var(&opts.Authors, "author", "only process pull requests of this author (repeatable, default: @me)")
+	fs.BoolVar(&opts.AllAuthors, "all-authors", false, "process pull requests of every author")
+	fs.StringVar(&opts.Assignee, "assignee", "", "only process pull requests assigned to this user")
+	fs.Var(&opts.Labels, "label", "only process pull requests with this label (repeatable, all must match)")
+	fs.StringVar(&opts.Milestone, "milestone", "", "only process pull requests in the milestone with this title")
+	fs.StringVar(&opts.Search, "search", "", "only process pull requests matching this GitHub search query, e.g. \"head:feature/ -label:blocked\"")
+	fs.IntVar(&opts.Limit, "limit", 0, "process at most this many pull requests, newest first (default: all)")
+	fs.BoolVar(&opts.LinkedIssues, "linked-issues", false, "chain pull requests that declare no dependency after the pull request opened before them for the same linked issue")
+	fs.BoolVar(&opts.ScanComments, "scan-comments", false, "also look for dependencies in the comments and reviews of pull requests, the newest declaration replacing those before it")
+	fs.Var((*StringsFlag)(&opts.Exclude), "exclude", "glob of head branches to leave alone (repeatable)")
+	fs.StringVar(&opts.Output, "output", "text", "how to print the result: text, markdown for a table to paste into a tracking issue, or json")
+	fs.BoolVar(&opts.NoTitles, "no-titles", false, "leave the titles and diff stats of pull requests out of the result")
+	fs.BoolVar(&opts.ShowRangeDiff, "show-range-diff", false, "print the full git range-diff of each rebased pull request")
+	fs.BoolVar(&opts.FailOnSkip, "fail-on-skip", false, "exit with 2 if a pull request with a dependency was skipped")
+	fs.StringVar(&opts.Format, "format", "", "print each pull request with a Go template, e.g. '{{.Number}} {{.HeadRefName}} {{.Result}}'")
+	fs.StringVar(&opts.NotifyWebhook, "notify-webhook", "", "post a summary of the run to this webhook URL")
+	fs.StringVar(&opts.NotifyFormat, "notify-format", "slack", "payload of --notify-webhook: slack for a Slack-compatible message, or json")
+	fs.IntVar(&opts.ReportIssue, "report-issue", 0, "comment the result as a Markdown table on this issue")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "print the planned rebases and predicted conflicts without changing anything")
+	fs.StringVar(&opts.OnConflict, "on-conflict", cascade.OnConflictRebase, "what to do with pull requests predicted to conflict: rebase (and abort on conflict), skip them, or stop before rebasing anything")
+	fs.BoolVar(&opts.NumberTitles, "number-titles", false, "keep a [i/n] prefix with the position in their chain in the titles of pull requests")
+	fs.BoolVar(&opts.ClosedIssuesSatisfied, "closed-issues-satisfied", false, "treat a dependency on an issue as satisfied once the issue is closed, instead of skipping the pull request")
+	fs.BoolVar(&opts.RetargetClosed, "retarget-closed", false, "rebase pull requests whose dependency was closed without merging onto the default branch, dropping the dependency's commits")
+	fs.Var((*AssumeMergedFlag)(&opts.AssumeMerged), "assume-merged", "treat a dependency as merged, given as <number>[:<commit>], at the tip of the default branch unless a commit is given (repeatable)")
+	fs.StringVar(&opts.Verify, "verify", "", "shell command to run in the working tree after each rebase, e.g. 'go test ./...'; pull requests it fails for are not pushed")
+	fs.BoolVar(&opts.MetadataVerify, "metadata-verify", false, "run the verify command of the cascade block of a pull request instead of --verify, rather than ignoring it; only for repositories whose pull request authors are trusted")
+	fs.BoolVar(&opts.Submodules, "submodules", false, "update the submodules of pull requests recursively once they are checked out and rebased, for --verify and hooks")
+	fs.Var((*HooksFlag)(&opts.Hooks), "hook", "shell command to run for each pull request on an event, given as <event>=<command> with an event of pre_rebase, post_rebase, post_push or on_conflict (repeatable)")
+	fs.BoolVar(&opts.Rerere, "rerere", true, "resolve conflicts that have a recorded resolution (see git rerere) instead of aborting")
+	fs.BoolVar(&opts.SkipUnchanged, "skip-unchanged", true, "leave pull requests that conflicted or were rebased without --push in an earlier run until they, their dependency or what they are rebased onto change")
+	fs.StringVar(&opts.Strategy, "strategy", cascade.StrategyRebase, "how to move pull requests onto their new base: rebase, cherry-pick for their own commits onto a fresh branch, or merge-tree to replay them without a working tree (experimental)")
+	fs.BoolVar(&opts.RebaseMerges, "rebase-merges", false, "recreate the merge commits of pull requests when rebasing them, instead of skipping those pull requests")
+	fs.BoolVar(&opts.Sign, "sign", false, "sign rebased commits with the key git is configured with, as commit.gpgSign does")
+	fs.BoolVar(&opts.Autosquash, "autosquash", false, "fold fixup! and squash! commits into the commits they amend when rebasing")
+	fs.Var(&OntoFlag{&opts.Options}, "onto", "branch to rebase onto instead of the default branch, or <number>=<branch> for a single pull request (repeatable)")
+	fs.Var((*OntoMapFlag)(&opts.OntoCommits), "onto-map", "commit to rebase a pull request onto instead of its dependency's merge commit, given as <number>=<commit> (repeatable)")
+	addRemoteFlags(fs, &opts.FetchRemote, &opts.PushRemote)
+	addCacheFlags(fs, &opts.UseCache, &opts.CacheTTL)
+	fs.StringVar(&opts.AuditLogPath, "audit-log", "", "append a JSON line for every fetch, checkout, rebase, push, retarget and comment to this file")
+	addThemeFlag(fs, &opts.Theme)
+	fs.BoolVar(&opts.Quiet, "quiet", false, "print nothing but failures, warnings and errors, e.g. for cron jobs")
+	fs.BoolVar(&opts.Quiet, "q", false, "shorthand for --quiet")
+	fs.BoolVar(&opts.Current, "current", false, "only process the pull request of the checked out branch and those that depend on it")
+	fs.IntVar(&opts.MaxDepth, "max-depth", 0, "only rebase pull requests up to this many hops below a merged dependency in one run (default: no limit)")
+	fs.BoolVar(&opts.Stdin, "stdin", false, "process the pull requests whose numbers are read from standard input, as words or as the JSON of gh pr list --json number")
+	fs.BoolVar(&opts.Prune, "prune", false, "delete the local branches of merged dependencies once every pull request depending on them is rebased")
+	fs.BoolVar(&opts.PruneRemote, "prune-remote", false, "like --prune, and also delete their remote branches once the rebased pull requests are pushed (requires --push)")
+	fs.StringVar(&opts.Record, "record", "", "record every git, gh and shell command of the run, with its output and tokens redacted, to this directory, e.g. to attach to a bug report")
+	fs.StringVar(&opts.Replay, "replay", "", "answer every git, gh and shell command from a recording made with --record in this directory instead of running it")
+	if section == "sync" {
+		for _, name := range syncDefaults {
+			f := fs.Lookup(name)
+			_ = f.Value.Set("true")
+			f.DefValue = "true"
+		}
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+
+	for _, arg := range fs.Args() {
+		number, err := strconv.Atoi(strings.TrimPrefix(arg, "#"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pull request number %q", arg)
+		}
+		opts.Numbers = append(opts.Numbers, number)
+	}
+	// Recording starts before the first command, so that a run that fails
+	// to start is recorded too.
+	if err := startRecording(opts); err != nil {
+		return nil, err
+	}
+	if opts.Stdin {
+		numbers, err := readNumbers(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("read standard input: %w", err)
+		}
+		if len(numbers) == 0 {
+			return nil, errors.New("--stdin read no pull request numbers")
+		}
+		opts.Numbers = append(opts.Numbers, numbers...)
+	}
+
+	if err := cascade.Preflight(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := applyDefaults(ctx, fs, section); err != nil {
+		return nil, err
+	}
+	// gh cascade sync --push=false rebases locally, without the chores that
+	// need a push, unless they are asked for.
+	if section == "sync" && !opts.Push {
+		given := map[string]bool{}
+		fs.Visit(func(f *flag.Flag) {
+			given[f.Name] = true
+		})
+		opts.Comment = opts.Comment && given["comment"]
+		opts.Retarget = opts.Retarget && given["retarget"]
+	}
+
+	if opts.Comment && !opts.Push {
+		return nil, errors.New("--comment requires --push")
+	}
+	if opts.Retarget && !opts.Push {
+		return nil, errors.New("--retarget requires --push")
+	}
+	if opts.PruneRemote && !opts.Push {
+		return nil, errors.New("--prune-remote requires --push")
+	}
+	opts.Prune = opts.Prune || opts.PruneRemote
+	if opts.AutoMerge != "" && !opts.Push {
+		return nil, errors.New("--auto-merge requires --push")
+	}
+	if opts.Limit < 0 {
+		return nil, errors.New("--limit must not be negative")
+	}
+	if opts.AllAuthors && len(opts.Authors) > 0 {
+		return nil, errors.New("--author cannot be used with --all-authors")
+	}
+	if opts.Current && len(opts.Numbers) > 0 {
+		return nil, errors.New("--current cannot be used with pull request numbers or --stdin")
+	}
+	// The branch checked out is needed back at the end of the run, so it is
+	// never pruned.
+	if opts.Current || opts.Prune {
+		var err error
+		if opts.CurrentBranch, err = cascade.GetCurrentRef(ctx); err != nil {
+			return nil, fmt.Errorf("resolve current branch: %w", err)
+		}
+	}
+	if opts.DryRun && opts.Watch {
+		return nil, errors.New("--dry-run cannot be used with --watch")
+	}
+	if opts.Timeout < 0 || opts.CommandTimeout < 0 || opts.CacheTTL < 0 {
+		return nil, errors.New("--timeout, --command-timeout and --cache-ttl must not be negative")
+	}
+	if opts.MaxDepth < 0 {
+		return nil, errors.New("--max-depth must not be negative")
+	}
+	if opts.Timeout > 0 && opts.Watch {
+		return nil, errors.New("--timeout cannot be used with --watch")
+	}
+	if opts.FailFast && opts.Watch {
+		return nil, errors.New("--fail-fast cannot be used with --watch")
+	}
+	cascade.SetCommandTimeout(opts.CommandTimeout)
+	switch opts.NotifyFormat {
+	case "slack", "json":
+	default:
+		return nil, fmt.Errorf("invalid --notify-format %q: must be one of slack, json", opts.NotifyFormat)
+	}
+	if err := applyTheme(opts.Theme); err != nil {
+		return nil, err
+	}
+	switch opts.Output {
+	case "text", "markdown", "json":
+	default:
+		return nil, fmt.Errorf("invalid --output %q: must be one of text, markdown, json", opts.Output)
+	}
+	if opts.Format != "" {
+		var err error
+		if opts.Template, err = template.New("format").Parse(opts.Format); err != nil {
+			return nil, fmt.Errorf("invalid --format: %w", err)
+		}
+	}
+	switch opts.OnConflict {
+	case cascade.OnConflictRebase, cascade.OnConflictSkip, cascade.OnConflictStop:
+	default:
+		return nil, fmt.Errorf("invalid --on-conflict %q: must be one of rebase, skip, stop", opts.OnConflict)
+	}
+	switch opts.Strategy {
+	case cascade.StrategyRebase, cascade.StrategyCherryPick, cascade.StrategyMergeTree:
+	default:
+		return nil, fmt.Errorf("invalid --strategy %q: must be one of rebase, cherry-pick, merge-tree", opts.Strategy)
+	}
+	if opts.Autosquash && opts.Strategy == cascade.StrategyCherryPick {
+		return nil, errors.New("--autosquash requires --strategy rebase or merge-tree")
+	}
+
+	// Watch mode has no run to stop, so it skips instead.
+	if opts.Watch && opts.OnConflict == cascade.OnConflictStop {
+		opts.OnConflict = cascade.OnConflictSkip
+	}
+	// Watch mode follows dependencies through the merge queue.
+	opts.CheckMergeQueue = opts.Watch
+	opts.PredictConflicts = opts.DryRun
+
+	// Fail before rebasing anything rather than on the first commit.
+	if !opts.DryRun {
+		if _, err := cascade.CheckSigning(ctx, opts.Sign); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := installDependOnPatterns(opts.Patterns, opts.Keywords); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if opts.Repository, err = cascade.SetupRepository(ctx, &opts.FetchRemote, &opts.PushRemote); err != nil {
+		return nil, err
+	}
+	// A cached pull request is not fetched, so it could not be replayed.
+	if opts.UseCache && opts.Record == "" && opts.Replay == "" {
+		if opts.Cache, err = newCache(opts.Repository, opts.CacheTTL); err != nil {
+			return nil, err
+		}
+	}
+
+	return opts, nil
+}
+
+// startRecording starts recording to or replaying from the directory given
+// with --record or --replay, if any.
+func startRecording(opts *Options) error {
+	switch {
+	case opts.Record != "" && opts.Replay != "":
+		return errors.New("--record cannot be used with --replay")
+	case opts.Record != "":
+		var err error
+		if opts.stopRecording, err = cascade.StartRecording(opts.Record); err != nil {
+			return fmt.Errorf("--record: %w", err)
+		}
+	case opts.Replay != "":
+		if err := cascade.StartReplay(opts.Replay); err != nil {
+			return fmt.Errorf("--replay: %w", err)
+		}
+	}
+	return nil
+}
+
+func addRemoteFlags(fs *flag.FlagSet, fetchRemote, pushRemote *string) {
+	fs.StringVar(fetchRemote, "fetch-remote", "", "remote to fetch base branches from (default: the remote of the base repository)")
+	fs.StringVar(pushRemote, "push-remote", "", "remote to push rebased branches to (default: the remote of your fork, if any, else --fetch-remote)")
+	// Setting the flags rather than the options marks them as given, so that
+	// the configuration does not override them either, while those given
+	// explicitly, before or after, win.
+	fs.Func("remote", "remote to fetch from and push to, unless --fetch-remote or --push-remote is given", func(name string) error {
+		given := map[string]bool{}
+		fs.Visit(func(f *flag.Flag) {
+			given[f.Name] = true
+		})
+		for _, flagName := range []string{"fetch-remote", "push-remote"} {
+			if !given[flagName] {
+				if err := fs.Set(flagName, name); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// readNumbers reads pull request numbers separated by white space, or the
+// JSON array of objects with a number printed by gh pr list --json number.
+func readNumbers(r io.Reader) ([]int, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var numbers []int
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var pullRequests []struct {
+			Number int `json:"number"`
+		}
+		if err = json.Unmarshal(trimmed, &pullRequests); err != nil {
+			return nil, err
+		}
+		for _, pr := range pullRequests {
+			numbers = append(numbers, pr.Number)
+		}
+		return numbers, nil
+	}
+
+	for _, word := range strings.Fields(string(data)) {
+		number, err := strconv.Atoi(strings.TrimPrefix(word, "#"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pull request number %q", word)
+		}
+		numbers = append(numbers, number)
+	}
+	return numbers, nil
+}
+
+func addCacheFlags(fs *flag.FlagSet, useCache *bool, ttl *time.Duration) {
+	fs.BoolVar(useCache, "cache", true, "keep the dependencies looked up in ~/.cache/gh-cascade between runs")
+	fs.DurationVar(ttl, "cache-ttl", time.Minute, "how long to keep open and closed dependencies in the cache, which keeps merged ones for good")
+}
+
+func addPatternFlags(fs *flag.FlagSet, patterns, keywords *StringsFlag) {
+	fs.Var(patterns, "pattern", "regular expression declaring a dependency, capturing the pull request number (repeatable)")
+	fs.Var(keywords, "keyword", "phrase declaring a dependency when followed by a pull request reference, e.g. \"Blocked by\" (repeatable)")
+}
+
+// installDependOnPatterns replaces the default dependency pattern when any
+// pattern or keyword was configured.
+func installDependOnPatterns(patterns, keywords []string) error {
+	if len(patterns) == 0 && len(keywords) == 0 {
+		return nil
+	}
+
+	compiled, err := cascade.CompileDependOnPatterns(patterns, keywords)
+	if err != nil {
+		return err
+	}
+	cascade.SetDependOnPatterns(compiled)
+
+	return nil
+}
+
+var _ flag.Value = (*AutoMergeFlag)(nil)
+
+// AutoMergeFlag holds the merge method used for auto-merge. It may be given
+// without a value, in which case the merge method defaults to "merge".
+type AutoMergeFlag string
+
+func (a *AutoMergeFlag) String() string {
+	return string(*a)
+}
+
+func (a *AutoMergeFlag) Set(s string) error {
+	switch s {
+	case "true":
+		*a = "merge"
+	case "false":
+		*a = ""
+	case "merge", "squash", "rebase":
+		*a = AutoMergeFlag(s)
+	default:
+		return fmt.Errorf("invalid merge method %q: must be one of merge, squash, rebase", s)
+	}
+	return nil
+}
+
+func (a *AutoMergeFlag) IsBoolFlag() bool {
+	return true
+}
+
+// errReported is returned for errors that have already been printed.
+var errReported = errors.New("error already reported")
+
+// parseFlags parses args with fs. The flag package prints parse errors along
+// with the usage itself, so they are returned as errReported. While
+// completing, it returns fs in a *completingError instead, see flagSetOf.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if completing {
+		return &completingError{fs: fs}
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errReported
+	}
+	return nil
+}
+
+// PullRequestFilter returns the filter that selects the pull requests to
+// process.
+func (o *Options) PullRequestFilter() cascade.PullRequestFilter {
+	filter := cascade.PullRequestFilter{Assignee: o.Assignee, Labels: o.Labels, Milestone: o.Milestone, Search: o.Search, Limit: o.Limit}
+	switch {
+	case o.AllAuthors:
+	case len(o.Authors) > 0:
+		filter.Authors = o.Authors
+	default:
+		filter.Authors = []string{"@me"}
+	}
+	return filter
+}
+
+// AssumeMergedFlag maps pull requests to the commit they are assumed to be
+// merged at. It is set from "<number>" or "<number>:<commit>"; a missing
+// commit stands for the tip of the default branch.
+type AssumeMergedFlag map[int]string
+
+func (a *AssumeMergedFlag) String() string {
+	if a == nil {
+		return ""
+	}
+
+	numbers := make([]int, 0, len(*a))
+	for number := range *a {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+
+	values := make([]string, 0, len(numbers))
+	for _, number := range numbers {
+		value := strconv.Itoa(number)
+		if oid := (*a)[number]; oid != "" {
+			value += ":" + oid
+		}
+		values = append(values, value)
+	}
+	return strings.Join(values, ",")
+}
+
+func (a *AssumeMergedFlag) Set(value string) error {
+	numberValue, oid, _ := strings.Cut(value, ":")
+	number, err := strconv.Atoi(strings.TrimPrefix(numberValue, "#"))
+	if err != nil {
+		return fmt.Errorf("invalid pull request number %q", numberValue)
+	}
+
+	if *a == nil {
+		*a = AssumeMergedFlag{}
+	}
+	(*a)[number] = oid
+	return nil
+}
+
+// HooksFlag maps hook events to the shell command to run on them. It is set
+// from "<event>=<command>".
+type HooksFlag map[string]string
+
+func (h *HooksFlag) String() string {
+	if h == nil {
+		return ""
+	}
+
+	values := make([]string, 0, len(*h))
+	for _, event := range cascade.HookEvents {
+		if command, ok := (*h)[event]; ok {
+			values = append(values, event+"="+command)
+		}
+	}
+	return strings.Join(values, ",")
+}
+
+func (h *HooksFlag) Set(value string) error {
+	event, command, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("invalid hook %q: must be <event>=<command>", value)
+	}
+	if !slices.Contains(cascade.HookEvents, event) {
+		return fmt.Errorf("invalid hook event %q: must be one of %s", event, strings.Join(cascade.HookEvents, ", "))
+	}
+
+	if *h == nil {
+		*h = HooksFlag{}
+	}
+	(*h)[event] = command
+	return nil
+}
+
+// OntoFlag sets the branch every pull request is rebased onto from
+// "<branch>", and the branch of a single pull request from
+// "<number>=<branch>".
+type OntoFlag struct {
+	opts *cascade.Options
+}
+
+func (o *OntoFlag) String() string {
+	if o == nil || o.opts == nil {
+		return ""
+	}
+
+	var values []string
+	if o.opts.Onto != "" {
+		values = append(values, o.opts.Onto)
+	}
+	numbers := make([]int, 0, len(o.opts.OntoPullRequests))
+	for number := range o.opts.OntoPullRequests {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	for _, number := range numbers {
+		values = append(values, strconv.Itoa(number)+"="+o.opts.OntoPullRequests[number])
+	}
+	return strings.Join(values, ",")
+}
+
+func (o *OntoFlag) Set(value string) error {
+	numberValue, branch, ok := strings.Cut(value, "=")
+	if !ok {
+		if value == "" {
+			return errors.New("branch to rebase onto must not be empty")
+		}
+		o.opts.Onto = value
+		return nil
+	}
+
+	number, err := strconv.Atoi(strings.TrimPrefix(numberValue, "#"))
+	if err != nil {
+		return fmt.Errorf("invalid pull request number %q", numberValue)
+	}
+	if branch == "" {
+		return fmt.Errorf("branch to rebase #%d onto must not be empty", number)
+	}
+	if o.opts.OntoPullRequests == nil {
+		o.opts.OntoPullRequests = map[int]string{}
+	}
+	o.opts.OntoPullRequests[number] = branch
+	return nil
+}
+
+// OntoMapFlag maps pull requests to the commit they are rebased onto. It is
+// set from "<number>=<commit>".
+type OntoMapFlag map[int]string
+
+func (o *OntoMapFlag) String() string {
+	if o == nil {
+		return ""
+	}
+
+	numbers := make([]int, 0, len(*o))
+	for number := range *o {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+
+	values := make([]string, 0, len(numbers))
+	for _, number := range numbers {
+		values = append(values, strconv.Itoa(number)+"="+(*o)[number])
+	}
+	return strings.Join(values, ",")
+}
+
+func (o *OntoMapFlag) Set(value string) error {
+	numberValue, commit, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("invalid commit to rebase onto %q: must be <number>=<commit>", value)
+	}
+	number, err := strconv.Atoi(strings.TrimPrefix(numberValue, "#"))
+	if err != nil {
+		return fmt.Errorf("invalid pull request number %q", numberValue)
+	}
+	if commit == "" {
+		return fmt.Errorf("commit to rebase #%d onto must not be empty", number)
+	}
+
+	if *o == nil {
+		*o = OntoMapFlag{}
+	}
+	(*o)[number] = commit
+	return nil
+}
+
+var _ flag.Value = (*StringsFlag)(nil)
+
+// StringsFlag collects the values of a flag that may be given more than once.
+type StringsFlag []string
+
+func (s *StringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *StringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
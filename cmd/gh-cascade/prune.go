@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/134130/gh-cascade/pkg/cascade"
+	"github.com/fatih/color"
+)
+
+// prune deletes the branches of the merged dependencies that no pull request
+// of the run needs anymore, and prints what it deleted. The branch checked out
+// when the run started is kept, as it is checked back out at the end.
+func prune(ctx context.Context, opts *Options, processedPullRequests []cascade.ProcessedPullRequest) {
+	dependencies, remoteDone := cascade.Prunable(processedPullRequests)
+	for _, dependency := range dependencies {
+		branch := dependency.HeadRefName
+		number := blue(fmt.Sprintf("#%d", dependency.Number))
+		if branch == opts.CurrentBranch {
+			fmt.Fprintf(color.Output, "%s Kept %s of %s %s\n", hiYellow("!"), bold(branch), number, hiBlack("(checked out)"))
+			continue
+		}
+
+		if existed, err := cascade.DeleteBranch(ctx, branch, dependency.HeadRefOid); err != nil {
+			fmt.Fprintf(color.Output, "%s Kept %s of %s %s\n", hiYellow("!"), bold(branch), number, hiBlack(err))
+			continue
+		} else if existed {
+			fmt.Fprintf(color.Output, "%s Deleted %s of %s\n", green("✔"), bold(branch), number)
+		}
+
+		if !opts.PruneRemote || dependency.IsCrossRepository {
+			continue
+		}
+		if !remoteDone[dependency.Number] {
+			fmt.Fprintf(color.Output, "%s Kept %s/%s of %s %s\n", hiYellow("!"), opts.PushRemote, bold(branch), number, hiBlack("(a pull request depending on it was not pushed or retargeted)"))
+			continue
+		}
+		if existed, err := cascade.DeleteRemoteBranch(ctx, opts.PushRemote, branch, dependency.HeadRefOid); err != nil {
+			fmt.Fprintf(color.Output, "%s Kept %s/%s of %s %s\n", hiYellow("!"), opts.PushRemote, bold(branch), number, hiBlack(err))
+		} else if existed {
+			fmt.Fprintf(color.Output, "%s Deleted %s/%s of %s\n", green("✔"), opts.PushRemote, bold(branch), number)
+		}
+	}
+}
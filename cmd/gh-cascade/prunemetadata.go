@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/134130/gh-cascade/pkg/cascade"
+	"github.com/cli/go-gh/v2/pkg/term"
+	"github.com/fatih/color"
+)
+
+type PruneMetadataOptions struct {
+	OlderThan   time.Duration
+	Annotate    bool
+	Yes         bool
+	DryRun      bool
+	Verbose     bool
+	Debug       bool
+	Authors     StringsFlag
+	AllAuthors  bool
+	Patterns    StringsFlag
+	Keywords    StringsFlag
+	FetchRemote string
+	PushRemote  string
+}
+
+// staleDependOn is a dependency declaration of an open pull request on one
+// merged or closed for longer than --older-than.
+type staleDependOn struct {
+	PullRequest cascade.PullRequest
+	Dependency  *cascade.PullRequest
+}
+
+func parsePruneMetadataOptions(ctx context.Context, args []string) (*PruneMetadataOptions, error) {
+	opts := &PruneMetadataOptions{}
+	fs := flag.NewFlagSet("prune-metadata", flag.ContinueOnError)
+	fs.DurationVar(&opts.OlderThan, "older-than", 30*24*time.Hour, "only clean up references to pull requests merged or closed longer ago than this")
+	fs.BoolVar(&opts.Annotate, "annotate", false, "strike through the references and annotate them as merged or closed instead of removing them")
+	fs.BoolVar(&opts.Yes, "yes", false, "update the pull request bodies without asking for confirmation")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "print the stale references without updating anything")
+	fs.BoolVar(&opts.Verbose, "verbose", false, "log every git and gh command with its duration")
+	fs.BoolVar(&opts.Debug, "debug", false, "like --verbose, and also log the output of every command")
+	fs.Var(&opts.Authors, "author", "only clean up pull requests of this author (repeatable, default: @me)")
+	fs.BoolVar(&opts.AllAuthors, "all-authors", false, "clean up pull requests of every author")
+	addPatternFlags(fs, &opts.Patterns, &opts.Keywords)
+	addRemoteFlags(fs, &opts.FetchRemote, &opts.PushRemote)
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+
+	if err := cascade.Preflight(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := applyDefaults(ctx, fs, "prune-metadata"); err != nil {
+		return nil, err
+	}
+
+	if opts.AllAuthors && len(opts.Authors) > 0 {
+		return nil, errors.New("--author cannot be used with --all-authors")
+	}
+	if opts.OlderThan < 0 {
+		return nil, errors.New("--older-than must not be negative")
+	}
+	if !opts.Yes && !opts.DryRun && !term.IsTerminal(os.Stdin) {
+		return nil, errors.New("--yes or --dry-run is required when not running in a terminal")
+	}
+
+	if err := installDependOnPatterns(opts.Patterns, opts.Keywords); err != nil {
+		return nil, err
+	}
+
+	if _, err := cascade.SetupRepository(ctx, &opts.FetchRemote, &opts.PushRemote); err != nil {
+		return nil, err
+	}
+
+	return opts, nil
+}
+
+// PullRequestFilter returns the filter that selects the pull requests to
+// clean up.
+func (o *PruneMetadataOptions) PullRequestFilter() cascade.PullRequestFilter {
+	return (&Options{Authors: o.Authors, AllAuthors: o.AllAuthors}).PullRequestFilter()
+}
+
+// runPruneMetadata removes, or with --annotate strikes through, the
+// dependency declarations of open pull requests on pull requests merged or
+// closed long ago, which are otherwise reported as skipped on every run.
+func runPruneMetadata(args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts, err := parsePruneMetadataOptions(ctx, args)
+	if err != nil {
+		return reportOptionsError(err)
+	}
+
+	setupLogging(opts.Verbose, opts.Debug)
+
+	sp := newSpinner()
+	sp.Suffix = " Looking up dependencies..."
+	sp.Start()
+	stale, err := findStaleDependOns(ctx, opts)
+	sp.Stop()
+	if err != nil {
+		fmt.Fprintln(color.Error, red("error:"), err)
+		return errorCode(ctx)
+	}
+
+	if len(stale) == 0 {
+		fmt.Fprintf(color.Output, "%s%s\n", green("✔"), " No stale dependencies found.")
+		return exitNothingToDo
+	}
+
+	for _, s := range stale {
+		fmt.Fprintf(color.Output, "%s %s %s Depends on: #%d %s\n",
+			blue(fmt.Sprintf("#%d", s.PullRequest.Number)), s.PullRequest.HeadRefName, hiBlack("→"), s.Dependency.Number,
+			hiBlack(fmt.Sprintf("%s %s", strings.ToLower(s.Dependency.State), s.Dependency.ClosedAt.Local().Format(time.DateOnly))))
+	}
+
+	if opts.DryRun {
+		return exitOK
+	}
+	if !opts.Yes {
+		action := "Remove"
+		if opts.Annotate {
+			action = "Annotate"
+		}
+		fmt.Fprintf(color.Output, "%s these %d dependencies? [y/N] ", action, len(stale))
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			return exitOK
+		}
+	}
+
+	bodies := map[int]string{}
+	var numbers []int
+	for _, s := range stale {
+		number := s.PullRequest.Number
+		body, ok := bodies[number]
+		if !ok {
+			body = s.PullRequest.Body
+			numbers = append(numbers, number)
+		}
+		switch {
+		case !opts.Annotate:
+			body, _ = cascade.RemoveDependOn(body, s.Dependency.Number)
+		case s.Dependency.State == "MERGED":
+			body, _ = cascade.MarkDependencySatisfied(body, s.Dependency.Number)
+		default:
+			body, _ = cascade.MarkDependencyClosed(body, s.Dependency.Number)
+		}
+		bodies[number] = body
+	}
+
+	code := exitOK
+	for _, number := range numbers {
+		if err := cascade.UpdatePullRequestBody(ctx, number, bodies[number]); err != nil {
+			fmt.Fprintln(color.Error, red("x"), fmt.Errorf("#%d: %w", number, err))
+			code = exitFailed
+			continue
+		}
+		fmt.Fprintf(color.Output, "%s Updated #%d\n", green("✔"), number)
+	}
+
+	return code
+}
+
+// findStaleDependOns returns the stale dependency declarations of the pull
+// requests selected by opts, ordered by pull request. Struck through
+// declarations are only stale when they are to be removed, as annotating them
+// again would change nothing.
+func findStaleDependOns(ctx context.Context, opts *PruneMetadataOptions) ([]staleDependOn, error) {
+	pullRequests, err := cascade.ListPullRequests(ctx, opts.PullRequestFilter())
+	if err != nil {
+		return nil, fmt.Errorf("list pull requests: %w", err)
+	}
+	sort.Slice(pullRequests, func(i, j int) bool {
+		return pullRequests[i].Number < pullRequests[j].Number
+	})
+
+	cutoff := time.Now().Add(-opts.OlderThan)
+	dependencies := map[int]*cascade.PullRequest{}
+	var stale []staleDependOn
+	for _, pr := range pullRequests {
+		for _, number := range cascade.ParseBodyDependOns(pr.Body) {
+			dependency, ok := dependencies[number]
+			if !ok {
+				if dependency, err = cascade.GetPullRequest(ctx, number); err != nil {
+					return nil, fmt.Errorf("get PR #%d: %w", number, err)
+				}
+				dependencies[number] = dependency
+			}
+
+			if dependency.State == "OPEN" || dependency.ClosedAt.After(cutoff) {
+				continue
+			}
+			if opts.Annotate {
+				if _, changed := cascade.MarkDependencySatisfied(pr.Body, number); !changed {
+					continue
+				}
+			}
+			stale = append(stale, staleDependOn{PullRequest: pr, Dependency: dependency})
+		}
+	}
+
+	return stale, nil
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/134130/gh-cascade/pkg/cascade"
+	"github.com/cli/go-gh/v2/pkg/term"
+	"github.com/cli/go-gh/v2/pkg/text"
+	"github.com/fatih/color"
+)
+
+// printReport prints the result of a run.
+func printReport(processedPullRequests []cascade.ProcessedPullRequest, opts *Options) {
+	printPullRequests("Pull requests", false, processedPullRequests, opts)
+}
+
+// printPlan prints the pull requests a run would rebase, with their predicted
+// conflicts, and those it would leave alone.
+func printPlan(plan []cascade.ProcessedPullRequest, opts *Options) {
+	printPullRequests("Planned rebases", true, plan, opts)
+}
+
+// printPullRequests prints the pull requests to be or that have been rebased,
+// under heading, as one tree per chain: each pull request is shown below the
+// one it depends on, and each chain below the branch it is based on, so that
+// the new state of a stack reads at a glance. A dependency that is not among
+// processedPullRequests, such as one that merged, is shown at the root of its
+// chain. Unless --no-titles is set, each pull request is followed by its
+// title and diff stats.
+func printPullRequests(heading string, planned bool, processedPullRequests []cascade.ProcessedPullRequest, opts *Options) {
+	lineWidth := terminalWidth()
+	width := 0
+	if !opts.NoTitles {
+		width = lineWidth
+	}
+
+	index := map[int]int{}
+	for i, pr := range processedPullRequests {
+		index[pr.Number] = i
+	}
+	children := map[int][]int{}
+	var roots []int
+	for i, pr := range processedPullRequests {
+		if dependency := pr.DependedPullRequest; dependency != nil && dependency.Number != pr.Number {
+			if _, ok := index[dependency.Number]; ok {
+				children[dependency.Number] = append(children[dependency.Number], i)
+				continue
+			}
+		}
+		roots = append(roots, i)
+	}
+
+	printed := map[int]bool{}
+	var printNode func(i, depth int)
+	printNode = func(i, depth int) {
+		pr := processedPullRequests[i]
+		if printed[pr.Number] {
+			return
+		}
+		printed[pr.Number] = true
+
+		indent := 2 + 3*depth
+		printPullRequestLine(pr.PullRequest, indent, lineWidth, width, opts.NoTitles)
+		printResult(pr, planned, indent+6, opts)
+		for _, child := range children[pr.Number] {
+			printNode(child, depth+1)
+		}
+	}
+
+	// Roots are grouped by the branch they are based on, and those depending
+	// on the same dependency printed below it together.
+	type group struct {
+		dependency *cascade.PullRequest
+		roots      []int
+	}
+	var bases []string
+	groupsOf := map[string][]*group{}
+	for _, i := range roots {
+		pr := processedPullRequests[i]
+		base := pr.Base
+		if base == "" {
+			base = pr.BaseRefName
+		}
+		if _, ok := groupsOf[base]; !ok {
+			bases = append(bases, base)
+		}
+
+		dependency := pr.DependedPullRequest
+		if dependency != nil && dependency.Number == pr.Number {
+			dependency = nil
+		}
+		var g *group
+		for _, existing := range groupsOf[base] {
+			if dependency != nil && existing.dependency != nil && existing.dependency.Number == dependency.Number {
+				g = existing
+			}
+		}
+		if g == nil {
+			g = &group{dependency: dependency}
+			groupsOf[base] = append(groupsOf[base], g)
+		}
+		g.roots = append(g.roots, i)
+	}
+
+	fmt.Fprintf(color.Output, "\n%s\n", bold(heading))
+	for _, base := range bases {
+		fmt.Fprintf(color.Output, "  %s\n", white(base))
+		for _, g := range groupsOf[base] {
+			depth := 0
+			if g.dependency != nil {
+				printPullRequestLine(*g.dependency, 2, lineWidth, width, opts.NoTitles)
+				depth = 1
+			}
+			for _, i := range g.roots {
+				printNode(i, depth)
+			}
+		}
+	}
+
+	// Pull requests in a dependency cycle have no root to be printed below.
+	for i, pr := range processedPullRequests {
+		if !printed[pr.Number] {
+			printNode(i, 0)
+		}
+	}
+}
+
+// printPullRequestLine prints the line of a pull request in the tree at
+// indent, followed by its title unless noTitles is set.
+func printPullRequestLine(pr cascade.PullRequest, indent, lineWidth, titleWidth int, noTitles bool) {
+	colorFn := color.New(getColor(pr)).SprintFunc()
+	fmt.Fprintf(color.Output, "%s└─ %s\n", strings.Repeat(" ", indent), formatLine(pr, colorFn, lineWidth-indent-3))
+	if !noTitles {
+		fmt.Fprintf(color.Output, "%s%s\n", strings.Repeat(" ", indent+6), formatTitle(pr, titleWidth-indent-6))
+	}
+}
+
+// printResult prints what was done with a pull request, or is planned to be
+// with planned, at indent.
+func printResult(pr cascade.ProcessedPullRequest, planned bool, indent int, opts *Options) {
+	pad := strings.Repeat(" ", indent)
+	switch {
+	case pr.Result() == cascade.ResultSkipped:
+		fmt.Fprintf(color.Output, "%s%s\n", pad, hiYellow(resultLabel(pr), pr.Error))
+	case pr.Error != nil:
+		fmt.Fprintf(color.Output, "%s%s\n", pad, red(resultLabel(pr), pr.Error))
+	case planned:
+		fmt.Fprintf(color.Output, "%s%s\n", pad, hiBlack("→ to be rebased onto ", pr.Base))
+	default:
+		fmt.Fprintf(color.Output, "%s%s %s\n", pad, green("✔"), "rebased onto "+pr.Base)
+	}
+
+	if len(pr.Conflicts) > 0 {
+		fmt.Fprintf(color.Output, "%s%s\n", pad, hiYellow("predicted to conflict in "+strings.Join(pr.Conflicts, ", ")))
+	}
+	if pr.RangeDiff != nil {
+		if pr.RangeDiff.Changed() {
+			fmt.Fprintf(color.Output, "%s%s\n", pad, hiYellow(pr.RangeDiff))
+		} else {
+			fmt.Fprintf(color.Output, "%s%s\n", pad, hiBlack(pr.RangeDiff))
+		}
+		for _, commit := range pr.RangeDiff.DroppedCommits {
+			fmt.Fprintf(color.Output, "%s  %s\n", pad, hiBlack("dropped "+commit))
+		}
+		if opts.ShowRangeDiff {
+			fmt.Fprint(color.Output, text.Indent(pr.RangeDiff.Output, pad+"    "))
+		}
+	}
+	for _, warning := range pr.Warnings {
+		fmt.Fprintf(color.Output, "%s%s\n", pad, hiYellow(warning))
+	}
+}
+
+// printAttention prints a line to stderr for each pull request that failed,
+// or was skipped with --fail-on-skip, and for each warning, which is all that
+// --quiet prints of the result.
+func printAttention(processedPullRequests []cascade.ProcessedPullRequest, opts *Options) {
+	for _, pr := range processedPullRequests {
+		switch pr.Result() {
+		case cascade.ResultFailed:
+			fmt.Fprintf(color.Error, "%s #%d %s: %s\n", red("x"), pr.Number, pr.HeadRefName, pr.Error)
+		case cascade.ResultSkipped:
+			if opts.FailOnSkip && pr.Error != cascade.ErrNoDependOn && pr.Error != cascade.ErrUpToDate {
+				fmt.Fprintf(color.Error, "%s #%d %s: %s\n", hiYellow("!"), pr.Number, pr.HeadRefName, pr.Error)
+			}
+		}
+		for _, warning := range pr.Warnings {
+			fmt.Fprintf(color.Error, "%s #%d %s: %s\n", hiYellow("!"), pr.Number, pr.HeadRefName, warning)
+		}
+	}
+}
+
+// formatSummary renders the one-line summary that ends a run: how many pull
+// requests were rebased and pushed, skipped and why, and failed, along with
+// how long the run took. Counts of zero are left out.
+func formatSummary(processedPullRequests []cascade.ProcessedPullRequest, elapsed time.Duration) string {
+	var rebased, pushed, upToDate, skipped, noDependOn, conflicts, failed int
+	for _, pr := range processedPullRequests {
+		switch {
+		case pr.Error == nil:
+			rebased++
+		case pr.Error == cascade.ErrNoDependOn:
+			noDependOn++
+		case pr.Error == cascade.ErrUpToDate:
+			upToDate++
+		case pr.Result() == cascade.ResultSkipped:
+			skipped++
+		case errors.Is(pr.Error, cascade.ErrRebaseConflict):
+			conflicts++
+		default:
+			failed++
+		}
+		if pr.Pushed {
+			pushed++
+		}
+	}
+
+	var parts []string
+	for _, count := range []struct {
+		n    int
+		text string
+	}{
+		{rebased, fmt.Sprintf("%d rebased", rebased)},
+		{pushed, fmt.Sprintf("%d pushed", pushed)},
+		{upToDate, fmt.Sprintf("%d up to date", upToDate)},
+		{skipped, fmt.Sprintf("%d skipped", skipped)},
+		{noDependOn, fmt.Sprintf("%d skipped (no dependency)", noDependOn)},
+		{conflicts, text.Pluralize(conflicts, "conflict")},
+		{failed, text.Pluralize(failed, "error")},
+	} {
+		if count.n > 0 {
+			parts = append(parts, count.text)
+		}
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "nothing processed")
+	}
+
+	return fmt.Sprintf("%s in %s", strings.Join(parts, ", "), elapsed.Round(time.Second))
+}
+
+// formatLine renders the number of a pull request, linked to it, followed by
+// its URL and its status, truncating the URL to fit in width if it is
+// positive.
+func formatLine(pr cascade.PullRequest, colorFn func(a ...interface{}) string, width int) string {
+	number := formatNumber(pr, colorFn) + " " + stateLabel(pr)
+	status := formatStatus(pr)
+	url := pr.URL
+	if width > 0 {
+		numberWidth := max(len(fmt.Sprintf("#%d", pr.Number)), 5) + 1
+		url = text.Truncate(max(width-numberWidth-text.DisplayWidth(stateLabel(pr)+status), 0), url)
+	}
+	return number + url + status
+}
+
+// formatNumber renders the number of a pull request padded to five columns,
+// as a hyperlink to it where the terminal supports them.
+func formatNumber(pr cascade.PullRequest, colorFn func(a ...interface{}) string) string {
+	number := fmt.Sprintf("#%d", pr.Number)
+	return colorFn(hyperlink(pr.URL, number)) + strings.Repeat(" ", max(5-len(number), 0))
+}
+
+// formatTitle renders the title of a pull request followed by its diff stats
+// and commit count, truncating the title to fit in width if it is positive.
+func formatTitle(pr cascade.PullRequest, width int) string {
+	stats := fmt.Sprintf(" %s %s %s", green(fmt.Sprintf("+%d", pr.Additions)), red(fmt.Sprintf("-%d", pr.Deletions)), hiBlack(text.Pluralize(len(pr.Commits), "commit")))
+	title := pr.Title
+	if width > 0 {
+		title = text.Truncate(max(width-text.DisplayWidth(stats), 0), title)
+	}
+	return title + stats
+}
+
+// terminalWidth returns the width of the terminal, or 0 if the output is not
+// a terminal.
+func terminalWidth() int {
+	width, _, err := term.FromEnv().Size()
+	if err != nil || width <= 0 {
+		return 0
+	}
+	return width
+}
+
+// countConflicts returns how many pull requests to be rebased are predicted
+// to conflict.
+func countConflicts(plan []cascade.ProcessedPullRequest) int {
+	n := 0
+	for _, pr := range plan {
+		if pr.Error == nil && len(pr.Conflicts) > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func getColor(pullRequest cascade.PullRequest) color.Attribute {
+	state := pullRequest.State
+	if state == "OPEN" && pullRequest.IsDraft {
+		state = "DRAFT"
+	}
+	if attribute, ok := stateColors[state]; ok {
+		return attribute
+	}
+	return color.FgHiBlack
+}
+
+// formatStatus renders the check and review state of a pull request as a
+// suffix for its line in the report. Unknown states render as nothing.
+func formatStatus(pullRequest cascade.PullRequest) string {
+	var parts []string
+
+	switch cascade.SummarizeChecks(pullRequest.StatusCheckRollup) {
+	case cascade.CheckStateSuccess:
+		parts = append(parts, green("checks passed"))
+	case cascade.CheckStatePending:
+		parts = append(parts, hiYellow("checks pending"))
+	case cascade.CheckStateFailure:
+		parts = append(parts, red("checks failed"))
+	}
+
+	// Merged pull requests keep their last review decision, which is noise.
+	if pullRequest.State == "OPEN" {
+		switch pullRequest.ReviewDecision {
+		case "APPROVED":
+			parts = append(parts, green("approved"))
+		case "CHANGES_REQUESTED":
+			parts = append(parts, red("changes requested"))
+		case "REVIEW_REQUIRED":
+			parts = append(parts, hiYellow("review required"))
+		}
+	}
+
+	if len(parts) == 0 {
+		return ""
+	}
+	return " " + strings.Join(parts, hiBlack(" · "))
+}
+
+// printFormatted prints every pull request with tmpl, one per line.
+func printFormatted(tmpl *template.Template, processedPullRequests []cascade.ProcessedPullRequest) error {
+	for _, pr := range processedPullRequests {
+		if err := tmpl.Execute(color.Output, pr); err != nil {
+			return err
+		}
+		fmt.Fprintln(color.Output)
+	}
+	return nil
+}
+
+// formatMarkdownReport renders the result of a run as a Markdown table.
+func formatMarkdownReport(processedPullRequests []cascade.ProcessedPullRequest) string {
+	var b strings.Builder
+	b.WriteString("| Pull request | Depends on | Action | Result | Details |\n")
+	b.WriteString("| --- | --- | --- | --- | --- |\n")
+
+	for _, pr := range processedPullRequests {
+		dependency := ""
+		if pr.DependedPullRequest != nil {
+			dependency = fmt.Sprintf("[#%d](%s)", pr.DependedPullRequest.Number, pr.DependedPullRequest.URL)
+		}
+
+		action := "none"
+		if pr.Error == nil {
+			action = fmt.Sprintf("rebased onto `%.7s`", pr.Onto)
+			if pr.Pushed {
+				action += " and pushed"
+			}
+		}
+
+		var details []string
+		if pr.Error != nil {
+			details = append(details, pr.Error.Error())
+		}
+		if pr.RangeDiff != nil {
+			details = append(details, pr.RangeDiff.String())
+		}
+		for _, warning := range pr.Warnings {
+			details = append(details, "⚠️ "+warning.Error())
+		}
+
+		fmt.Fprintf(&b, "| [#%d](%s) %s | %s | %s | %s %s | %s |\n",
+			pr.Number, pr.URL, escapeMarkdownCell(pr.Title), dependency, action, resultEmoji(pr.Result()), pr.Result(), escapeMarkdownCell(cascade.Redact(strings.Join(details, "<br>"))))
+	}
+
+	return b.String()
+}
+
+func resultEmoji(result cascade.Result) string {
+	switch result {
+	case cascade.ResultRebased:
+		return "✅"
+	case cascade.ResultSkipped:
+		return "⏭️"
+	default:
+		return "❌"
+	}
+}
+
+func escapeMarkdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+// hyperlinks is set when the terminal renders OSC 8 hyperlinks. FORCE_HYPERLINK
+// overrides the guess, with 0 to turn them off.
+var hyperlinks = supportsHyperlinks()
+
+// supportsHyperlinks guesses from the environment whether the terminal
+// renders OSC 8 hyperlinks, since terminals that do not may print their
+// escape sequences as they are.
+func supportsHyperlinks() bool {
+	if force, ok := os.LookupEnv("FORCE_HYPERLINK"); ok {
+		return force != "0"
+	}
+	if !term.FromEnv().IsTerminalOutput() {
+		return false
+	}
+
+	switch os.Getenv("TERM_PROGRAM") {
+	case "iTerm.app", "WezTerm", "vscode", "ghostty", "Hyper":
+		return true
+	}
+	if os.Getenv("WT_SESSION") != "" || os.Getenv("KITTY_WINDOW_ID") != "" || os.Getenv("DOMTERM") != "" {
+		return true
+	}
+	// GNOME Terminal, Tilix and other VTE terminals since 0.50.
+	version, err := strconv.Atoi(os.Getenv("VTE_VERSION"))
+	return err == nil && version >= 5000
+}
+
+// hyperlink renders s linked to url with OSC 8, or as it is unless hyperlinks
+// is set.
+func hyperlink(url, s string) string {
+	if !hyperlinks || url == "" {
+		return s
+	}
+	return "\x1b]8;;" + url + "\x1b\\" + s + "\x1b]8;;\x1b\\"
+}
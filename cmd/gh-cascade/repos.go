@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/134130/gh-cascade/pkg/cascade"
+	"github.com/cli/go-gh/v2/pkg/repository"
+	"github.com/fatih/color"
+)
+
+type ReposOptions struct {
+	Org        string
+	RepoFilter string
+	Repos      StringsFlag
+	// Repositories are Repos, parsed.
+	Repositories []repository.Repository
+	CloneDir     string
+	Output       string
+	Verbose      bool
+	Debug        bool
+	// Args are the arguments gh cascade runs with in each repository, those
+	// after "--".
+	Args []string
+}
+
+// unsupportedRepoFlags are the flags of gh cascade that make no sense in every
+// repository of a gh cascade repos run, or that it sets itself.
+var unsupportedRepoFlags = []string{"watch", "current", "stdin", "record", "replay", "output", "format", "report-issue"}
+
+// repoReport is the result of gh cascade in a repository, as printed with
+// --output json.
+type repoReport struct {
+	notification
+	ExitCode int    `json:"exitCode"`
+	Error    string `json:"error,omitempty"`
+}
+
+func parseReposOptions(ctx context.Context, args []string) (*ReposOptions, error) {
+	opts := &ReposOptions{}
+	fs := flag.NewFlagSet("repos", flag.ContinueOnError)
+	fs.StringVar(&opts.Org, "org", "", "cascade every repository of this organization or user that is not archived")
+	fs.StringVar(&opts.RepoFilter, "repo-filter", "", "only cascade the repositories of --org whose name matches this glob, e.g. 'service-*'")
+	fs.Var(&opts.Repos, "repo", "cascade this repository, given as OWNER/REPO or HOST/OWNER/REPO (repeatable)")
+	fs.StringVar(&opts.CloneDir, "clone-dir", "", "directory to clone the repositories into and reuse them from (default: the cache directory of gh cascade)")
+	fs.StringVar(&opts.Output, "output", "text", "how to print the combined result: text, or json")
+	fs.BoolVar(&opts.Verbose, "verbose", false, "log every git and gh command with its duration")
+	fs.BoolVar(&opts.Debug, "debug", false, "like --verbose, and also log the output of every command")
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+
+	if err := applyDefaults(ctx, fs, "repos"); err != nil {
+		return nil, err
+	}
+
+	opts.Args = fs.Args()
+	if opts.Org == "" && len(opts.Repos) == 0 {
+		return nil, errors.New("--org or --repo is required")
+	}
+	if opts.RepoFilter != "" && opts.Org == "" {
+		return nil, errors.New("--repo-filter requires --org")
+	}
+	for _, name := range opts.Repos {
+		repo, err := repository.Parse(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --repo %q: %w", name, err)
+		}
+		opts.Repositories = append(opts.Repositories, repo)
+	}
+	switch opts.Output {
+	case "text", "json":
+	default:
+		return nil, fmt.Errorf("invalid --output %q: must be one of text, json", opts.Output)
+	}
+	for _, arg := range opts.Args {
+		name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if strings.HasPrefix(arg, "-") && slices.Contains(unsupportedRepoFlags, name) {
+			return nil, fmt.Errorf("--%s cannot be used with gh cascade repos", name)
+		}
+	}
+
+	if opts.CloneDir == "" {
+		dir, err := cacheDir()
+		if err != nil {
+			return nil, err
+		}
+		opts.CloneDir = filepath.Join(dir, "repos")
+	}
+
+	return opts, nil
+}
+
+// runRepos runs gh cascade, or gh cascade sync, in a clone of each repository
+// given with --repo or listed with --org, one after the other, and prints the
+// combined result.
+func runRepos(args []string) int {
+	started := time.Now()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts, err := parseReposOptions(ctx, args)
+	if err != nil {
+		return reportOptionsError(err)
+	}
+
+	setupLogging(opts.Verbose, opts.Debug)
+	if opts.Output == "json" {
+		setupQuiet()
+	}
+
+	repos, err := listRepos(ctx, opts)
+	if err != nil {
+		fmt.Fprintln(color.Error, red("x"), err)
+		return errorCode(ctx)
+	}
+	if len(repos) == 0 {
+		if opts.Output == "json" {
+			fmt.Fprintln(os.Stdout, "[]")
+		}
+		fmt.Fprintf(color.Output, "%s%s\n", green("✔"), " No repositories found.")
+		return exitNothingToDo
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		fmt.Fprintln(color.Error, red("error:"), err)
+		return exitError
+	}
+
+	var reports []repoReport
+	for _, repo := range repos {
+		name := cascade.RepositoryName(repo)
+		// The run in flight is left to wind down on Ctrl-C, which it gets
+		// too, and the others are not started.
+		if ctx.Err() != nil {
+			reports = append(reports, repoReport{notification: notification{Repository: name}, ExitCode: exitInterrupted, Error: errInterrupted.Error()})
+			continue
+		}
+
+		sp := newSpinner()
+		sp.Suffix = " Cascading " + name + "..."
+		sp.Start()
+		report := runInRepo(ctx, opts, executable, repo)
+		sp.Stop()
+
+		if opts.Output == "text" {
+			printRepoReport(report)
+		}
+		reports = append(reports, report)
+	}
+
+	if opts.Output == "json" {
+		encoder := json.NewEncoder(redactingWriter{os.Stdout})
+		encoder.SetIndent("", "  ")
+		if err = encoder.Encode(reports); err != nil {
+			fmt.Fprintln(color.Error, red("error:"), err)
+		}
+	} else {
+		fmt.Fprintf(color.Output, "\n%s\n", formatReposSummary(reports, time.Since(started)))
+	}
+
+	return reposExitCode(reports)
+}
+
+// listRepos returns the repositories given with --repo, followed by those
+// listed with --org, without duplicates.
+func listRepos(ctx context.Context, opts *ReposOptions) ([]repository.Repository, error) {
+	repos := slices.Clone(opts.Repositories)
+	if opts.Org != "" {
+		sp := newSpinner()
+		sp.Suffix = " Listing repositories of " + opts.Org + "..."
+		sp.Start()
+		listed, err := cascade.ListOwnerRepositories(ctx, opts.Org, opts.RepoFilter)
+		sp.Stop()
+		if err != nil {
+			return nil, fmt.Errorf("list repositories of %s: %w", opts.Org, err)
+		}
+		repos = append(repos, listed...)
+	}
+
+	seen := map[string]bool{}
+	return slices.DeleteFunc(repos, func(repo repository.Repository) bool {
+		name := strings.ToLower(cascade.RepositoryName(repo))
+		if seen[name] {
+			return true
+		}
+		seen[name] = true
+		return false
+	}), nil
+}
+
+// runInRepo clones repo unless it was before, and runs gh cascade in the
+// clone with the arguments of opts and --output json, with GH_REPO set to repo
+// so that the clone's remotes cannot point it elsewhere.
+func runInRepo(ctx context.Context, opts *ReposOptions, executable string, repo repository.Repository) repoReport {
+	name := cascade.RepositoryName(repo)
+	report := repoReport{notification: notification{Repository: name}, ExitCode: exitError}
+
+	clone, err := cascade.CloneRepository(ctx, opts.CloneDir, repo)
+	if err != nil {
+		report.Error = fmt.Sprintf("clone: %s", err)
+		return report
+	}
+
+	args := slices.Clone(opts.Args)
+	at := 0
+	if len(args) > 0 && args[0] == "sync" {
+		at = 1
+	}
+	args = slices.Insert(args, at, "--output", "json")
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(executable, args...)
+	cmd.Dir = clone
+	cmd.Env = append(os.Environ(), "GH_REPO="+name)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	slog.Info("cascading", slog.String("repository", name), slog.String("dir", clone))
+	err = cmd.Run()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		report.ExitCode = exitErr.ExitCode()
+	} else if err != nil {
+		report.Error = err.Error()
+		return report
+	} else {
+		report.ExitCode = exitOK
+	}
+
+	// A run that stopped before the end prints no result, and says why on
+	// standard error.
+	if err = json.Unmarshal(stdout.Bytes(), &report.notification); err != nil || report.ExitCode == exitError || report.ExitCode == exitInterrupted {
+		report.Error = lastErrorLine(stderr.String())
+		if report.Error == "" {
+			report.Error = fmt.Sprintf("gh cascade exited with %d", report.ExitCode)
+		}
+	}
+	report.Repository = name
+	return report
+}
+
+// lastErrorLine returns the last line of output that is not blank, without
+// the mark gh cascade prints errors with.
+func lastErrorLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	line := strings.TrimSpace(lines[len(lines)-1])
+	for _, mark := range []string{"x ", "error: "} {
+		line = strings.TrimPrefix(line, mark)
+	}
+	return line
+}
+
+// printRepoReport prints the result of gh cascade in a repository: a line
+// for the repository, and one for each pull request that was rebased, planned
+// to be, skipped or failed, with its warnings.
+func printRepoReport(report repoReport) {
+	if report.Error != "" {
+		fmt.Fprintf(color.Output, "%s %s: %s\n", red("x"), bold(report.Repository), red(report.Error))
+		return
+	}
+
+	var parts []string
+	for _, count := range []struct {
+		n    int
+		text string
+	}{
+		{report.Planned, fmt.Sprintf("%d to be rebased", report.Planned)},
+		{report.Rebased, fmt.Sprintf("%d rebased", report.Rebased)},
+		{report.Skipped, fmt.Sprintf("%d skipped", report.Skipped)},
+		{report.Failed, fmt.Sprintf("%d failed", report.Failed)},
+	} {
+		if count.n > 0 {
+			parts = append(parts, count.text)
+		}
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "nothing to rebase")
+	}
+	mark := green("✔")
+	if report.Failed > 0 {
+		mark = red("x")
+	}
+	fmt.Fprintf(color.Output, "%s %s: %s\n", mark, bold(report.Repository), strings.Join(parts, ", "))
+
+	for _, pr := range report.PullRequests {
+		line := fmt.Sprintf("#%d %s", pr.Number, pr.Title)
+		switch pr.Result {
+		case resultPlanned:
+			fmt.Fprintf(color.Output, "    %s %s\n", hiBlack("→"), line)
+		case string(cascade.ResultRebased):
+			fmt.Fprintf(color.Output, "    %s %s\n", green("✔"), line)
+		case string(cascade.ResultSkipped):
+			fmt.Fprintf(color.Output, "    %s %s: %s\n", hiYellow("!"), line, hiYellow(pr.Error))
+		default:
+			fmt.Fprintf(color.Output, "    %s %s: %s\n", red("x"), line, red(pr.Error))
+		}
+		for _, warning := range pr.Warnings {
+			fmt.Fprintf(color.Output, "      %s\n", hiYellow(warning))
+		}
+	}
+}
+
+// formatReposSummary renders the line that ends a gh cascade repos run: how
+// many repositories were cascaded, how many pull requests were rebased,
+// skipped and failed across them, and how long it took.
+func formatReposSummary(reports []repoReport, elapsed time.Duration) string {
+	var planned, rebased, skipped, failed, errored int
+	for _, report := range reports {
+		planned += report.Planned
+		rebased += report.Rebased
+		skipped += report.Skipped
+		failed += report.Failed
+		if report.Error != "" {
+			errored++
+		}
+	}
+
+	var parts []string
+	for _, count := range []struct {
+		n    int
+		text string
+	}{
+		{planned, fmt.Sprintf("%d to be rebased", planned)},
+		{rebased, fmt.Sprintf("%d rebased", rebased)},
+		{skipped, fmt.Sprintf("%d skipped", skipped)},
+		{failed, fmt.Sprintf("%d failed", failed)},
+		{errored, fmt.Sprintf("%d not cascaded", errored)},
+	} {
+		if count.n > 0 {
+			parts = append(parts, count.text)
+		}
+	}
+
+	if len(parts) == 0 {
+		parts = append(parts, "nothing to rebase")
+	}
+
+	repositories := "repositories"
+	if len(reports) == 1 {
+		repositories = "repository"
+	}
+	return fmt.Sprintf("%d %s: %s in %s", len(reports), repositories, strings.Join(parts, ", "), elapsed.Round(time.Second))
+}
+
+// reposExitCode combines the exit codes of the runs in each repository: that
+// of a run that was interrupted or could not run comes first, then that of
+// one where pull requests failed, then that of one that rebased any.
+func reposExitCode(reports []repoReport) int {
+	codes := map[int]bool{}
+	for _, report := range reports {
+		codes[report.ExitCode] = true
+	}
+	for _, code := range []int{exitInterrupted, exitError, exitFailed, exitOK} {
+		if codes[code] {
+			return code
+		}
+	}
+	return exitNothingToDo
+}
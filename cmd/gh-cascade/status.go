@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/134130/gh-cascade/pkg/cascade"
+	"github.com/cli/go-gh/v2/pkg/text"
+	"github.com/fatih/color"
+)
+
+type StatusOptions struct {
+	cascade.Options
+	Verbose    bool
+	Debug      bool
+	Patterns   StringsFlag
+	Keywords   StringsFlag
+	Authors    StringsFlag
+	AllAuthors bool
+	Assignee   string
+	Labels     StringsFlag
+	Milestone  string
+	Search     string
+	NoTitles   bool
+	Theme      string
+	UseCache   bool
+	CacheTTL   time.Duration
+}
+
+func parseStatusOptions(ctx context.Context, args []string) (*StatusOptions, error) {
+	opts := &StatusOptions{}
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	fs.BoolVar(&opts.Verbose, "verbose", false, "log every git and gh command with its duration")
+	fs.BoolVar(&opts.Debug, "debug", false, "like --verbose, and also log the output of every command")
+	addPatternFlags(fs, &opts.Patterns, &opts.Keywords)
+	fs.Var(&opts.Authors, "author", "only report pull requests of this author (repeatable, default: @me)")
+	fs.BoolVar(&opts.AllAuthors, "all-authors", false, "report pull requests of every author")
+	fs.StringVar(&opts.Assignee, "assignee", "", "only report pull requests assigned to this user")
+	fs.Var(&opts.Labels, "label", "only report pull requests with this label (repeatable, all must match)")
+	fs.StringVar(&opts.Milestone, "milestone", "", "only report pull requests in the milestone with this title")
+	fs.StringVar(&opts.Search, "search", "", "only report pull requests matching this GitHub search query, e.g. \"head:feature/ -label:blocked\"")
+	fs.Var((*StringsFlag)(&opts.Exclude), "exclude", "glob of head branches to leave out (repeatable)")
+	fs.BoolVar(&opts.LinkedIssues, "linked-issues", false, "chain pull requests that declare no dependency after the pull request opened before them for the same linked issue")
+	fs.BoolVar(&opts.ScanComments, "scan-comments", false, "also look for dependencies in the comments and reviews of pull requests, the newest declaration replacing those before it")
+	fs.BoolVar(&opts.RetargetClosed, "retarget-closed", false, "report pull requests whose dependency was closed without merging as needing a rebase rather than abandoned")
+	fs.BoolVar(&opts.NoTitles, "no-titles", false, "leave the titles of pull requests out of the report")
+	addThemeFlag(fs, &opts.Theme)
+	addCacheFlags(fs, &opts.UseCache, &opts.CacheTTL)
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+
+	if err := cascade.Preflight(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := applyDefaults(ctx, fs, "status"); err != nil {
+		return nil, err
+	}
+
+	if opts.AllAuthors && len(opts.Authors) > 0 {
+		return nil, errors.New("--author cannot be used with --all-authors")
+	}
+
+	if opts.CacheTTL < 0 {
+		return nil, errors.New("--cache-ttl must not be negative")
+	}
+	if err := applyTheme(opts.Theme); err != nil {
+		return nil, err
+	}
+
+	if err := installDependOnPatterns(opts.Patterns, opts.Keywords); err != nil {
+		return nil, err
+	}
+
+	repo, err := cascade.SetupBaseRepository(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if opts.UseCache {
+		if opts.Cache, err = newCache(repo, opts.CacheTTL); err != nil {
+			return nil, err
+		}
+	}
+
+	return opts, nil
+}
+
+// PullRequestFilter returns the filter that selects the pull requests to
+// report.
+func (o *StatusOptions) PullRequestFilter() cascade.PullRequestFilter {
+	return (&Options{Authors: o.Authors, AllAuthors: o.AllAuthors, Assignee: o.Assignee, Labels: o.Labels, Milestone: o.Milestone, Search: o.Search}).PullRequestFilter()
+}
+
+// statusSections are the headings the status report groups pull requests
+// under, in order.
+var statusSections = []struct {
+	Health  cascade.Health
+	Heading string
+}{
+	{cascade.HealthNeedsRebase, "Dependency merged, not rebased yet"},
+	{cascade.HealthBehind, "Behind the default branch"},
+	{cascade.HealthBlocked, "Blocked"},
+	{cascade.HealthAbandoned, "Abandoned"},
+	{cascade.HealthUpToDate, "Up to date"},
+}
+
+// runStatus reports where each pull request stands in its chain without
+// changing anything, or running git at all.
+func runStatus(args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts, err := parseStatusOptions(ctx, args)
+	if err != nil {
+		return reportOptionsError(err)
+	}
+
+	setupLogging(opts.Verbose, opts.Debug)
+
+	sp := newSpinner()
+	sp.Suffix = " Checking pull requests..."
+	sp.Start()
+
+	defaultBranch, err := cascade.GetDefaultBranch(ctx)
+	if err != nil {
+		sp.Stop()
+		fmt.Fprintln(color.Error, red("x"), fmt.Errorf("resolve default branch: %w", err))
+		return exitError
+	}
+	pullRequests, err := cascade.ListPullRequests(ctx, opts.PullRequestFilter())
+	if err != nil {
+		sp.Stop()
+		fmt.Fprintln(color.Error, red("x"), fmt.Errorf("list pull requests: %w", err))
+		return exitError
+	}
+	statuses := cascade.CheckStatus(ctx, &opts.Options, defaultBranch, pullRequests)
+	sp.Stop()
+
+	printStatus(statuses, defaultBranch, opts)
+
+	return exitOK
+}
+
+// printStatus prints the pull requests with a dependency grouped by their
+// health, followed by those whose dependency could not be resolved.
+func printStatus(statuses []cascade.PullRequestStatus, defaultBranch string, opts *StatusOptions) {
+	width := 0
+	if !opts.NoTitles {
+		width = terminalWidth()
+	}
+	printLine := func(pr cascade.PullRequest, indent int) {
+		colorFn := color.New(getColor(pr)).SprintFunc()
+		fmt.Fprintf(color.Output, "%*s%s %s%s%s\n", indent, "", formatNumber(pr, colorFn), stateLabel(pr), white(pr.HeadRefName), formatStatus(pr))
+		if !opts.NoTitles {
+			title := pr.Title
+			if width > 0 {
+				title = text.Truncate(max(width-indent-6, 0), title)
+			}
+			fmt.Fprintf(color.Output, "%*s%s\n", indent+6, "", title)
+		}
+	}
+
+	printed := false
+	for _, section := range statusSections {
+		var matching []cascade.PullRequestStatus
+		for _, status := range statuses {
+			if status.Health == section.Health {
+				matching = append(matching, status)
+			}
+		}
+		if len(matching) == 0 {
+			continue
+		}
+
+		printed = true
+		fmt.Fprintf(color.Output, "\n%s\n", bold(section.Heading))
+		for _, status := range matching {
+			printLine(status.PullRequest, 2)
+			switch status.Health {
+			case cascade.HealthBehind:
+				fmt.Fprintf(color.Output, "        %s\n", hiYellow(fmt.Sprintf("%s behind %s", text.Pluralize(status.BehindBy, "commit"), defaultBranch)))
+			case cascade.HealthNeedsRebase, cascade.HealthBlocked, cascade.HealthAbandoned:
+				fmt.Fprintf(color.Output, "        %s\n", hiBlack("depends on"))
+				printLine(*status.DependedPullRequest, 8)
+			}
+		}
+	}
+
+	var failed []cascade.PullRequestStatus
+	for _, status := range statuses {
+		if status.Health == "" {
+			failed = append(failed, status)
+		}
+	}
+	if len(failed) > 0 {
+		printed = true
+		fmt.Fprintf(color.Output, "\n%s\n", bold("Not checked"))
+		for _, status := range failed {
+			printLine(status.PullRequest, 2)
+			if status.Result() == cascade.ResultSkipped {
+				fmt.Fprintf(color.Output, "        %s\n", hiYellow(resultLabel(status.ProcessedPullRequest), status.Error))
+			} else {
+				fmt.Fprintf(color.Output, "        %s\n", red(resultLabel(status.ProcessedPullRequest), status.Error))
+			}
+		}
+	}
+
+	if !printed {
+		fmt.Fprintf(color.Output, "%s%s\n", green("✔"), " No pull requests with dependencies found.")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/134130/gh-cascade/pkg/cascade"
+	"github.com/fatih/color"
+)
+
+// Themes of --theme.
+const (
+	themeDefault    = "default"
+	themeColorblind = "colorblind"
+	themeSymbols    = "symbols"
+)
+
+// stateColors color pull request numbers by state, DRAFT standing for open
+// drafts.
+var stateColors = map[string]color.Attribute{
+	"OPEN":   color.FgGreen,
+	"DRAFT":  color.FgHiBlack,
+	"MERGED": color.FgMagenta,
+	"CLOSED": color.FgRed,
+}
+
+// labelStates is set by the themes that spell out the state of each pull
+// request and the result of each one not rebased, so that they do not depend
+// on telling colors apart.
+var labelStates bool
+
+func addThemeFlag(fs *flag.FlagSet, theme *string) {
+	fs.StringVar(theme, "theme", themeDefault, "colors of the output: default, colorblind for a palette that does not rely on telling red from green, or symbols to also spell out states")
+}
+
+// applyColorEnv turns colors off with CLICOLOR=0, and on with CLICOLOR_FORCE
+// even when the output is not a terminal, as gh does. NO_COLOR takes
+// precedence over both.
+func applyColorEnv() {
+	switch force := os.Getenv("CLICOLOR_FORCE"); {
+	case os.Getenv("NO_COLOR") != "":
+		color.NoColor = true
+	case force != "" && force != "0":
+		color.NoColor = false
+	case os.Getenv("CLICOLOR") == "0":
+		color.NoColor = true
+	}
+}
+
+// applyTheme switches the colors and labels of the output to theme.
+func applyTheme(theme string) error {
+	switch theme {
+	case themeDefault:
+	case themeColorblind:
+		// Red and green are what most color vision deficiencies confuse, so
+		// green gives way to blue, and states are spelled out as well.
+		green = color.New(color.FgHiBlue).SprintFunc()
+		stateColors["OPEN"] = color.FgHiBlue
+		stateColors["MERGED"] = color.FgHiCyan
+		labelStates = true
+	case themeSymbols:
+		labelStates = true
+	default:
+		return fmt.Errorf("invalid --theme %q: must be one of default, colorblind, symbols", theme)
+	}
+	return nil
+}
+
+// stateLabel returns the state of pr to print after its number, or "" unless
+// labelStates is set.
+func stateLabel(pr cascade.PullRequest) string {
+	if !labelStates {
+		return ""
+	}
+	state := strings.ToLower(pr.State)
+	if pr.State == "OPEN" && pr.IsDraft {
+		state = "draft"
+	}
+	return hiBlack("(" + state + ") ")
+}
+
+// resultLabel returns the result of pr to print before its error, or ""
+// unless labelStates is set.
+func resultLabel(pr cascade.ProcessedPullRequest) string {
+	if !labelStates {
+		return ""
+	}
+	switch pr.Result() {
+	case cascade.ResultRebased:
+		return "✔ rebased: "
+	case cascade.ResultSkipped:
+		return "⏭ skipped: "
+	default:
+		return "✖ failed: "
+	}
+}
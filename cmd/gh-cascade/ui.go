@@ -0,0 +1,502 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/134130/gh-cascade/pkg/cascade"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/cli/go-gh/v2/pkg/text"
+	"github.com/fatih/color"
+)
+
+// runUI runs gh cascade ui, a full-screen dashboard to pick the pull requests
+// to rebase and follow their progress, and returns its exit code.
+func runUI(args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts, err := parseOptions(ctx, args)
+	if err != nil {
+		return reportOptionsError(err)
+	}
+	if opts.Watch || opts.DryRun || opts.Timeout > 0 || opts.FailFast {
+		fmt.Fprintln(color.Error, red("error:"), "--watch, --dry-run, --timeout and --fail-fast cannot be used with ui")
+		return exitError
+	}
+
+	setupLogging(opts.Verbose, opts.Debug)
+
+	closeAuditLog, err := openAuditLog(opts)
+	if err != nil {
+		fmt.Fprintln(color.Error, red("error:"), err)
+		return exitError
+	}
+	defer closeAuditLog()
+
+	_, release, err := prepareWorkspace(ctx, opts.ForceUnlock, opts.Autostash)
+	if errors.Is(err, cascade.ErrDirtyWorkspace) {
+		fmt.Fprintln(color.Error, red("x"), "current branch is dirty. please retry after stashing or committing your changes, or with --autostash.")
+		return exitError
+	} else if err != nil {
+		fmt.Fprintln(color.Error, red("error:"), err)
+		return exitError
+	}
+	defer release()
+
+	// Commands are logged into the dashboard instead of over it.
+	handler := &uiLogHandler{}
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(handler))
+
+	model := &uiModel{ctx: ctx, opts: opts, running: -1, loading: true}
+	program := tea.NewProgram(model, tea.WithAltScreen(), tea.WithContext(ctx))
+	handler.send = program.Send
+
+	if _, err = program.Run(); err != nil && !errors.Is(err, tea.ErrProgramKilled) {
+		fmt.Fprintln(color.Error, red("error:"), err)
+		return exitError
+	}
+	if model.err != nil {
+		fmt.Fprintln(color.Error, red("x"), model.err)
+		return exitError
+	}
+
+	processedPullRequests := model.results()
+	if len(processedPullRequests) == 0 {
+		return exitNothingToDo
+	}
+	printReport(processedPullRequests, opts)
+	return exitCode(opts, processedPullRequests)
+}
+
+type uiStatus int
+
+const (
+	uiReady uiStatus = iota
+	uiQueued
+	uiRunning
+	uiRebased
+	uiSkipped
+	uiFailed
+)
+
+// uiItem is a pull request on the dashboard.
+type uiItem struct {
+	// planned is the pull request as planned, which retries start from.
+	planned cascade.ProcessedPullRequest
+	// processed is the latest result.
+	processed cascade.ProcessedPullRequest
+	status    uiStatus
+	selected  bool
+	// depth is how deep the pull request sits in its chain.
+	depth int
+	logs  []string
+}
+
+type (
+	uiLoadedMsg struct {
+		defaultBranch string
+		plan          []cascade.ProcessedPullRequest
+		err           error
+	}
+	uiRebasedMsg struct {
+		index     int
+		processed cascade.ProcessedPullRequest
+	}
+	uiLogMsg string
+)
+
+type uiModel struct {
+	ctx           context.Context
+	opts          *Options
+	defaultBranch string
+	items         []*uiItem
+	cursor        int
+	// queue holds the indexes of the items waiting to be rebased.
+	queue []int
+	// running is the index of the item being rebased, or -1.
+	running  int
+	paused   bool
+	loading  bool
+	quitting bool
+	err      error
+	width    int
+	height   int
+}
+
+func (m *uiModel) Init() tea.Cmd {
+	return func() tea.Msg {
+		defaultBranch, pullRequests, err := fetchPullRequests(m.ctx, m.opts)
+		if err != nil {
+			return uiLoadedMsg{err: err}
+		}
+		plan, err := cascade.Plan(m.ctx, &m.opts.Options, defaultBranch, pullRequests)
+		return uiLoadedMsg{defaultBranch: defaultBranch, plan: plan, err: err}
+	}
+}
+
+func (m *uiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+
+	case uiLoadedMsg:
+		m.loading = false
+		if msg.err != nil {
+			m.err = msg.err
+			return m, tea.Quit
+		}
+		m.defaultBranch = msg.defaultBranch
+		m.items = newUIItems(msg.plan)
+
+	case uiLogMsg:
+		if m.running >= 0 {
+			item := m.items[m.running]
+			item.logs = append(item.logs, string(msg))
+		}
+
+	case uiRebasedMsg:
+		item := m.items[msg.index]
+		item.processed = msg.processed
+		item.status = uiStatusOf(msg.processed)
+		m.running = -1
+		if m.quitting {
+			return m, tea.Quit
+		}
+		return m, m.next()
+
+	case tea.KeyMsg:
+		return m, m.handleKey(msg)
+	}
+
+	return m, nil
+}
+
+func (m *uiModel) handleKey(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "q", "ctrl+c":
+		// A rebase in progress must finish before the workspace is restored.
+		if m.running < 0 {
+			return tea.Quit
+		}
+		m.quitting = true
+		m.queue = nil
+		return nil
+	}
+
+	if m.loading || m.quitting || len(m.items) == 0 {
+		return nil
+	}
+
+	item := m.items[m.cursor]
+	switch msg.String() {
+	case "up", "k":
+		m.cursor = max(m.cursor-1, 0)
+	case "down", "j":
+		m.cursor = min(m.cursor+1, len(m.items)-1)
+	case " ":
+		if item.status == uiReady {
+			item.selected = !item.selected
+		}
+	case "a":
+		for _, item := range m.items {
+			if item.status == uiReady {
+				item.selected = true
+			}
+		}
+	case "enter", "x":
+		for i, item := range m.items {
+			if item.selected && item.status == uiReady {
+				item.selected = false
+				m.enqueue(i)
+			}
+		}
+		return m.next()
+	case "r":
+		// Only pull requests that failed to rebase can be retried; those
+		// that failed to plan need a new run.
+		if item.status == uiFailed && item.planned.Error == nil {
+			item.logs = nil
+			m.enqueue(m.cursor)
+			return m.next()
+		}
+	case "s":
+		if item.status == uiReady || item.status == uiQueued {
+			m.dequeue(m.cursor)
+			item.selected = false
+			item.processed.Error = cascade.Skipf("skipped interactively")
+			item.status = uiSkipped
+		}
+	case "p":
+		m.paused = !m.paused
+		return m.next()
+	}
+
+	return nil
+}
+
+func (m *uiModel) enqueue(index int) {
+	m.items[index].status = uiQueued
+	m.queue = append(m.queue, index)
+}
+
+func (m *uiModel) dequeue(index int) {
+	for i, queued := range m.queue {
+		if queued == index {
+			m.queue = append(m.queue[:i], m.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// next starts rebasing the next queued pull request, unless one is already
+// being rebased or the queue is paused. Rebases run one at a time since they
+// share the workspace.
+func (m *uiModel) next() tea.Cmd {
+	if m.running >= 0 || m.paused || len(m.queue) == 0 {
+		return nil
+	}
+
+	index := m.queue[0]
+	m.queue = m.queue[1:]
+	m.running = index
+
+	item := m.items[index]
+	item.status = uiRunning
+	planned := item.planned
+	var parent cascade.ProcessedPullRequest
+	if planned.Chained() {
+		parent = m.parentOf(planned)
+	}
+	return func() tea.Msg {
+		processed := planned
+		if processed.Chained() {
+			if processed = cascade.Restack(m.ctx, &m.opts.Options, processed, parent); processed.Error != nil {
+				return uiRebasedMsg{index: index, processed: processed}
+			}
+		}
+		return uiRebasedMsg{index: index, processed: cascade.Rebase(m.ctx, &m.opts.Options, m.defaultBranch, processed)}
+	}
+}
+
+// parentOf returns the item of the dependency of a chained pull request as
+// Restack takes it, with Error set unless it was rebased in this session.
+func (m *uiModel) parentOf(pr cascade.ProcessedPullRequest) cascade.ProcessedPullRequest {
+	for _, item := range m.items {
+		if item.planned.Number != pr.DependedPullRequest.Number {
+			continue
+		}
+		parent := item.processed
+		if item.status != uiRebased {
+			parent.Error = cascade.Skipf("rebase it first")
+		}
+		return parent
+	}
+	return cascade.ProcessedPullRequest{PullRequest: *pr.DependedPullRequest, Error: cascade.Skipf("not listed")}
+}
+
+// results returns the pull requests that were rebased, failed to rebase, or
+// were skipped interactively.
+func (m *uiModel) results() []cascade.ProcessedPullRequest {
+	var results []cascade.ProcessedPullRequest
+	for _, item := range m.items {
+		if item.planned.Error == nil && (item.status == uiRebased || item.status == uiFailed || item.status == uiSkipped) {
+			results = append(results, item.processed)
+		}
+	}
+	return results
+}
+
+func (m *uiModel) View() string {
+	if m.loading {
+		return "\n  Fetching and planning pull requests...\n"
+	}
+	if m.quitting && m.running < 0 {
+		return ""
+	}
+
+	var b strings.Builder
+
+	header := fmt.Sprintf("  %s  %d pull requests · %d queued", bold("gh cascade"), len(m.items), len(m.queue))
+	if m.paused {
+		header += " · " + hiYellow("paused")
+	}
+	if m.quitting {
+		header += " · " + hiYellow(fmt.Sprintf("waiting for #%d to finish", m.items[m.running].processed.Number))
+	}
+	b.WriteString(m.fit(header) + "\n\n")
+
+	if len(m.items) == 0 {
+		b.WriteString("  No open or draft pull requests found.\n")
+	}
+	for i, item := range m.items {
+		b.WriteString(m.fit(m.formatItem(i, item)) + "\n")
+	}
+
+	if len(m.items) > 0 {
+		item := m.items[m.cursor]
+		b.WriteString("\n" + m.fit(hiBlack(fmt.Sprintf("  Log of #%d", item.processed.Number))) + "\n")
+
+		// Keep the most recent lines that fit below the list.
+		logs := item.logs
+		if room := m.height - len(m.items) - 8; room >= 0 && len(logs) > room {
+			logs = logs[len(logs)-room:]
+		}
+		for _, line := range logs {
+			b.WriteString(m.fit("    "+line) + "\n")
+		}
+	}
+
+	b.WriteString("\n" + m.fit(hiBlack("  space select · a select all · enter rebase selected · r retry · s skip · p pause · q quit")))
+	return b.String()
+}
+
+func (m *uiModel) formatItem(index int, item *uiItem) string {
+	cursor := "  "
+	if index == m.cursor {
+		cursor = bold("> ")
+	}
+	checkbox := "[ ]"
+	if item.selected {
+		checkbox = "[x]"
+	}
+
+	pr := item.processed
+	colorFn := color.New(getColor(pr.PullRequest)).SprintFunc()
+	line := fmt.Sprintf("%s%s %s%s %s", cursor, checkbox, strings.Repeat("  ", item.depth), colorFn(fmt.Sprintf("#%-4d", pr.Number)), pr.HeadRefName)
+	if pr.DependedPullRequest != nil {
+		dependedColorFn := color.New(getColor(*pr.DependedPullRequest)).SprintFunc()
+		line += " ← " + dependedColorFn(fmt.Sprintf("#%d", pr.DependedPullRequest.Number))
+	}
+
+	switch item.status {
+	case uiReady:
+		line += "  " + green("ready")
+	case uiQueued:
+		line += "  " + hiBlack("queued")
+	case uiRunning:
+		line += "  " + blue("rebasing...")
+	case uiRebased:
+		status := "rebased"
+		if pr.Pushed {
+			status = "rebased and pushed"
+		}
+		line += "  " + green(status)
+		if pr.RangeDiff != nil && pr.RangeDiff.Changed() {
+			line += " " + hiYellow(pr.RangeDiff)
+		}
+	case uiSkipped:
+		line += "  " + hiYellow(pr.Error)
+	case uiFailed:
+		line += "  " + red(pr.Error)
+	}
+	if len(pr.Conflicts) > 0 && item.status == uiReady {
+		line += " " + hiYellow("predicted to conflict")
+	}
+
+	return line
+}
+
+// fit truncates line to the width of the terminal.
+func (m *uiModel) fit(line string) string {
+	if m.width <= 0 {
+		return line
+	}
+	return text.Truncate(m.width, line)
+}
+
+// newUIItems orders the plan along the dependency graph, each pull request
+// right below the one it depends on.
+func newUIItems(plan []cascade.ProcessedPullRequest) []*uiItem {
+	listed := map[int]bool{}
+	for _, pr := range plan {
+		listed[pr.Number] = true
+	}
+
+	var roots []cascade.ProcessedPullRequest
+	children := map[int][]cascade.ProcessedPullRequest{}
+	for _, pr := range plan {
+		if len(pr.DependOns) == 1 && listed[pr.DependOns[0]] {
+			children[pr.DependOns[0]] = append(children[pr.DependOns[0]], pr)
+		} else {
+			roots = append(roots, pr)
+		}
+	}
+
+	var items []*uiItem
+	visited := map[int]bool{}
+	var visit func(pr cascade.ProcessedPullRequest, depth int)
+	visit = func(pr cascade.ProcessedPullRequest, depth int) {
+		if visited[pr.Number] {
+			return
+		}
+		visited[pr.Number] = true
+		status := uiReady
+		if pr.Error != nil {
+			status = uiStatusOf(pr)
+		}
+		items = append(items, &uiItem{planned: pr, processed: pr, status: status, depth: depth})
+		for _, child := range children[pr.Number] {
+			visit(child, depth+1)
+		}
+	}
+	for _, pr := range roots {
+		visit(pr, 0)
+	}
+	// Pull requests that depend on each other in a loop have no root.
+	for _, pr := range plan {
+		visit(pr, 0)
+	}
+
+	return items
+}
+
+func uiStatusOf(pr cascade.ProcessedPullRequest) uiStatus {
+	switch pr.Result() {
+	case cascade.ResultSkipped:
+		return uiSkipped
+	case cascade.ResultFailed:
+		return uiFailed
+	default:
+		return uiRebased
+	}
+}
+
+// uiLogHandler forwards log records to the dashboard, which shows them as the
+// log of the pull request being rebased.
+type uiLogHandler struct {
+	send func(tea.Msg)
+}
+
+func (h *uiLogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= slog.LevelInfo || level >= logLevel.Level()
+}
+
+func (h *uiLogHandler) Handle(_ context.Context, record slog.Record) error {
+	if h.send == nil {
+		return nil
+	}
+
+	line := record.Message
+	record.Attrs(func(attr slog.Attr) bool {
+		if attr.Value.Kind() == slog.KindDuration {
+			line += " " + hiBlack(attr.Value.Duration().Round(time.Millisecond))
+		} else {
+			line += " " + attr.Value.String()
+		}
+		return true
+	})
+	h.send(uiLogMsg(line))
+	return nil
+}
+
+func (h *uiLogHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *uiLogHandler) WithGroup(string) slog.Handler { return h }
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/134130/gh-cascade/pkg/cascade"
+	"github.com/fatih/color"
+)
+
+type UndoOptions struct {
+	Push        bool
+	Verbose     bool
+	Debug       bool
+	ForceUnlock bool
+	FetchRemote string
+	PushRemote  string
+	// Numbers are the pull requests to restore. All backups are restored if
+	// it is empty.
+	Numbers []int
+}
+
+func parseUndoOptions(ctx context.Context, args []string) (*UndoOptions, error) {
+	opts := &UndoOptions{}
+	fs := flag.NewFlagSet("undo", flag.ContinueOnError)
+	fs.BoolVar(&opts.Push, "push", false, "force-push the restored tips over the rebased ones")
+	fs.BoolVar(&opts.Verbose, "verbose", false, "log every git and gh command with its duration")
+	fs.BoolVar(&opts.Debug, "debug", false, "like --verbose, and also log the output of every command")
+	fs.BoolVar(&opts.ForceUnlock, "force-unlock", false, "break the lock of another run, e.g. one that was killed")
+	addRemoteFlags(fs, &opts.FetchRemote, &opts.PushRemote)
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+
+	// Without --push, only git is needed.
+	if _, err := cascade.CheckWorkTree(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := applyDefaults(ctx, fs, "undo"); err != nil {
+		return nil, err
+	}
+
+	for _, arg := range fs.Args() {
+		number, err := strconv.Atoi(strings.TrimPrefix(arg, "#"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pull request number %q", arg)
+		}
+		opts.Numbers = append(opts.Numbers, number)
+	}
+
+	if opts.Push {
+		if err := cascade.Preflight(ctx); err != nil {
+			return nil, err
+		}
+		if _, err := cascade.SetupRepository(ctx, &opts.FetchRemote, &opts.PushRemote); err != nil {
+			return nil, err
+		}
+	}
+
+	return opts, nil
+}
+
+// runUndo restores branches to the tips recorded before cascade last rebased
+// them, and with --push also restores the tips on the remote.
+func runUndo(args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts, err := parseUndoOptions(ctx, args)
+	if err != nil {
+		return reportOptionsError(err)
+	}
+
+	setupLogging(opts.Verbose, opts.Debug)
+
+	unlock, err := lock(ctx, opts.ForceUnlock)
+	if err != nil {
+		fmt.Fprintln(color.Error, red("x"), err)
+		return exitError
+	}
+	defer unlock()
+
+	backups, err := cascade.ListBackups(ctx)
+	if err != nil {
+		fmt.Fprintln(color.Error, red("error:"), fmt.Errorf("list backups: %w", err))
+		return exitError
+	}
+
+	if len(opts.Numbers) > 0 {
+		byBranch := map[string]cascade.Backup{}
+		for _, backup := range backups {
+			byBranch[backup.Branch] = backup
+		}
+
+		backups = nil
+		for _, number := range opts.Numbers {
+			backup, ok := byBranch[cascade.PullRequestBranch(number)]
+			if !ok {
+				fmt.Fprintln(color.Error, red("x"), fmt.Sprintf("no backup of #%d found", number))
+				return exitError
+			}
+			backups = append(backups, backup)
+		}
+	}
+
+	if len(backups) == 0 {
+		fmt.Fprintf(color.Output, "%s%s\n", green("✔"), " No backups found.")
+		return exitNothingToDo
+	}
+
+	code := exitOK
+	for _, backup := range backups {
+		if err := undoBackup(ctx, opts, backup); err != nil {
+			fmt.Fprintln(color.Error, red("x"), fmt.Errorf("%s: %w", backup.Branch, err))
+			code = exitFailed
+		}
+	}
+
+	return code
+}
+
+// undoBackup resets the branch of backup to its recorded tip, force-pushes
+// the recorded remote tip if requested, and then drops the backup.
+func undoBackup(ctx context.Context, opts *UndoOptions, backup cascade.Backup) error {
+	rebased, err := cascade.RevParse(ctx, "refs/heads/"+backup.Branch)
+	if err != nil {
+		return fmt.Errorf("branch not found: %w", err)
+	}
+
+	if opts.Push {
+		if backup.RemoteOid == "" {
+			return errors.New("it was not pushed by cascade; rerun without --push")
+		}
+		number, ok := cascade.ParsePullRequestBranch(backup.Branch)
+		if !ok {
+			return errors.New("not a branch of cascade")
+		}
+		pr, err := cascade.GetPullRequest(ctx, number)
+		if err != nil {
+			return fmt.Errorf("get PR #%d: %w", number, err)
+		}
+		remote, err := cascade.HeadRemote(ctx, *pr, opts.FetchRemote, opts.PushRemote)
+		if err != nil {
+			return fmt.Errorf("push: %w", err)
+		}
+		if err = cascade.PushBranch(ctx, remote, pr.HeadRefName, backup.RemoteOid, rebased); err != nil {
+			return fmt.Errorf("push: %w", err)
+		}
+	}
+
+	if err = cascade.ResetBranch(ctx, backup.Branch, backup.Oid); err != nil {
+		return err
+	}
+
+	if err = cascade.DeleteBackup(ctx, backup.Branch); err != nil {
+		return fmt.Errorf("delete backup: %w", err)
+	}
+
+	if opts.Push {
+		fmt.Fprintf(color.Output, "%s Restored and pushed %s at %s\n", green("✔"), backup.Branch, backup.RemoteOid[:7])
+	} else {
+		fmt.Fprintf(color.Output, "%s Restored %s at %s\n", green("✔"), backup.Branch, backup.Oid[:7])
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/134130/gh-cascade/pkg/cascade"
+	"github.com/fatih/color"
+)
+
+// version, commit and date describe the build. Release builds set them with
+// -ldflags "-X main.version=...", as goreleaser and script/build.sh do;
+// otherwise they are taken from the build info recorded by go build and go
+// install.
+var (
+	version string
+	commit  string
+	date    string
+)
+
+// buildInfo describes the running binary.
+type buildInfo struct {
+	Version   string
+	Commit    string
+	Date      string
+	GoVersion string
+	Platform  string
+}
+
+func getBuildInfo() buildInfo {
+	info := buildInfo{Version: version, Commit: commit, Date: date, GoVersion: runtime.Version(), Platform: runtime.GOOS + "/" + runtime.GOARCH}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "" {
+			info.Version = bi.Main.Version
+		}
+		for _, setting := range bi.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.Date == "":
+				info.Date = setting.Value
+			case setting.Key == "vcs.modified" && setting.Value == "true" && info.Commit != "" && commit == "":
+				info.Commit += "-dirty"
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "(devel)"
+	}
+	return info
+}
+
+// String formats the build as the first line of gh cascade version.
+func (b buildInfo) String() string {
+	s := "gh cascade " + b.Version
+	switch {
+	case b.Commit != "" && b.Date != "":
+		s += fmt.Sprintf(" (%s, %s)", shortCommit(b.Commit), b.Date)
+	case b.Commit != "":
+		s += fmt.Sprintf(" (%s)", shortCommit(b.Commit))
+	}
+	return s
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
+
+func parseVersionOptions(args []string) error {
+	fs := flag.NewFlagSet("version", flag.ContinueOnError)
+	return parseFlags(fs, args)
+}
+
+// runVersion prints the build of gh cascade and the versions of git and gh it
+// finds, e.g. to paste into a bug report.
+func runVersion(args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := parseVersionOptions(args); err != nil {
+		return reportOptionsError(err)
+	}
+
+	info := getBuildInfo()
+	fmt.Fprintln(color.Output, info)
+	fmt.Fprintf(color.Output, "built with %s for %s\n", info.GoVersion, info.Platform)
+	gitVersion, _, gitErr := cascade.CheckGit(ctx)
+	ghVersion, ghErr := cascade.CheckGh(ctx)
+	fmt.Fprintln(color.Output, toolVersion("git", gitVersion, gitErr))
+	fmt.Fprintln(color.Output, toolVersion("gh", ghVersion, ghErr))
+
+	return exitOK
+}
+
+// toolVersion formats the version of git or gh as found by cascade.CheckGit
+// or cascade.CheckGh, whose errors name the tool.
+func toolVersion(name, version string, err error) string {
+	switch {
+	case version != "" && err != nil:
+		return fmt.Sprintf("%s %s %s", name, version, hiYellow("("+err.Error()+")"))
+	case err != nil:
+		return hiYellow(err)
+	case version == "":
+		return name + " (unknown version)"
+	}
+	return name + " " + version
+}
+
+// logBuildInfo logs the build of gh cascade and the versions of git and gh at
+// debug level, so that the log of a --debug run, errors included, tells what
+// it ran with.
+func logBuildInfo() {
+	info := getBuildInfo()
+	gitVersion, _, _ := cascade.CheckGit(context.Background())
+	ghVersion, _ := cascade.CheckGh(context.Background())
+	slog.Debug("build",
+		slog.String("version", info.Version),
+		slog.String("commit", info.Commit),
+		slog.String("date", info.Date),
+		slog.String("go", info.GoVersion),
+		slog.String("platform", info.Platform),
+		slog.String("git", gitVersion),
+		slog.String("gh", ghVersion),
+	)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/134130/gh-cascade/pkg/cascade"
+	"github.com/fatih/color"
+)
+
+// watchState is what a pull request was last processed against. It changes
+// when the dependency is merged again (e.g. a revert and re-land) or when
+// someone pushes to the pull request, both of which warrant another attempt.
+type watchState struct {
+	MergeCommitOid string
+	HeadRefOid     string
+}
+
+// errHandled is the error of pull requests left alone because their
+// watchState did not change, which chained pull requests are skipped with.
+var errHandled = cascade.Skipf("handled in an earlier pass")
+
+// runWatch polls the pull requests every opts.Interval and processes each one
+// as soon as its dependency merges, until ctx is cancelled. restore checks the
+// original branch back out after every pass that touched the workspace.
+func runWatch(ctx context.Context, opts *Options, restore func()) {
+	fmt.Fprintf(color.Output, "%s Watching pull requests every %s. Press Ctrl-C to stop.\n", green("✔"), opts.Interval)
+
+	handled := map[int]watchState{}
+	queues := map[int]string{}
+	for {
+		if checkedOut := watchPass(ctx, opts, handled, queues); checkedOut {
+			restore()
+		}
+
+		select {
+		case <-ctx.Done():
+			fmt.Fprintf(color.Output, "%s Stopped watching.\n", green("✔"))
+			return
+		case <-time.After(opts.Interval):
+		}
+	}
+}
+
+// watchPass processes every pull request whose state changed since it was
+// last handled, after printing how their dependencies moved in the merge
+// queue since the last pass, as recorded in queues. It reports whether any
+// branch was checked out.
+func watchPass(ctx context.Context, opts *Options, handled map[int]watchState, queues map[int]string) bool {
+	isDirty, err := cascade.IsCurrentBranchDirty(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			fmt.Fprintln(color.Error, red("x"), timestamp(), err)
+		}
+		return false
+	}
+	if isDirty {
+		fmt.Fprintln(color.Error, hiYellow("!"), timestamp(), "current branch is dirty, skipping this pass.")
+		return false
+	}
+
+	defaultBranch, pullRequests, err := fetchPullRequests(ctx, opts)
+	if err != nil {
+		if ctx.Err() == nil {
+			fmt.Fprintln(color.Error, red("x"), timestamp(), err)
+		}
+		return false
+	}
+
+	plan, err := cascade.Plan(ctx, &opts.Options, defaultBranch, pullRequests)
+	if err != nil {
+		if ctx.Err() == nil {
+			fmt.Fprintln(color.Error, red("x"), timestamp(), err)
+		}
+		return false
+	}
+
+	printMergeQueueEvents(plan, queues)
+
+	checkedOut := false
+	index := map[int]int{}
+	for i, processed := range plan {
+		index[processed.Number] = i
+		if ctx.Err() != nil {
+			break
+		}
+
+		if processed.Error != nil {
+			continue
+		}
+
+		pr := processed.PullRequest
+		state := watchState{MergeCommitOid: processed.DependedPullRequest.MergeCommit.Oid, HeadRefOid: pr.HeadRefOid}
+		if processed.Chained() {
+			// A chained pull request only moves along with its dependency,
+			// which is then rebased in the same pass.
+			if processed = cascade.Restack(ctx, &opts.Options, processed, plan[index[processed.DependedPullRequest.Number]]); processed.Error != nil {
+				plan[i] = processed
+				continue
+			}
+		} else if handled[pr.Number] == state {
+			plan[i].Error = errHandled
+			continue
+		}
+
+		checkedOut = true
+		processed = cascade.Rebase(ctx, &opts.Options, defaultBranch, processed)
+		if ctx.Err() != nil {
+			// Interrupted mid-way; leave it to be retried by the next run.
+			break
+		}
+		if processed.Pushed {
+			// The pushed head is what the next poll will report for this pull request.
+			if headRefOid, err := cascade.RevParse(ctx, cascade.PullRequestBranch(pr.Number)); err == nil {
+				state.HeadRefOid = headRefOid
+			}
+		}
+		handled[pr.Number] = state
+		plan[i] = processed
+
+		printWatchEvent(processed)
+	}
+
+	if opts.NumberTitles && ctx.Err() == nil {
+		numberTitles(ctx, pullRequests)
+	}
+
+	return checkedOut
+}
+
+func printWatchEvent(pr cascade.ProcessedPullRequest) {
+	if pr.Error != nil {
+		fmt.Fprintf(color.Error, "%s %s #%d %s\n", red("x"), timestamp(), pr.Number, red(pr.Error))
+		return
+	}
+
+	action := "Rebased"
+	if pr.Pushed {
+		action = "Rebased and pushed"
+	}
+	fmt.Fprintf(color.Output, "%s %s %s #%d onto #%d %s\n", green("✔"), timestamp(), action, pr.Number, pr.DependedPullRequest.Number, pr.URL)
+	for _, warning := range pr.Warnings {
+		fmt.Fprintf(color.Output, "             %s\n", hiYellow(warning))
+	}
+}
+
+// printMergeQueueEvents prints the open dependencies of plan whose state in
+// the merge queue changed since it was recorded in queues, and records it.
+// One that left the queue while still open was removed from it, e.g. because
+// the checks of its merge group failed.
+func printMergeQueueEvents(plan []cascade.ProcessedPullRequest, queues map[int]string) {
+	current := map[int]string{}
+	for _, processed := range plan {
+		dependency := processed.DependedPullRequest
+		if dependency == nil || dependency.State != "OPEN" {
+			continue
+		}
+		if _, seen := current[dependency.Number]; seen {
+			continue
+		}
+
+		queue := processed.DependencyMergeQueue
+		current[dependency.Number] = queue.State
+		switch previous := queues[dependency.Number]; {
+		case queue.State == previous:
+		case queue.State == cascade.MergeQueueQueued:
+			fmt.Fprintf(color.Output, "%s %s #%d is at position %d in the merge queue\n", hiBlack("-"), timestamp(), dependency.Number, queue.Position)
+		case queue.State == cascade.MergeQueueMerging:
+			fmt.Fprintf(color.Output, "%s %s #%d is being merged by the merge queue\n", hiBlack("-"), timestamp(), dependency.Number)
+		default:
+			fmt.Fprintf(color.Error, "%s %s #%d was removed from the merge queue without merging\n", hiYellow("!"), timestamp(), dependency.Number)
+		}
+	}
+
+	clear(queues)
+	for number, state := range current {
+		queues[number] = state
+	}
+}
+
+func timestamp() string {
+	return hiBlack(time.Now().Format("15:04:05"))
+}
@@ -0,0 +1,77 @@
+package cascade
+
+import (
+	"context"
+	"fmt"
+)
+
+// InferDependOns infers a dependency for every pull request that declares
+// none from the ancestry of their heads, which must have been fetched: a pull
+// request depends on the pull request whose head is the nearest ancestor of its
+// own head. Heads already contained in base, such as the tip of the default
+// branch, are not considered, and neither are pull requests that have more than
+// one nearest ancestor. The result maps pull requests to their inferred
+// dependency.
+func InferDependOns(ctx context.Context, base string, pullRequests []PullRequest) (map[int]int, error) {
+	// Heads already contained in base would look like an ancestor of every
+	// pull request based on it.
+	var heads []PullRequest
+	for _, pr := range pullRequests {
+		merged, err := IsAncestor(ctx, pr.HeadRefOid, base)
+		if err != nil {
+			return nil, fmt.Errorf("compare #%d with %s: %w", pr.Number, base, err)
+		}
+		if !merged {
+			heads = append(heads, pr)
+		}
+	}
+
+	// isAncestor[a][b] reports whether the head of a is a proper ancestor of
+	// the head of b.
+	isAncestor := map[int]map[int]bool{}
+	for _, a := range heads {
+		isAncestor[a.Number] = map[int]bool{}
+		for _, b := range heads {
+			if a.Number == b.Number || a.HeadRefOid == b.HeadRefOid {
+				continue
+			}
+			ok, err := IsAncestor(ctx, a.HeadRefOid, b.HeadRefOid)
+			if err != nil {
+				return nil, fmt.Errorf("compare #%d with #%d: %w", a.Number, b.Number, err)
+			}
+			isAncestor[a.Number][b.Number] = ok
+		}
+	}
+
+	inferred := map[int]int{}
+	for _, pr := range heads {
+		if len(DependOnsOf(pr)) > 0 {
+			continue
+		}
+
+		var nearest []int
+		for _, candidate := range heads {
+			if !isAncestor[candidate.Number][pr.Number] {
+				continue
+			}
+			// A candidate that is an ancestor of another candidate lies below
+			// it in the stack.
+			below := false
+			for _, other := range heads {
+				if isAncestor[other.Number][pr.Number] && isAncestor[candidate.Number][other.Number] {
+					below = true
+					break
+				}
+			}
+			if !below {
+				nearest = append(nearest, candidate.Number)
+			}
+		}
+
+		if len(nearest) == 1 {
+			inferred[pr.Number] = nearest[0]
+		}
+	}
+
+	return inferred, nil
+}
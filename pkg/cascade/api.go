@@ -0,0 +1,562 @@
+package cascade
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cli/go-gh/v2"
+	"github.com/cli/go-gh/v2/pkg/api"
+	"github.com/cli/go-gh/v2/pkg/auth"
+	"github.com/cli/go-gh/v2/pkg/repository"
+)
+
+// APIForge is the Forge used when gh is not installed, e.g. in minimal
+// containers that only have git and a token, see SetupForge. It talks to the
+// REST and GraphQL APIs of GitHub directly, authenticated with GH_TOKEN,
+// GITHUB_TOKEN or the token gh stored in its configuration, and operates on
+// the repository GH_REPO or the git remotes name, as it knows nothing of
+// `gh repo set-default`. Like GitHubForge, it retries requests that hit a
+// rate limit or a transient server error, see retryDelay.
+type APIForge struct {
+	repo    repository.Repository
+	rest    *api.RESTClient
+	graphQL *api.GraphQLClient
+}
+
+var _ Forge = (*APIForge)(nil)
+
+// NewAPIForge returns an APIForge for repo, and a *CheckError if there is no
+// token for its host.
+func NewAPIForge(repo repository.Repository) (*APIForge, error) {
+	if err := CheckAuth(context.Background(), repo.Host); err != nil {
+		return nil, err
+	}
+	token, _ := auth.TokenForHost(repo.Host)
+
+	opts := api.ClientOptions{Host: repo.Host, AuthToken: token, Transport: loggingTransport{http.DefaultTransport}}
+	rest, err := api.NewRESTClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	graphQL, err := api.NewGraphQLClient(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &APIForge{repo: repo, rest: rest, graphQL: graphQL}, nil
+}
+
+// GhInstalled reports whether the gh executable is found, on the PATH or at
+// GH_PATH.
+func GhInstalled() bool {
+	_, err := gh.Path()
+	return err == nil
+}
+
+// useAPI reports whether GitHub is to be talked to without gh. A replayed run
+// goes through gh, whose commands are answered from the recording.
+func useAPI() bool {
+	return !GhInstalled() && !isReplaying()
+}
+
+// SetupForge falls back on an APIForge for the repository GH_REPO or the git
+// remotes name when gh is not installed. A Forge set with SetForge is left
+// alone.
+func SetupForge(ctx context.Context) error {
+	if _, ok := forge.(GitHubForge); !ok || !useAPI() {
+		return nil
+	}
+
+	repo, err := currentRepository(ctx)
+	if err != nil {
+		return err
+	}
+	f, err := NewAPIForge(repo)
+	if err != nil {
+		return err
+	}
+	SetForge(f)
+
+	return nil
+}
+
+// loggingTransport logs every request the way ghExec logs gh commands.
+type loggingTransport struct {
+	rt http.RoundTripper
+}
+
+func (t loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	started := time.Now()
+	resp, err := t.rt.RoundTrip(req)
+
+	attrs := []any{
+		slog.String("request", Redact(req.Method+" "+req.URL.String())),
+		slog.Duration("duration", time.Since(started)),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", Redact(err.Error())))
+	} else {
+		attrs = append(attrs, slog.Int("status", resp.StatusCode))
+	}
+	slog.Info("http", attrs...)
+
+	return resp, err
+}
+
+// do sends a REST request for path, relative to the repository unless it
+// starts with a slash, with body encoded as JSON unless it is nil, and decodes
+// the response into response unless it is nil.
+func (f *APIForge) do(ctx context.Context, method, path string, body, response any) error {
+	if strings.HasPrefix(path, "/") {
+		path = strings.TrimPrefix(path, "/")
+	} else {
+		path = fmt.Sprintf("repos/%s/%s/%s", f.repo.Owner, f.repo.Name, path)
+	}
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	return withRetries(ctx, method+" "+path, method != http.MethodPost, func(ctx context.Context) error {
+		var reader io.Reader
+		if data != nil {
+			reader = bytes.NewReader(data)
+		}
+		return f.rest.DoWithContext(ctx, method, path, reader, response)
+	})
+}
+
+// query sends a GraphQL query or mutation, with the owner and name of the
+// repository among its variables, and decodes its data into response.
+func (f *APIForge) query(ctx context.Context, query string, variables map[string]any, response any) error {
+	vars := map[string]any{"owner": f.repo.Owner, "name": f.repo.Name}
+	for key, value := range variables {
+		vars[key] = value
+	}
+	// Mutations declare no owner or name, which GraphQL refuses.
+	mutation := strings.HasPrefix(query, "mutation")
+	if mutation {
+		delete(vars, "owner")
+		delete(vars, "name")
+	}
+
+	request := "graphql query"
+	if mutation {
+		request = "graphql mutation"
+	}
+	return withRetries(ctx, request, !mutation, func(ctx context.Context) error {
+		return f.graphQL.DoWithContext(ctx, query, vars, response)
+	})
+}
+
+// withRetries sends a request with send, bounded by the command timeout, and
+// retries it the way ghExec retries gh commands, see retryDelay. request
+// describes it in the logs.
+func withRetries(ctx context.Context, request string, idempotent bool, send func(ctx context.Context) error) error {
+	for attempt := 0; ; attempt++ {
+		cmdCtx, cancel := commandContext(ctx)
+		err := timeoutError(cmdCtx, ctx, send(cmdCtx))
+		cancel()
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+
+		// The headers of a rate-limited response say when to try again.
+		var headers http.Header
+		var httpErr *api.HTTPError
+		if errors.As(err, &httpErr) {
+			headers = httpErr.Headers
+		}
+		wait, retry := retryDelay(ctx, err.Error(), headers, idempotent, attempt)
+		if !retry {
+			return err
+		}
+		slog.Warn("retrying", slog.String("request", Redact(request)), slog.Duration("in", wait), slog.String("error", Redact(err.Error())))
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// isNotFound reports whether err is a GraphQL error for a missing object at
+// path, e.g. repository.pullRequest.
+func isNotFound(err error, path string) bool {
+	var gqlErr *api.GraphQLError
+	return errors.As(err, &gqlErr) && gqlErr.Match("NOT_FOUND", path)
+}
+
+func (f *APIForge) GetBaseRepository(ctx context.Context) (repository.Repository, error) {
+	var data struct {
+		Repository struct {
+			URL string `json:"url"`
+		} `json:"repository"`
+	}
+	// The URL is the one of the repository as it is named now, if it was
+	// renamed or transferred.
+	if err := f.query(ctx, `query($owner: String!, $name: String!) { repository(owner: $owner, name: $name) { url } }`, nil, &data); err != nil {
+		return repository.Repository{}, err
+	}
+
+	return repository.Parse(data.Repository.URL)
+}
+
+func (f *APIForge) GetDefaultBranch(ctx context.Context) (string, error) {
+	var data struct {
+		Repository struct {
+			DefaultBranchRef struct {
+				Name string `json:"name"`
+			} `json:"defaultBranchRef"`
+		} `json:"repository"`
+	}
+	if err := f.query(ctx, `query($owner: String!, $name: String!) { repository(owner: $owner, name: $name) { defaultBranchRef { name } } }`, nil, &data); err != nil {
+		return "", err
+	}
+
+	return data.Repository.DefaultBranchRef.Name, nil
+}
+
+func (f *APIForge) GetViewerLogin(ctx context.Context) (string, error) {
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err := f.do(ctx, http.MethodGet, "/user", nil, &user); err != nil {
+		return "", err
+	}
+
+	return user.Login, nil
+}
+
+func (f *APIForge) CompareCommits(ctx context.Context, base, head string) (Comparison, error) {
+	var comparison struct {
+		Status   string `json:"status"`
+		AheadBy  int    `json:"ahead_by"`
+		BehindBy int    `json:"behind_by"`
+	}
+	if err := f.do(ctx, http.MethodGet, "compare/"+base+"..."+head+"?per_page=1", nil, &comparison); err != nil {
+		return Comparison{}, err
+	}
+
+	return Comparison{Status: comparison.Status, AheadBy: comparison.AheadBy, BehindBy: comparison.BehindBy}, nil
+}
+
+// pullRequestFragment selects the fields of a PullRequest, as gh does for
+// pullRequestFields.
+const pullRequestFragment = `fragment pullRequest on PullRequest {
+  id baseRefName headRefName headRefOid body isDraft number title url state
+  mergeCommit { oid }
+  commits(first: 100) { nodes { commit { oid messageBody } } }
+  lastCommit: commits(last: 1) {
+    nodes {
+      commit {
+        statusCheckRollup {
+          contexts(first: 100) {
+            nodes {
+              __typename
+              ... on CheckRun { name status conclusion }
+              ... on StatusContext { context state }
+            }
+          }
+        }
+      }
+    }
+  }
+  reviewDecision additions deletions isCrossRepository
+  headRepositoryOwner { login }
+  headRepository { name }
+  maintainerCanModify closedAt
+}`
+
+// graphQLPullRequest is a PullRequest as selected by pullRequestFragment,
+// whose commits and checks the API nests deeper than gh prints them.
+type graphQLPullRequest struct {
+	PullRequest
+	Commits struct {
+		Nodes []struct {
+			Commit Commit `json:"commit"`
+		} `json:"nodes"`
+	} `json:"commits"`
+	LastCommit struct {
+		Nodes []struct {
+			Commit struct {
+				StatusCheckRollup *struct {
+					Contexts struct {
+						Nodes []StatusCheck `json:"nodes"`
+					} `json:"contexts"`
+				} `json:"statusCheckRollup"`
+			} `json:"commit"`
+		} `json:"nodes"`
+	} `json:"lastCommit"`
+}
+
+func (p graphQLPullRequest) pullRequest() PullRequest {
+	pr := p.PullRequest
+	for _, node := range p.Commits.Nodes {
+		pr.Commits = append(pr.Commits, node.Commit)
+	}
+	for _, node := range p.LastCommit.Nodes {
+		if rollup := node.Commit.StatusCheckRollup; rollup != nil {
+			pr.StatusCheckRollup = rollup.Contexts.Nodes
+		}
+	}
+	return pr
+}
+
+const searchPullRequestsQuery = `query($query: String!, $first: Int!, $after: String) {
+  search(query: $query, type: ISSUE, first: $first, after: $after) {
+    nodes { ...pullRequest }
+    pageInfo { hasNextPage endCursor }
+  }
+}
+` + pullRequestFragment
+
+func (f *APIForge) ListPullRequests(ctx context.Context, filter PullRequestFilter) ([]PullRequest, error) {
+	return listByAuthor(filter, func(author string, limit int) ([]PullRequest, error) {
+		terms := []string{fmt.Sprintf("repo:%s/%s", f.repo.Owner, f.repo.Name), "is:pr", "is:open", "sort:created-desc"}
+		if author != "" {
+			terms = append(terms, "author:"+author)
+		}
+		if filter.Assignee != "" {
+			terms = append(terms, "assignee:"+filter.Assignee)
+		}
+		for _, label := range filter.Labels {
+			terms = append(terms, "label:"+strconv.Quote(label))
+		}
+		if filter.Milestone != "" {
+			terms = append(terms, "milestone:"+strconv.Quote(filter.Milestone))
+		}
+		if filter.Search != "" {
+			terms = append(terms, filter.Search)
+		}
+
+		var pullRequests []PullRequest
+		variables := map[string]any{"query": strings.Join(terms, " "), "first": min(limit, 100)}
+		for len(pullRequests) < limit {
+			var data struct {
+				Search struct {
+					Nodes    []graphQLPullRequest `json:"nodes"`
+					PageInfo struct {
+						HasNextPage bool   `json:"hasNextPage"`
+						EndCursor   string `json:"endCursor"`
+					} `json:"pageInfo"`
+				} `json:"search"`
+			}
+			if err := f.query(ctx, searchPullRequestsQuery, variables, &data); err != nil {
+				return nil, err
+			}
+			for _, node := range data.Search.Nodes {
+				pullRequests = append(pullRequests, node.pullRequest())
+			}
+			if !data.Search.PageInfo.HasNextPage {
+				break
+			}
+			variables["after"] = data.Search.PageInfo.EndCursor
+		}
+
+		return pullRequests, nil
+	})
+}
+
+const pullRequestQuery = `query($owner: String!, $name: String!, $number: Int!) {
+  repository(owner: $owner, name: $name) {
+    pullRequest(number: $number) { ...pullRequest }
+  }
+}
+` + pullRequestFragment
+
+func (f *APIForge) GetPullRequest(ctx context.Context, number int) (*PullRequest, error) {
+	var data struct {
+		Repository struct {
+			PullRequest graphQLPullRequest `json:"pullRequest"`
+		} `json:"repository"`
+	}
+	err := f.query(ctx, pullRequestQuery, map[string]any{"number": number}, &data)
+	if isNotFound(err, "repository.pullRequest") {
+		return nil, fmt.Errorf("%w: #%d", ErrPullRequestNotFound, number)
+	} else if err != nil {
+		return nil, err
+	}
+
+	pr := data.Repository.PullRequest.pullRequest()
+	return &pr, nil
+}
+
+func (f *APIForge) CreatePullRequest(ctx context.Context, pr NewPullRequest) (*PullRequest, error) {
+	body := map[string]any{"head": pr.Head, "base": pr.Base, "title": pr.Title, "body": pr.Body, "draft": pr.Draft}
+	var created struct {
+		Number int `json:"number"`
+	}
+	if err := f.do(ctx, http.MethodPost, "pulls", body, &created); err != nil {
+		return nil, err
+	}
+
+	return f.GetPullRequest(ctx, created.Number)
+}
+
+func (f *APIForge) UpdatePullRequestBody(ctx context.Context, number int, body string) error {
+	return f.do(ctx, http.MethodPatch, "pulls/"+strconv.Itoa(number), map[string]string{"body": body}, nil)
+}
+
+func (f *APIForge) UpdatePullRequestTitle(ctx context.Context, number int, title string) error {
+	return f.do(ctx, http.MethodPatch, "pulls/"+strconv.Itoa(number), map[string]string{"title": title}, nil)
+}
+
+func (f *APIForge) RetargetPullRequest(ctx context.Context, number int, base string) error {
+	return f.do(ctx, http.MethodPatch, "pulls/"+strconv.Itoa(number), map[string]string{"base": base}, nil)
+}
+
+const markReadyMutation = `mutation($pullRequestId: ID!) {
+  markPullRequestReadyForReview(input: {pullRequestId: $pullRequestId}) {
+    clientMutationId
+  }
+}`
+
+func (f *APIForge) MarkPullRequestReady(ctx context.Context, number int) error {
+	pr, err := f.GetPullRequest(ctx, number)
+	if err != nil {
+		return err
+	}
+
+	return f.query(ctx, markReadyMutation, map[string]any{"pullRequestId": pr.ID}, nil)
+}
+
+func (f *APIForge) EnableAutoMerge(ctx context.Context, pullRequestID, mergeMethod string) error {
+	variables := map[string]any{"pullRequestId": pullRequestID}
+	if mergeMethod != "" {
+		variables["mergeMethod"] = strings.ToUpper(mergeMethod)
+	}
+
+	return f.query(ctx, enableAutoMergeMutation, variables, nil)
+}
+
+func (f *APIForge) MergePullRequest(ctx context.Context, number int, method string) error {
+	return f.do(ctx, http.MethodPut, "pulls/"+strconv.Itoa(number)+"/merge", map[string]string{"merge_method": method}, nil)
+}
+
+func (f *APIForge) GetMergeQueueStatus(ctx context.Context, number int) (MergeQueueStatus, error) {
+	var data mergeQueueData
+	if err := f.query(ctx, mergeQueueQuery, map[string]any{"number": number}, &data); err != nil {
+		return MergeQueueStatus{}, err
+	}
+
+	return data.status(), nil
+}
+
+func (f *APIForge) EnqueuePullRequest(ctx context.Context, pullRequestID, expectedHeadOid string) error {
+	variables := map[string]any{"pullRequestId": pullRequestID}
+	if expectedHeadOid != "" {
+		variables["expectedHeadOid"] = expectedHeadOid
+	}
+
+	return f.query(ctx, enqueuePullRequestMutation, variables, nil)
+}
+
+func (f *APIForge) GetIssue(ctx context.Context, number int) (*Issue, error) {
+	var data struct {
+		Repository struct {
+			Issue Issue `json:"issue"`
+		} `json:"repository"`
+	}
+	err := f.query(ctx, `query($owner: String!, $name: String!, $number: Int!) {
+  repository(owner: $owner, name: $name) {
+    issue(number: $number) { number title url state }
+  }
+}`, map[string]any{"number": number}, &data)
+	if isNotFound(err, "repository.issue") {
+		return nil, fmt.Errorf("%w: #%d", ErrIssueNotFound, number)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &data.Repository.Issue, nil
+}
+
+func (f *APIForge) ListClosingIssues(ctx context.Context, number int) ([]int, error) {
+	var data closingIssuesData
+	if err := f.query(ctx, closingIssuesQuery, map[string]any{"number": number}, &data); err != nil {
+		return nil, err
+	}
+
+	return data.issues(), nil
+}
+
+func (f *APIForge) ListLinkedPullRequests(ctx context.Context, issue int) ([]int, error) {
+	var data linkedPullRequestsData
+	if err := f.query(ctx, linkedPullRequestsQuery, map[string]any{"number": issue}, &data); err != nil {
+		return nil, err
+	}
+
+	return data.pullRequests(issue), nil
+}
+
+func (f *APIForge) ListIssueComments(ctx context.Context, number int) ([]IssueComment, error) {
+	return apiList[IssueComment](ctx, f, fmt.Sprintf("issues/%d/comments", number))
+}
+
+func (f *APIForge) ListReviewComments(ctx context.Context, number int) ([]IssueComment, error) {
+	path := "pulls/" + strconv.Itoa(number)
+	reviews, err := apiList[review](ctx, f, path+"/reviews")
+	if err != nil {
+		return nil, err
+	}
+	comments, err := apiList[IssueComment](ctx, f, path+"/comments")
+	if err != nil {
+		return nil, err
+	}
+
+	return reviewComments(reviews, comments), nil
+}
+
+// apiList returns every item of a paginated REST list of the repository.
+func apiList[T any](ctx context.Context, f *APIForge, path string) ([]T, error) {
+	const perPage = 100
+
+	var items []T
+	for page := 1; ; page++ {
+		var listed []T
+		if err := f.do(ctx, http.MethodGet, fmt.Sprintf("%s?per_page=%d&page=%d", path, perPage, page), nil, &listed); err != nil {
+			return nil, err
+		}
+		items = append(items, listed...)
+		if len(listed) < perPage {
+			return items, nil
+		}
+	}
+}
+
+func (f *APIForge) CreateIssueComment(ctx context.Context, number int, body string) error {
+	return f.do(ctx, http.MethodPost, "issues/"+strconv.Itoa(number)+"/comments", map[string]string{"body": body}, nil)
+}
+
+func (f *APIForge) UpdateIssueComment(ctx context.Context, id int64, body string) error {
+	return f.do(ctx, http.MethodPatch, fmt.Sprintf("issues/comments/%d", id), map[string]string{"body": body}, nil)
+}
+
+// rateLimits is GetRateLimits for an APIForge.
+func (f *APIForge) rateLimits(ctx context.Context) (map[string]RateLimit, error) {
+	var limits struct {
+		Resources map[string]RateLimit `json:"resources"`
+	}
+	// f.rest rather than f.do, which would retry through here.
+	cmdCtx, cancel := commandContext(ctx)
+	defer cancel()
+	if err := timeoutError(cmdCtx, ctx, f.rest.DoWithContext(cmdCtx, http.MethodGet, "rate_limit", nil, &limits)); err != nil {
+		return nil, err
+	}
+
+	return limits.Resources, nil
+}
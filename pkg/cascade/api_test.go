@@ -0,0 +1,103 @@
+package cascade
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/cli/go-gh/v2/pkg/api"
+	"github.com/cli/go-gh/v2/pkg/repository"
+)
+
+// serverTransport sends every request to a test server.
+type serverTransport struct {
+	server *httptest.Server
+}
+
+func (t serverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	u, err := url.Parse(t.server.URL)
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = u.Scheme, u.Host
+	return t.server.Client().Transport.RoundTrip(req)
+}
+
+// newTestAPIForge returns an APIForge for owner/repo that talks to a test
+// server answering with handler.
+func newTestAPIForge(t *testing.T, handler http.HandlerFunc) *APIForge {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	opts := api.ClientOptions{Host: "github.com", AuthToken: "token", Transport: serverTransport{server}}
+	rest, err := api.NewRESTClient(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	graphQL, err := api.NewGraphQLClient(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &APIForge{repo: repository.Repository{Host: "github.com", Owner: "owner", Name: "repo"}, rest: rest, graphQL: graphQL}
+}
+
+func TestAPIForgeRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		call      func(f *APIForge) error
+		wantCalls int
+		wantErr   bool
+	}{
+		{
+			name: "idempotent request",
+			call: func(f *APIForge) error {
+				_, err := f.CompareCommits(context.Background(), "main", "topic")
+				return err
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "query",
+			call: func(f *APIForge) error {
+				_, err := f.GetDefaultBranch(context.Background())
+				return err
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "request that may have been carried out",
+			call: func(f *APIForge) error {
+				return f.CreateIssueComment(context.Background(), 1, "comment")
+			},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			f := newTestAPIForge(t, func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if calls == 1 {
+					http.Error(w, `{"message": "Server Error"}`, http.StatusBadGateway)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"status": "ahead", "data": {"repository": {"defaultBranchRef": {"name": "main"}}}}`))
+			})
+
+			err := tt.call(f)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %t", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("%d requests, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
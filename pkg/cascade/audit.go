@@ -0,0 +1,95 @@
+package cascade
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Actions recorded in an AuditLog.
+const (
+	AuditFetch      = "fetch"
+	AuditCheckout   = "checkout"
+	AuditRebase     = "rebase"
+	AuditPush       = "push"
+	AuditRetarget   = "retarget"
+	AuditComment    = "comment"
+	AuditUpdateBody = "update-body"
+)
+
+// AuditEntry is a line of an AuditLog.
+type AuditEntry struct {
+	Time        time.Time `json:"time"`
+	Action      string    `json:"action"`
+	PullRequest int       `json:"pr,omitempty"`
+	Remote      string    `json:"remote,omitempty"`
+	Branch      string    `json:"branch,omitempty"`
+	// Refs are the refspecs fetched.
+	Refs []string `json:"refs,omitempty"`
+	// Old and New are what the action moved from and to: commits, or base
+	// branches for a retarget.
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+	// Error is set if the action failed. New is then what a push or retarget
+	// attempted, and unset for a rebase, which leaves the branch at Old.
+	Error string `json:"error,omitempty"`
+}
+
+// AuditLog appends an AuditEntry in JSON Lines for every action a run takes
+// on the repository, its remotes or its pull requests, so that it can be told
+// later who moved a branch, and from where to where. Entries are written as
+// they happen, so a run that is interrupted leaves those it got to.
+type AuditLog struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// OpenAuditLog opens the audit log at path, creating it if needed. Entries are
+// appended to those of earlier runs.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+
+	return &AuditLog{f: f}, nil
+}
+
+// Record appends entry, timestamped now. It does nothing on a nil AuditLog.
+// Failing to write is logged rather than returned, as the action it records
+// has already happened.
+func (l *AuditLog) Record(entry AuditEntry) {
+	if l == nil {
+		return
+	}
+
+	entry.Time = time.Now().UTC()
+	// Pull requests from forks without a remote are pushed to a URL.
+	entry.Remote = Redact(entry.Remote)
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err = l.f.Write(append(data, '\n')); err != nil {
+		slog.Warn("failed to write audit log", slog.String("error", err.Error()))
+	}
+}
+
+// Close closes the audit log.
+func (l *AuditLog) Close() error {
+	return l.f.Close()
+}
+
+// errorString returns the message of err, redacted, or "" if it is nil.
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return Redact(err.Error())
+}
@@ -0,0 +1,121 @@
+package cascade
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	// backupRefPrefix holds the tip each branch had before it was last rebased.
+	backupRefPrefix = "refs/cascade/backup/"
+	// remoteBackupRefPrefix holds the remote tip each branch had before the
+	// rebased branch was pushed over it.
+	remoteBackupRefPrefix = "refs/cascade/backup-remote/"
+)
+
+// Backup is a branch tip recorded before a rebase.
+type Backup struct {
+	Branch string
+	Oid    string
+	// RemoteOid is the tip the push replaced, if the rebased branch was pushed.
+	RemoteOid string
+}
+
+// BackupBranch records the current tip of branch under backupRefPrefix,
+// replacing any earlier backup of it.
+func BackupBranch(ctx context.Context, branch string) error {
+	return updateRef(ctx, backupRefPrefix+branch, "refs/heads/"+branch)
+}
+
+// BackupRemoteBranch records oid as the remote tip of branch before it was
+// pushed over.
+func BackupRemoteBranch(ctx context.Context, branch, oid string) error {
+	return updateRef(ctx, remoteBackupRefPrefix+branch, oid)
+}
+
+// ListBackups returns the recorded backups, ordered by branch name.
+func ListBackups(ctx context.Context) ([]Backup, error) {
+	locals, err := listRefs(ctx, backupRefPrefix)
+	if err != nil {
+		return nil, err
+	}
+	remotes, err := listRefs(ctx, remoteBackupRefPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []Backup
+	for _, ref := range locals {
+		branch := strings.TrimPrefix(ref[0], backupRefPrefix)
+		backup := Backup{Branch: branch, Oid: ref[1]}
+		for _, remote := range remotes {
+			if remote[0] == remoteBackupRefPrefix+branch {
+				backup.RemoteOid = remote[1]
+			}
+		}
+		backups = append(backups, backup)
+	}
+
+	return backups, nil
+}
+
+// DeleteBackup removes the backup refs of branch.
+func DeleteBackup(ctx context.Context, branch string) error {
+	if err := deleteRef(ctx, backupRefPrefix+branch); err != nil {
+		return err
+	}
+	return deleteRef(ctx, remoteBackupRefPrefix+branch)
+}
+
+func updateRef(ctx context.Context, ref, rev string) error {
+	_, stderr, err := runGit(ctx, "update-ref", ref, rev)
+	if err != nil {
+		return fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return nil
+}
+
+// deleteRef removes ref. Removing a missing ref is not an error.
+func deleteRef(ctx context.Context, ref string) error {
+	_, stderr, err := runGit(ctx, "update-ref", "-d", ref)
+	if err != nil {
+		return fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return nil
+}
+
+// ListBranches returns the names of the local branches.
+func ListBranches(ctx context.Context) ([]string, error) {
+	refs, err := listRefs(ctx, "refs/heads/")
+	if err != nil {
+		return nil, err
+	}
+
+	branches := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		branches = append(branches, strings.TrimPrefix(ref[0], "refs/heads/"))
+	}
+	return branches, nil
+}
+
+// listRefs returns the name and object id of every ref under prefix.
+func listRefs(ctx context.Context, prefix string) ([][2]string, error) {
+	stdout, stderr, err := runGit(ctx, "for-each-ref", "--format=%(refname) %(objectname)", prefix)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	var refs [][2]string
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		if name, oid, ok := strings.Cut(scanner.Text(), " "); ok {
+			refs = append(refs, [2]string{name, oid})
+		}
+	}
+
+	return refs, scanner.Err()
+}
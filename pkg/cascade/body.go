@@ -0,0 +1,366 @@
+package cascade
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cli/go-gh/v2/pkg/repository"
+)
+
+var defaultDependOnRegexp = regexp.MustCompile(`(?i)depend(?:s|ed|ing)?\s+on:\s+` + referencePattern)
+
+// commentDependOnRegexp is defaultDependOnRegexp for comments, where the
+// colon is optional, as in "this now depends on #12".
+var commentDependOnRegexp = regexp.MustCompile(`(?i)\bdepend(?:s|ed|ing)?\s+on:?\s+` + referencePattern)
+
+// referencePattern matches "#12" as well as
+// "https://github.example.com/owner/repo/pull/12", capturing either the
+// number or the URL.
+const referencePattern = `(?:#(\d+)|(https?://[^\s/]+/[^\s/]+/[^\s/]+/pull/\d+))`
+
+// dependOnPatterns recognize dependency declarations. The first non-empty
+// capture group of each pattern is the number or the URL of the pull request
+// depended on.
+var dependOnPatterns = []*regexp.Regexp{defaultDependOnRegexp}
+
+// dependOnRepository is the repository pull request URLs must point into to
+// count as dependencies. URLs are ignored while it is unset.
+var dependOnRepository repository.Repository
+
+// SetDependOnPatterns replaces the patterns that recognize dependency
+// declarations, which default to "Depends on: #12".
+func SetDependOnPatterns(patterns []*regexp.Regexp) {
+	dependOnPatterns = patterns
+}
+
+// CompileDependOnPatterns builds the dependency patterns from regular
+// expressions and plain keywords such as "Blocked by", which match
+// "Blocked by #12" and "Blocked by: #12" case-insensitively.
+func CompileDependOnPatterns(patterns, keywords []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		if re.NumSubexp() < 1 {
+			return nil, fmt.Errorf("invalid pattern %q: it must capture the pull request number", pattern)
+		}
+		compiled = append(compiled, re)
+	}
+
+	for _, keyword := range keywords {
+		words := strings.Fields(keyword)
+		if len(words) == 0 {
+			continue
+		}
+		for i, word := range words {
+			words[i] = regexp.QuoteMeta(word)
+		}
+		compiled = append(compiled, regexp.MustCompile(`(?i)\b`+strings.Join(words, `\s+`)+`:?\s+`+referencePattern))
+	}
+
+	return compiled, nil
+}
+
+// dependOnMatch is a dependency declaration found in a body.
+type dependOnMatch struct {
+	Start, End int
+	Number     int
+}
+
+// findDependOns returns the dependency declarations in body in order of
+// appearance. Declarations matched by more than one pattern are reported once,
+// and those in code blocks, inline code and blockquotes not at all, see
+// nonProseRanges.
+func findDependOns(body string) []dependOnMatch {
+	return findDependOnsWith(dependOnPatterns, body)
+}
+
+// findDependOnsWith is findDependOns with other patterns.
+func findDependOnsWith(patterns []*regexp.Regexp, body string) []dependOnMatch {
+	ignored := nonProseRanges(body)
+
+	var matches []dependOnMatch
+	for _, re := range patterns {
+		for _, loc := range re.FindAllStringSubmatchIndex(body, -1) {
+			number, ok := parseReference(firstSubmatch(body, loc))
+			if !ok || inRanges(ignored, loc[0]) {
+				continue
+			}
+			matches = append(matches, dependOnMatch{Start: loc[0], End: loc[1], Number: number})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Start < matches[j].Start
+	})
+
+	var deduplicated []dependOnMatch
+	for _, match := range matches {
+		if n := len(deduplicated); n > 0 && match.Start < deduplicated[n-1].End {
+			continue
+		}
+		deduplicated = append(deduplicated, match)
+	}
+
+	return deduplicated
+}
+
+func firstSubmatch(s string, loc []int) string {
+	for i := 2; i+1 < len(loc); i += 2 {
+		if loc[i] >= 0 && loc[i+1] > loc[i] {
+			return s[loc[i]:loc[i+1]]
+		}
+	}
+	return ""
+}
+
+// parseReference returns the pull request number of a reference captured by
+// a dependency pattern: a number, optionally prefixed with "#", or the URL of
+// a pull request of dependOnRepository.
+func parseReference(reference string) (int, bool) {
+	if number, err := strconv.Atoi(strings.TrimPrefix(reference, "#")); err == nil {
+		return number, true
+	}
+
+	u, err := url.Parse(reference)
+	if err != nil || dependOnRepository.Name == "" {
+		return 0, false
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) != 4 || parts[2] != "pull" {
+		return 0, false
+	}
+
+	if !strings.EqualFold(u.Hostname(), dependOnRepository.Host) ||
+		!strings.EqualFold(parts[0], dependOnRepository.Owner) ||
+		!strings.EqualFold(parts[1], dependOnRepository.Name) {
+		return 0, false
+	}
+
+	number, err := strconv.Atoi(parts[3])
+	return number, err == nil
+}
+
+// ParseDependOns returns the pull request numbers declared with "Depends on"
+// lines in body, in order of appearance and without duplicates.
+func ParseDependOns(body string) []int {
+	return matchedNumbers(findDependOns(body))
+}
+
+// ParseCommentDependOns is ParseDependOns for the body of a comment, where
+// the default pattern also matches "depends on #12" without a colon, since
+// comments are more often written in passing. Patterns set with
+// SetDependOnPatterns apply as they are.
+func ParseCommentDependOns(body string) []int {
+	patterns := slices.Clone(dependOnPatterns)
+	for i, re := range patterns {
+		if re == defaultDependOnRegexp {
+			patterns[i] = commentDependOnRegexp
+		}
+	}
+	return matchedNumbers(findDependOnsWith(patterns, body))
+}
+
+// matchedNumbers returns the pull request numbers of matches, without
+// duplicates.
+func matchedNumbers(matches []dependOnMatch) []int {
+	var dependOns []int
+	seen := map[int]bool{}
+	for _, match := range matches {
+		if !seen[match.Number] {
+			seen[match.Number] = true
+			dependOns = append(dependOns, match.Number)
+		}
+	}
+	return dependOns
+}
+
+// dependsOnTrailerRegexp matches Gerrit and Zuul style "Depends-On:" commit
+// message trailers.
+var dependsOnTrailerRegexp = regexp.MustCompile(`(?im)^Depends-On:[ \t]*` + referencePattern + `[ \t]*$`)
+
+// ParseTrailerDependOns returns the pull request numbers declared with
+// "Depends-On:" trailers in a commit message, in order of appearance and
+// without duplicates.
+func ParseTrailerDependOns(message string) []int {
+	var dependOns []int
+	seen := map[int]bool{}
+	for _, loc := range dependsOnTrailerRegexp.FindAllStringSubmatchIndex(message, -1) {
+		if number, ok := parseReference(firstSubmatch(message, loc)); ok && !seen[number] {
+			seen[number] = true
+			dependOns = append(dependOns, number)
+		}
+	}
+	return dependOns
+}
+
+// ParseBodyDependOns returns the pull request numbers declared in the cascade
+// block of body, see Metadata, followed by those declared with "Depends on"
+// lines, without duplicates. An invalid cascade block is ignored.
+func ParseBodyDependOns(body string) []int {
+	var dependOns []int
+	if m, _ := ParseMetadata(body); m != nil {
+		dependOns = m.DependsOn
+	}
+	for _, number := range ParseDependOns(body) {
+		if !slices.Contains(dependOns, number) {
+			dependOns = append(dependOns, number)
+		}
+	}
+	return dependOns
+}
+
+// DependOnsOf returns the pull requests pr depends on: those declared in its
+// body, see ParseBodyDependOns, followed by those declared with "Depends-On:"
+// trailers by the newest of its commits that has any. Trailers of older
+// commits are ignored, since on a branch that contains the commits of its
+// dependencies they declare the dependencies of those.
+func DependOnsOf(pr PullRequest) []int {
+	dependOns := ParseBodyDependOns(pr.Body)
+	seen := map[int]bool{}
+	for _, number := range dependOns {
+		seen[number] = true
+	}
+
+	for i := len(pr.Commits) - 1; i >= 0; i-- {
+		trailers := ParseTrailerDependOns(pr.Commits[i].MessageBody)
+		if len(trailers) == 0 {
+			continue
+		}
+		for _, number := range trailers {
+			if !seen[number] {
+				seen[number] = true
+				dependOns = append(dependOns, number)
+			}
+		}
+		break
+	}
+
+	return dependOns
+}
+
+// AddDependOn appends a "Depends on: #<number>" line to body, the form the
+// default pattern recognizes, or adds number to the cascade block of body if it
+// has a valid one.
+func AddDependOn(body string, number int) string {
+	if m, err := ParseMetadata(body); m != nil && err == nil {
+		return AddMetadataDependOn(body, number)
+	}
+	return addDependOnLine(body, number)
+}
+
+func addDependOnLine(body string, number int) string {
+	line := fmt.Sprintf("Depends on: #%d", number)
+	if body = strings.TrimRight(body, " \t\r\n"); body == "" {
+		return line
+	}
+	return body + "\n\n" + line
+}
+
+// MarkDependencySatisfied strikes through every "Depends on: #<number>" line in
+// body and annotates it as merged. Lines that are already struck through are
+// left untouched, so the result is stable across runs.
+func MarkDependencySatisfied(body string, number int) (string, bool) {
+	return strikeDependOn(body, number, "✅ merged")
+}
+
+// MarkDependencyClosed is MarkDependencySatisfied for a dependency that was
+// closed without merging.
+func MarkDependencyClosed(body string, number int) (string, bool) {
+	return strikeDependOn(body, number, "❌ closed")
+}
+
+// RemoveDependOn removes every declaration of a dependency on number from
+// body, struck through or not, along with its line when nothing else is on it,
+// and from the cascade block of body.
+func RemoveDependOn(body string, number int) (string, bool) {
+	body, changed := removeDependOnLines(body, number)
+	if m, _ := ParseMetadata(body); m != nil && slices.Contains(m.DependsOn, number) {
+		m.DependsOn = slices.DeleteFunc(m.DependsOn, func(n int) bool { return n == number })
+		return SetMetadata(body, *m), true
+	}
+	return body, changed
+}
+
+func removeDependOnLines(body string, number int) (string, bool) {
+	var (
+		b       strings.Builder
+		last    int
+		changed bool
+	)
+
+	for _, match := range findDependOns(body) {
+		if match.Number != number || match.Start < last {
+			continue
+		}
+
+		lineStart := strings.LastIndexByte(body[:match.Start], '\n') + 1
+		lineEnd := len(body)
+		if i := strings.IndexByte(body[match.End:], '\n'); i >= 0 {
+			lineEnd = match.End + i
+		}
+		rest := body[lineStart:match.Start] + body[match.End:lineEnd]
+		rest = strings.NewReplacer("~~", "", "✅ merged", "", "❌ closed", "").Replace(rest)
+
+		if strings.Trim(rest, " \t\r-*") == "" {
+			b.WriteString(body[last:lineStart])
+			last = min(lineEnd+1, len(body))
+		} else {
+			b.WriteString(body[last:match.Start])
+			last = match.End
+		}
+		changed = true
+	}
+
+	if !changed {
+		return body, false
+	}
+
+	// A removed last line would otherwise leave the blank line before it.
+	b.WriteString(body[last:])
+	trimmed := strings.TrimRight(body, " \t\r\n")
+	return strings.TrimRight(b.String(), " \t\r\n") + body[len(trimmed):], true
+}
+
+// strikeDependOn strikes through every declaration of a dependency on number
+// in body that is not already, followed by annotation.
+func strikeDependOn(body string, number int, annotation string) (string, bool) {
+	var (
+		b       strings.Builder
+		last    int
+		changed bool
+	)
+
+	for _, match := range findDependOns(body) {
+		if match.Number != number {
+			continue
+		}
+		if strings.HasSuffix(body[:match.Start], "~~") {
+			continue
+		}
+
+		b.WriteString(body[last:match.Start])
+		b.WriteString("~~" + body[match.Start:match.End] + "~~ " + annotation)
+		last = match.End
+		changed = true
+	}
+
+	if !changed {
+		return body, false
+	}
+
+	b.WriteString(body[last:])
+	return b.String(), true
+}
+
+func UpdatePullRequestBody(ctx context.Context, number int, body string) error {
+	return forge.UpdatePullRequestBody(ctx, number, body)
+}
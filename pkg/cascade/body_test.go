@@ -0,0 +1,95 @@
+package cascade
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseTrailerDependOns(t *testing.T) {
+	tests := []struct {
+		message string
+		want    []int
+	}{
+		{"Depends-On: #12", []int{12}},
+		{"Fix things\n\nDepends-On: #12\nDepends-On: #13", []int{12, 13}},
+		{"depends-on:#12", []int{12}},
+		{"Depends-On: #12\nDepends-On: #12", []int{12}},
+		{"Depends-On: #12 and #13", nil},
+		{"This Depends-On: #12", nil},
+		{"Depends on: #12", nil},
+		{"Depends-On: https://github.com/owner/repo/pull/12", nil},
+		{"No trailers", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			if got := ParseTrailerDependOns(tt.message); !slices.Equal(got, tt.want) {
+				t.Errorf("ParseTrailerDependOns(%q) = %v, want %v", tt.message, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDependOnsOf(t *testing.T) {
+	commits := func(messages ...string) []Commit {
+		var commits []Commit
+		for _, message := range messages {
+			commits = append(commits, Commit{MessageBody: message})
+		}
+		return commits
+	}
+
+	tests := []struct {
+		name string
+		pr   PullRequest
+		want []int
+	}{
+		{
+			name: "nothing declared",
+			pr:   PullRequest{Body: "Fixes things", Commits: commits("Fix things")},
+		},
+		{
+			name: "body",
+			pr:   PullRequest{Body: "Depends on: #1"},
+			want: []int{1},
+		},
+		{
+			name: "cascade block before lines",
+			pr:   PullRequest{Body: "Depends on: #2\n\n```cascade\ndepends-on: [1]\n```"},
+			want: []int{1, 2},
+		},
+		{
+			name: "trailers",
+			pr:   PullRequest{Commits: commits("Depends-On: #1\nDepends-On: #2")},
+			want: []int{1, 2},
+		},
+		{
+			name: "body before trailers",
+			pr:   PullRequest{Body: "Depends on: #2", Commits: commits("Depends-On: #1")},
+			want: []int{2, 1},
+		},
+		{
+			name: "body and trailers without duplicates",
+			pr:   PullRequest{Body: "Depends on: #1", Commits: commits("Depends-On: #1")},
+			want: []int{1},
+		},
+		{
+			name: "newest commit with trailers wins",
+			pr:   PullRequest{Commits: commits("Depends-On: #1", "Depends-On: #2", "Fix review comments")},
+			want: []int{2},
+		},
+		{
+			name: "older trailers are ignored even when newer ones are duplicates",
+			pr:   PullRequest{Body: "Depends on: #2", Commits: commits("Depends-On: #1", "Depends-On: #2")},
+			want: []int{2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DependOnsOf(tt.pr); !slices.Equal(got, tt.want) {
+				t.Errorf("DependOnsOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package cascade
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Cache keeps the pull requests looked up as dependencies between runs, so
+// that repeated runs do not look up the same merged dependencies again. It is
+// a directory of one JSON file per pull request.
+type Cache struct {
+	// Dir holds the cached pull requests of a single repository.
+	Dir string
+	// TTL is how long open and closed pull requests are kept, since they may
+	// still change. Merged ones are kept for good.
+	TTL time.Duration
+}
+
+// cachedPullRequest is the file a pull request is cached in.
+type cachedPullRequest struct {
+	CachedAt    time.Time   `json:"cachedAt"`
+	PullRequest PullRequest `json:"pullRequest"`
+}
+
+func (c *Cache) path(number int) string {
+	return filepath.Join(c.Dir, strconv.Itoa(number)+".json")
+}
+
+// Get returns the cached pull request, and false if it is not cached or has
+// expired.
+func (c *Cache) Get(number int) (*PullRequest, bool) {
+	data, err := os.ReadFile(c.path(number))
+	if err != nil {
+		return nil, false
+	}
+	var cached cachedPullRequest
+	if err = json.Unmarshal(data, &cached); err != nil {
+		return nil, false
+	}
+
+	if cached.PullRequest.State != "MERGED" && time.Since(cached.CachedAt) >= c.TTL {
+		return nil, false
+	}
+	return &cached.PullRequest, true
+}
+
+// Put caches pr. Open and closed pull requests are not cached without a TTL.
+func (c *Cache) Put(pr *PullRequest) error {
+	if pr.State != "MERGED" && c.TTL <= 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(cachedPullRequest{CachedAt: time.Now(), PullRequest: *pr})
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(c.Dir, 0o755); err != nil {
+		return err
+	}
+
+	// Written aside and renamed, so that concurrent runs never read half a
+	// file.
+	f, err := os.CreateTemp(c.Dir, ".pr-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	err = errors.Join(err, f.Close())
+	if err == nil {
+		err = os.Rename(f.Name(), c.path(pr.Number))
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("cache PR #%d: %w", pr.Number, err)
+	}
+	return nil
+}
@@ -0,0 +1,1074 @@
+// Package cascade rebases chains of dependent pull requests: the dependencies
+// declared in pull request bodies are resolved, each pull request is planned
+// against its dependency, and those whose dependency merged are rebased onto
+// the merge commit, pushed and followed up on.
+//
+// Commands run through git and gh in the current working directory, which
+// must be a clean checkout of the repository. Each command is logged to the
+// default slog logger at info level, and its output at debug level.
+package cascade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Options controls how pull requests are planned and rebased.
+type Options struct {
+	// Push force-pushes rebased branches, leased on the head the pull request
+	// was planned at.
+	Push bool
+	// Comment leaves a comment on each rebased pull request. Requires Push.
+	Comment bool
+	// Retarget bases pushed pull requests on the branch they were rebased
+	// onto, e.g. the default branch once their dependency merged. Otherwise
+	// only those whose dependency was abandoned, or that were rebased onto
+	// another branch with Onto, are.
+	Retarget bool
+	// UpdateBody strikes through satisfied dependency declarations.
+	UpdateBody bool
+	// Ready marks rebased draft pull requests as ready for review.
+	Ready bool
+	// AutoMerge is the merge method to enable auto-merge with, or empty.
+	// Pull requests into a branch with a merge queue are instead added to the
+	// queue once their checks pass, and merged as the queue is configured to.
+	// Requires Push.
+	AutoMerge string
+	// RequireChecks skips pull requests whose dependency's checks failed.
+	RequireChecks bool
+	// Exclude are globs of head branches to leave alone.
+	Exclude []string
+	// OnConflict is what to do with pull requests predicted to conflict.
+	// Empty means OnConflictRebase.
+	OnConflict string
+	// PredictConflicts predicts conflicts even when OnConflict is
+	// OnConflictRebase, e.g. to print them along with a plan.
+	PredictConflicts bool
+	// CheckMergeQueue looks up where dependencies that are not merged yet
+	// stand in the merge queue, to tell in the skip and in
+	// ProcessedPullRequest.DependencyMergeQueue.
+	CheckMergeQueue bool
+	// MaxDepth, unless 0, limits how many hops below a merged dependency
+	// pull requests are rebased in one run. Those further down are skipped.
+	MaxDepth int
+	// SkipUnchanged leaves pull requests whose Marker shows that nothing
+	// changed since an earlier run: those whose rebase conflicted then fail
+	// right away, and those rebased without Push are skipped unless their
+	// local branch moved. Markers are recorded either way.
+	SkipUnchanged bool
+	// Rerere resolves conflicts that have a recorded resolution.
+	Rerere bool
+	// RebaseMerges recreates the merge commits of pull requests when
+	// rebasing them. Without it, pull requests with merge commits are
+	// skipped by StrategyRebase, since a rebase would flatten them.
+	RebaseMerges bool
+	// Sign signs rebased commits. They are also signed when commit.gpgSign
+	// is set, as git does on its own.
+	Sign bool
+	// Autosquash folds fixup! and squash! commits of pull requests into the
+	// commits they amend when rebasing them, with StrategyRebase.
+	Autosquash bool
+	// Strategy is how pull requests are moved onto their new base: with
+	// RebaseOntoPullRequest for StrategyRebase,
+	// CherryPickOntoPullRequest for StrategyCherryPick, or
+	// ReplayOntoPullRequest for StrategyMergeTree, which is experimental and
+	// falls back on RebaseOntoPullRequest. Empty means StrategyRebase.
+	Strategy string
+	// Verify is a shell command run in the working tree after each rebase.
+	// Pull requests it fails for are not pushed, and fail.
+	Verify string
+	// MetadataVerify runs the verify command of the Metadata of a pull
+	// request instead of Verify. Otherwise it is ignored with a warning, since
+	// it runs whatever the author of the pull request wrote.
+	MetadataVerify bool
+	// Submodules updates the submodules of pull requests with
+	// UpdateSubmodules once they are checked out and again once rebased, so
+	// that Verify and hooks run against the submodule commits they record.
+	Submodules bool
+	// Hooks map the events in HookEvents to a shell command to run on them
+	// for each pull request, which is described by CASCADE_PR_NUMBER,
+	// CASCADE_PR_BRANCH, CASCADE_PR_URL, CASCADE_DEPENDENCY_NUMBER,
+	// CASCADE_ONTO, CASCADE_OLD_SHA and, once rebased, CASCADE_NEW_SHA
+	// environment variables.
+	Hooks map[string]string
+	// RetargetClosed rebases pull requests whose dependency was closed
+	// without merging onto the branch the dependency was based on.
+	RetargetClosed bool
+	// ClosedIssuesSatisfied treats a dependency on an issue as satisfied once
+	// the issue is closed, leaving the pull request as if it declared none.
+	// Otherwise pull requests depending on issues are always skipped, as
+	// there is nothing to rebase them onto.
+	ClosedIssuesSatisfied bool
+	// AssumeMerged maps dependencies to the commit they are assumed to be
+	// merged at, or to an empty string for the tip of the branch to rebase
+	// onto.
+	AssumeMerged map[int]string
+	// LinkedIssues falls back to LinkedDependOns for pull requests that
+	// declare no dependency.
+	LinkedIssues bool
+	// ScanComments lets the dependencies declared by a comment, see
+	// CommentDependOns, replace those of the body and commits of a pull
+	// request, the newest declaration winning.
+	ScanComments bool
+	// Cache, if set, keeps the dependencies looked up between runs.
+	Cache *Cache
+	// AuditLog, if set, records every fetch, checkout, rebase, push, retarget
+	// and comment of Plan and Rebase.
+	AuditLog *AuditLog
+	// Onto is a branch of FetchRemote to rebase every pull request onto
+	// instead of its base branch, e.g. a release branch, and
+	// OntoPullRequests maps pull requests to one to rebase them onto instead
+	// of Onto. Dependencies that merged into another branch have their
+	// commits dropped.
+	Onto             string
+	OntoPullRequests map[int]string
+	// OntoCommits maps pull requests to a commit to rebase them onto instead
+	// of the merge commit of their dependency or the tip of the branch, e.g.
+	// a known-good commit of it. Chained pull requests follow their
+	// dependency regardless.
+	OntoCommits map[int]string
+	// FetchRemote and PushRemote are the remotes to fetch from and push to.
+	FetchRemote string
+	PushRemote  string
+}
+
+// Plan resolves the dependency of every pull request, skips those in a
+// dependency cycle or deeper than MaxDepth, fetches the default branch, the
+// branches to rebase onto and the heads of the pull requests to rebase and of
+// their dependencies in one go, and then checks each of them with
+// planPullRequest. Pull requests whose result has Error set are left as is,
+// the others are to be passed to Rebase.
+func Plan(ctx context.Context, opts *Options, defaultBranch string, pullRequests []PullRequest) ([]ProcessedPullRequest, error) {
+	plan := ResolveDependencies(ctx, opts, pullRequests)
+
+	skipCycles(plan)
+	stackChains(plan, opts.MaxDepth)
+
+	bases := []string{defaultBranch}
+	overridden := map[string]bool{}
+	for i, processed := range plan {
+		// Chained pull requests stay on the branch of their dependency.
+		if processed.Error != nil || processed.Chained() {
+			continue
+		}
+
+		var ok bool
+		plan[i].Base, ok = opts.ontoBranch(processed, defaultBranch)
+		if ok {
+			overridden[plan[i].Base] = true
+		}
+		if !slices.Contains(bases, plan[i].Base) {
+			bases = append(bases, plan[i].Base)
+		}
+	}
+	if len(bases) > 1 {
+		missing, err := MissingRemoteBranches(ctx, opts.FetchRemote, bases[1:]...)
+		if err != nil {
+			return nil, fmt.Errorf("list branches of %s: %w", opts.FetchRemote, err)
+		}
+
+		var missingOverrides []string
+		for _, branch := range missing {
+			if overridden[branch] {
+				missingOverrides = append(missingOverrides, branch)
+			}
+		}
+		if len(missingOverrides) > 0 {
+			return nil, fmt.Errorf("branches to rebase onto do not exist on %s: %s", opts.FetchRemote, strings.Join(missingOverrides, ", "))
+		}
+
+		// The branch a dependency merged into may have been deleted since,
+		// which only concerns the pull requests based on it.
+		for i, processed := range plan {
+			if processed.Error == nil && slices.Contains(missing, processed.Base) {
+				plan[i].Error = fmt.Errorf("base branch %s does not exist on %s", processed.Base, opts.FetchRemote)
+			}
+		}
+		bases = slices.DeleteFunc(bases, func(base string) bool {
+			return slices.Contains(missing, base)
+		})
+	}
+
+	var refspecs []string
+	for _, base := range bases {
+		refspecs = append(refspecs, "+refs/heads/"+base+":"+RemoteBranchRef(opts.FetchRemote, base))
+	}
+	seen := map[int]bool{}
+	var pairs [][2]string
+	for _, processed := range plan {
+		if processed.Error != nil {
+			continue
+		}
+
+		pr := processed.PullRequest
+		for _, number := range []int{pr.Number, processed.DependedPullRequest.Number} {
+			if !seen[number] {
+				seen[number] = true
+				refspecs = append(refspecs, PullRequestHeadRef(number))
+			}
+		}
+		pairs = append(pairs,
+			[2]string{processed.DependedPullRequest.HeadRefOid, pr.HeadRefOid},
+			[2]string{RemoteBranchRef(opts.FetchRemote, processed.Base), pr.HeadRefOid},
+		)
+	}
+
+	err := fetchHistory(ctx, opts.FetchRemote, refspecs, pairs)
+	opts.AuditLog.Record(AuditEntry{Action: AuditFetch, Remote: opts.FetchRemote, Refs: refspecs, Error: errorString(err)})
+	if err != nil {
+		return nil, fmt.Errorf("fetch from %s: %w", opts.FetchRemote, err)
+	}
+
+	for i, processed := range plan {
+		if processed.Error == nil {
+			plan[i] = planPullRequest(ctx, opts, defaultBranch, processed)
+		}
+	}
+
+	return plan, nil
+}
+
+// ontoBranch returns the branch a pull request returned by ResolveDependency
+// is to be rebased onto, and whether it was set with OntoPullRequests, the
+// base of its Metadata or Onto, in that order. Otherwise, it is the base
+// branch of the pull request, or the one its dependency is based on if the
+// pull request is based on the branch of its dependency, as when stacked.
+func (o *Options) ontoBranch(processed ProcessedPullRequest, defaultBranch string) (string, bool) {
+	if branch := o.OntoPullRequests[processed.Number]; branch != "" {
+		return branch, true
+	}
+	if base := metadataOf(processed.PullRequest).Base; base != "" {
+		return base, true
+	}
+	if o.Onto != "" {
+		return o.Onto, true
+	}
+
+	base := processed.BaseRefName
+	if dependency := processed.DependedPullRequest; dependency != nil && base == dependency.HeadRefName {
+		base = dependency.BaseRefName
+	}
+	if base == "" {
+		base = defaultBranch
+	}
+	return base, false
+}
+
+// skipCycles skips every pull request of plan that depends on itself through
+// a chain of dependencies, naming the cycle. Only dependencies declared by the
+// pull requests of plan and by the dependencies they resolved to are known, so
+// cycles through other pull requests go unnoticed; they are skipped anyway
+// since a pull request in a cycle can never have its dependency merged first.
+func skipCycles(plan []ProcessedPullRequest) {
+	graph := map[int][]int{}
+	for _, processed := range plan {
+		// A pull request depending on itself is reported as such instead.
+		if errors.Is(processed.Error, ErrInvalidDependOn) {
+			continue
+		}
+		// DependOns also holds dependencies found through LinkedIssues.
+		if processed.DependOns != nil {
+			graph[processed.Number] = processed.DependOns
+		} else {
+			graph[processed.Number] = DependOnsOf(processed.PullRequest)
+		}
+	}
+	for _, processed := range plan {
+		if dependency := processed.DependedPullRequest; dependency != nil {
+			if _, ok := graph[dependency.Number]; !ok {
+				graph[dependency.Number] = DependOnsOf(*dependency)
+			}
+		}
+	}
+
+	cycleOf := map[int]string{}
+	for _, cycle := range findCycles(graph) {
+		for _, number := range cycle {
+			if _, ok := cycleOf[number]; !ok {
+				cycleOf[number] = formatCycle(cycle)
+			}
+		}
+	}
+
+	for i, processed := range plan {
+		if cycle, ok := cycleOf[processed.Number]; ok {
+			plan[i].Error = Skipf("dependency cycle %s", cycle)
+		}
+	}
+}
+
+// stackChains sets the Depth of every pull request of plan whose chain reaches
+// a dependency to rebase after, and queues those waiting on an open
+// dependency that is itself to be rebased, after it and onto its new head, see
+// Restack. Those deeper than maxDepth, unless it is 0, are skipped. plan is
+// then ordered by depth, so that each pull request comes after its
+// dependency.
+func stackChains(plan []ProcessedPullRequest, maxDepth int) {
+	depth := map[int]int{}
+	for i, processed := range plan {
+		if processed.Error == nil {
+			plan[i].Depth = 1
+			depth[processed.Number] = 1
+		}
+	}
+
+	// Pull requests waiting on an open dependency are a hop below it, once
+	// its own depth is known.
+	for changed := true; changed; {
+		changed = false
+		for i, processed := range plan {
+			if processed.Depth > 0 || !processed.Chained() {
+				continue
+			}
+			if d := depth[processed.DependedPullRequest.Number]; d > 0 {
+				plan[i].Depth = d + 1
+				depth[processed.Number] = d + 1
+				changed = true
+			}
+		}
+	}
+
+	for i, processed := range plan {
+		if processed.Depth <= 1 {
+			continue
+		}
+		if maxDepth > 0 && processed.Depth > maxDepth {
+			plan[i].Error = Skipf("%d hops below a merged dependency, beyond --max-depth %d", processed.Depth, maxDepth)
+		} else {
+			plan[i].Error = nil
+			plan[i].Base = processed.DependedPullRequest.HeadRefName
+		}
+	}
+
+	slices.SortStableFunc(plan, func(a, b ProcessedPullRequest) int {
+		return max(a.Depth, 1) - max(b.Depth, 1)
+	})
+}
+
+// SkipDescendants skips the pull requests of plan below failed in its chain,
+// those still to be rebased or waiting for it, as rebasing them would be
+// doomed.
+func SkipDescendants(plan []ProcessedPullRequest, failed int) {
+	below := map[int]bool{failed: true}
+	for changed := true; changed; {
+		changed = false
+		for i, processed := range plan {
+			dependency := processed.DependedPullRequest
+			if below[processed.Number] || dependency == nil || !below[dependency.Number] {
+				continue
+			}
+			if processed.Error == nil || (processed.Depth > 1 && processed.Result() == ResultSkipped) {
+				plan[i].Error = Skipf("parent #%d failed", failed)
+				below[processed.Number] = true
+				changed = true
+			}
+		}
+	}
+}
+
+// resolveIssueDependency resolves the dependency of pr on number, which is not
+// a pull request and so may be an issue.
+func resolveIssueDependency(ctx context.Context, opts *Options, pr PullRequest, number int) ProcessedPullRequest {
+	processed := ProcessedPullRequest{PullRequest: pr, DependOns: []int{number}}
+
+	issue, err := GetIssue(ctx, number)
+	switch {
+	case errors.Is(err, ErrIssueNotFound):
+		processed.Error = fmt.Errorf("%w: #%d is not a pull request or issue of this repository", ErrInvalidDependOn, number)
+	case err != nil:
+		processed.Error = fmt.Errorf("failed to get depended issue #%d: %w", number, err)
+	case issue.State == "CLOSED" && opts.ClosedIssuesSatisfied:
+		processed.Error = ErrNoDependOn
+		processed.Warnings = append(processed.Warnings, fmt.Errorf("depends on issue #%d, which is closed", number))
+	default:
+		processed.Error = Skipf("blocked on issue #%d (%s)", number, strings.ToLower(issue.State))
+	}
+	return processed
+}
+
+// replan plans and rebases a pull request again after its head branch moved
+// during the run, so that what was pushed to it since is rebased along instead
+// of overwritten.
+func replan(ctx context.Context, opts *Options, defaultBranch string, processed ProcessedPullRequest) ProcessedPullRequest {
+	pr, err := GetPullRequest(ctx, processed.Number)
+	if err != nil {
+		processed.Warnings = append(processed.Warnings, fmt.Errorf("failed to get PR #%d again: %w", processed.Number, err))
+		return processed
+	}
+	plan, err := Plan(ctx, opts, defaultBranch, []PullRequest{*pr})
+	if err != nil {
+		processed.Warnings = append(processed.Warnings, fmt.Errorf("failed to plan PR #%d again: %w", processed.Number, err))
+		return processed
+	}
+
+	replanned := plan[0]
+	replanned.Warnings = append(replanned.Warnings, fmt.Errorf("%s was pushed to during the run, so it was planned again at %s", pr.HeadRefName, pr.HeadRefOid[:min(7, len(pr.HeadRefOid))]))
+	if replanned.Error != nil {
+		return replanned
+	}
+	return rebase(ctx, opts, defaultBranch, replanned, true)
+}
+
+// planPullRequest decides what a pull request returned by ResolveDependency
+// is rebased onto, skips it if it is already up to date or, with
+// SkipUnchanged, unchanged since an earlier run and, with PredictConflicts or
+// an OnConflict other than OnConflictRebase, predicts whether rebasing it
+// conflicts. The result has Error set unless the pull request is to be
+// rebased.
+func planPullRequest(ctx context.Context, opts *Options, defaultBranch string, processed ProcessedPullRequest) ProcessedPullRequest {
+	var (
+		pr                  = processed.PullRequest
+		dependedPullRequest = processed.DependedPullRequest
+	)
+
+	// The merge commit of a dependency that landed on another branch than
+	// the one to rebase onto would bring that branch along.
+	_, assumed := opts.AssumeMerged[dependedPullRequest.Number]
+	mergedElsewhere := !assumed && dependedPullRequest.BaseRefName != processed.Base
+
+	if processed.Chained() {
+		// Onto is the new head of the dependency, which Restack sets once it
+		// is rebased.
+	} else if commit := opts.OntoCommits[pr.Number]; commit != "" {
+		onto, err := RevParse(ctx, commit+"^{commit}")
+		if err != nil {
+			processed.Error = fmt.Errorf("failed to resolve commit %s to rebase onto: %w", commit, err)
+			return processed
+		}
+		processed.Onto = onto
+
+		// Unlike a merge commit, the commit may well be below the
+		// dependency, whose commits are then still to be dropped.
+		upToDate, err := IsAncestor(ctx, onto, pr.HeadRefOid)
+		if err == nil && upToDate {
+			upToDate, err = IsAncestor(ctx, dependedPullRequest.HeadRefOid, onto)
+			if contained, containedErr := IsAncestor(ctx, dependedPullRequest.HeadRefOid, pr.HeadRefOid); containedErr == nil && !contained {
+				upToDate = true
+			}
+		}
+		if err == nil && upToDate {
+			processed.Error = ErrUpToDate
+			return processed
+		}
+		if onBase, err := IsAncestor(ctx, onto, RemoteBranchRef(opts.FetchRemote, processed.Base)); err == nil && !onBase {
+			processed.Warnings = append(processed.Warnings, fmt.Errorf("commit %s to rebase onto is not on %s/%s", onto[:7], opts.FetchRemote, processed.Base))
+		}
+		if merge := dependedPullRequest.MergeCommit.Oid; dependedPullRequest.State == "MERGED" && merge != "" && !mergedElsewhere {
+			if contained, err := IsAncestor(ctx, merge, onto); err == nil && !contained {
+				processed.Warnings = append(processed.Warnings, fmt.Errorf("commit %s to rebase onto predates the merge commit of depended PR #%d, whose changes are left out", onto[:7], dependedPullRequest.Number))
+			}
+		}
+	} else if dependedPullRequest.MergeCommit.Oid != "" && !mergedElsewhere {
+		processed.Onto = dependedPullRequest.MergeCommit.Oid
+
+		// An error means the merge commit is not available locally, e.g.
+		// because it landed on another branch, in which case the rebase will
+		// tell.
+		if upToDate, err := IsAncestor(ctx, processed.Onto, pr.HeadRefOid); err == nil && upToDate {
+			processed.Error = ErrUpToDate
+			return processed
+		}
+	} else {
+		// The dependency was closed without merging and RetargetClosed is
+		// set, it is assumed to be merged without a commit, or it merged into
+		// another branch: its commits are dropped by rebasing onto the tip of
+		// the branch.
+		onto, err := RevParse(ctx, RemoteBranchRef(opts.FetchRemote, processed.Base))
+		if err != nil {
+			processed.Error = fmt.Errorf("failed to resolve %s/%s: %w", opts.FetchRemote, processed.Base, err)
+			return processed
+		}
+		processed.Onto = onto
+
+		if contained, err := IsAncestor(ctx, dependedPullRequest.HeadRefOid, pr.HeadRefOid); err == nil && !contained {
+			processed.Error = ErrUpToDate
+			return processed
+		}
+		if dependedPullRequest.State == "CLOSED" {
+			processed.Warnings = append(processed.Warnings, fmt.Errorf("depended PR #%d was closed without merging, its commits are dropped", dependedPullRequest.Number))
+		} else if mergedElsewhere {
+			processed.Warnings = append(processed.Warnings, fmt.Errorf("depended PR #%d was merged into %s, its commits are dropped", dependedPullRequest.Number, dependedPullRequest.BaseRefName))
+		}
+	}
+
+	if opts.SkipUnchanged && !processed.Chained() {
+		if processed = skipUnchanged(ctx, opts, processed); processed.Error != nil {
+			return processed
+		}
+	}
+
+	if opts.Push {
+		if _, err := HeadRemote(ctx, pr, opts.FetchRemote, opts.PushRemote); err != nil {
+			processed.Error = err
+			return processed
+		}
+	}
+
+	// Cherry-picks leave merge commits out by design.
+	if opts.Strategy != StrategyCherryPick && !opts.RebaseMerges {
+		merges, err := CountMerges(ctx, dependedPullRequest.HeadRefOid, pr.HeadRefOid)
+		if err != nil {
+			processed.Warnings = append(processed.Warnings, fmt.Errorf("failed to look for merge commits: %w", err))
+		} else if merges > 0 {
+			processed.Error = Skipf("contains merge commits, which a rebase would flatten; give --rebase-merges to keep them or --strategy cherry-pick to leave them out")
+			return processed
+		}
+	}
+
+	// Chained pull requests are predicted by Restack.
+	if processed.Chained() {
+		return processed
+	}
+	return predictConflicts(ctx, opts, processed, opts.OnConflict == OnConflictSkip)
+}
+
+// predictConflicts predicts whether rebasing a planned pull request conflicts,
+// with PredictConflicts or an OnConflict other than OnConflictRebase, and
+// skips it if it does and skip is set.
+func predictConflicts(ctx context.Context, opts *Options, processed ProcessedPullRequest, skip bool) ProcessedPullRequest {
+	if !opts.PredictConflicts && (opts.OnConflict == "" || opts.OnConflict == OnConflictRebase) {
+		return processed
+	}
+
+	dependedPullRequest := processed.DependedPullRequest
+	conflicts, err := PredictConflicts(ctx, processed.Onto, dependedPullRequest.HeadRefOid, processed.HeadRefOid)
+	if err != nil {
+		processed.Warnings = append(processed.Warnings, fmt.Errorf("failed to predict conflicts: %w", err))
+		return processed
+	}
+	processed.Conflicts = conflicts
+
+	if len(conflicts) > 0 && skip {
+		processed.Error = Skipf("rebase onto #%d is predicted to conflict in %s", dependedPullRequest.Number, strings.Join(conflicts, ", "))
+	}
+
+	return processed
+}
+
+// Restack plans a Chained pull request queued by Plan, now that parent, what
+// Rebase returned for its dependency, is known: it is rebased onto the new
+// head of the dependency, the branch returned by PullRequestBranch that the
+// dependency was rebased on, rather than onto the head fetched before the run.
+// A dependency that is up to date may have been rebased by an earlier run,
+// e.g. one with MaxDepth, that left the pull request on its old head. If that
+// head is still backed up, the pull request is rebased onto the head of the
+// dependency instead, with DependedPullRequest.HeadRefOid set to the old one.
+// The result has Error set unless the pull request is to be passed to Rebase.
+// As conflicts can only be predicted now, OnConflictStop skips those predicted
+// to conflict, as OnConflictSkip does.
+func Restack(ctx context.Context, opts *Options, processed, parent ProcessedPullRequest) ProcessedPullRequest {
+	switch {
+	case parent.Error == nil:
+		onto, err := RevParse(ctx, PullRequestBranch(parent.Number))
+		if err != nil {
+			processed.Error = fmt.Errorf("failed to resolve the new head of depended PR #%d: %w", parent.Number, err)
+			return processed
+		}
+		processed.Onto = onto
+	case errors.Is(parent.Error, ErrUpToDate):
+		old, ok := leftBehind(ctx, processed, parent)
+		if !ok {
+			processed.Error = ErrUpToDate
+			return processed
+		}
+		dependency := *processed.DependedPullRequest
+		dependency.HeadRefOid = old
+		processed.DependedPullRequest = &dependency
+		processed.Onto = parent.HeadRefOid
+	default:
+		processed.Error = Skipf("depended PR #%d is not merged, and was not rebased: %s", parent.Number, parent.Error)
+		return processed
+	}
+
+	if upToDate, err := IsAncestor(ctx, processed.Onto, processed.HeadRefOid); err == nil && upToDate {
+		processed.Error = ErrUpToDate
+		return processed
+	}
+	if opts.SkipUnchanged {
+		if processed = skipUnchanged(ctx, opts, processed); processed.Error != nil {
+			return processed
+		}
+	}
+
+	return predictConflicts(ctx, opts, processed, opts.OnConflict == OnConflictSkip || opts.OnConflict == OnConflictStop)
+}
+
+// skipUnchanged sets the Error of a planned pull request whose Marker matches
+// its plan, see Options.SkipUnchanged.
+func skipUnchanged(ctx context.Context, opts *Options, processed ProcessedPullRequest) ProcessedPullRequest {
+	marker, ok, err := ReadMarker(ctx, processed.HeadRefOid)
+	if err != nil {
+		processed.Warnings = append(processed.Warnings, fmt.Errorf("failed to read marker: %w", err))
+		return processed
+	}
+	if !ok || !marker.Matches(processed.Onto, processed.DependedPullRequest.HeadRefOid) {
+		return processed
+	}
+
+	if marker.Conflicted {
+		processed.Error = fmt.Errorf("failed to rebase depended PR #%d: %w onto %s in an earlier run, and nothing changed since", processed.DependedPullRequest.Number, ErrRebaseConflict, processed.Onto[:min(7, len(processed.Onto))])
+	} else if branch := PullRequestBranch(processed.Number); !opts.Push {
+		if tip, err := RevParse(ctx, "refs/heads/"+branch); err == nil && tip == marker.Tip {
+			processed.Error = Skipf("already rebased onto %s in %s by an earlier run; give --push to push it", processed.Onto[:min(7, len(processed.Onto))], branch)
+		}
+	}
+
+	return processed
+}
+
+// resolveConcurrency bounds how many dependencies ResolveDependencies looks up
+// at once.
+const resolveConcurrency = 8
+
+// ResolveDependencies is ResolveDependency for many pull requests, in the same
+// order. Dependencies are looked up concurrently, so the Forge must be safe
+// for concurrent use, and each only once however many pull requests depend on
+// it, or not at all if they are in Options.Cache.
+func ResolveDependencies(ctx context.Context, opts *Options, pullRequests []PullRequest) []ProcessedPullRequest {
+	get := memoizeGetPullRequest(opts.Cache)
+	resolved := make([]ProcessedPullRequest, len(pullRequests))
+
+	sem := make(chan struct{}, resolveConcurrency)
+	var wg sync.WaitGroup
+	for i, pr := range pullRequests {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			resolved[i] = resolveDependency(ctx, opts, pr, get)
+		}()
+	}
+	wg.Wait()
+
+	return resolved
+}
+
+// memoizeGetPullRequest returns a GetPullRequest that looks each pull request
+// up once, even when called concurrently, and returns a copy of it each time.
+// With a cache, pull requests are looked up there first and cached once
+// looked up.
+func memoizeGetPullRequest(cache *Cache) func(context.Context, int) (*PullRequest, error) {
+	type entry struct {
+		once sync.Once
+		pr   *PullRequest
+		err  error
+	}
+	var mu sync.Mutex
+	entries := map[int]*entry{}
+
+	return func(ctx context.Context, number int) (*PullRequest, error) {
+		mu.Lock()
+		e, ok := entries[number]
+		if !ok {
+			e = &entry{}
+			entries[number] = e
+		}
+		mu.Unlock()
+
+		e.once.Do(func() {
+			if cache != nil {
+				var cached bool
+				if e.pr, cached = cache.Get(number); cached {
+					return
+				}
+			}
+			e.pr, e.err = GetPullRequest(ctx, number)
+			if e.err == nil && cache != nil {
+				if err := cache.Put(e.pr); err != nil {
+					slog.Warn("failed to cache", slog.String("error", err.Error()))
+				}
+			}
+		})
+		if e.err != nil {
+			return nil, e.err
+		}
+		pr := *e.pr
+		return &pr, nil
+	}
+}
+
+// ResolveDependency looks up the pull request pr depends on. The result has
+// Error set unless pr is ready to be rebased.
+func ResolveDependency(ctx context.Context, opts *Options, pr PullRequest) ProcessedPullRequest {
+	return resolveDependency(ctx, opts, pr, GetPullRequest)
+}
+
+func resolveDependency(ctx context.Context, opts *Options, pr PullRequest, getPullRequest func(context.Context, int) (*PullRequest, error)) ProcessedPullRequest {
+	for _, pattern := range opts.Exclude {
+		if matched, _ := path.Match(pattern, pr.HeadRefName); matched {
+			return ProcessedPullRequest{
+				PullRequest: pr,
+				Error:       Skipf("branch %s is excluded by %q", pr.HeadRefName, pattern),
+			}
+		}
+	}
+
+	if _, err := ParseMetadata(pr.Body); err != nil {
+		return ProcessedPullRequest{
+			PullRequest: pr,
+			Error:       err,
+		}
+	}
+
+	dependOns := DependOnsOf(pr)
+
+	if opts.ScanComments {
+		commented, err := CommentDependOns(ctx, pr.Number)
+		if err != nil {
+			return ProcessedPullRequest{
+				PullRequest: pr,
+				Error:       err,
+			}
+		}
+		if commented != nil {
+			dependOns = commented
+		}
+	}
+
+	if len(dependOns) == 0 && opts.LinkedIssues {
+		linked, err := LinkedDependOns(ctx, pr.Number)
+		if err != nil {
+			return ProcessedPullRequest{
+				PullRequest: pr,
+				Error:       err,
+			}
+		}
+		dependOns = linked
+	}
+
+	if len(dependOns) == 0 {
+		return ProcessedPullRequest{
+			PullRequest: pr,
+			DependOns:   nil,
+			Error:       ErrNoDependOn,
+		}
+	}
+
+	if len(dependOns) > 1 {
+		return ProcessedPullRequest{
+			PullRequest: pr,
+			DependOns:   dependOns,
+			Error:       Skipf("multiple dependencies found: %v", dependOns),
+		}
+	}
+
+	dependOn := dependOns[0]
+	if dependOn == pr.Number {
+		return ProcessedPullRequest{
+			PullRequest: pr,
+			DependOns:   dependOns,
+			Error:       fmt.Errorf("%w: #%d depends on itself", ErrInvalidDependOn, dependOn),
+		}
+	}
+
+	dependedPullRequest, err := getPullRequest(ctx, dependOn)
+	if errors.Is(err, ErrPullRequestNotFound) {
+		return resolveIssueDependency(ctx, opts, pr, dependOn)
+	} else if err != nil {
+		return ProcessedPullRequest{
+			PullRequest: pr,
+			DependOns:   dependOns,
+			Error:       fmt.Errorf("failed to get depended PR #%d: %w", dependOn, err),
+		}
+	}
+
+	var warnings []error
+	if oid, ok := opts.AssumeMerged[dependOn]; ok {
+		dependedPullRequest.State = "MERGED"
+		dependedPullRequest.MergeCommit.Oid = oid
+		warnings = append(warnings, fmt.Errorf("assumed depended PR #%d to be merged", dependOn))
+	}
+
+	if dependedPullRequest.State == "CLOSED" && !opts.RetargetClosed {
+		return ProcessedPullRequest{
+			PullRequest:         pr,
+			DependOns:           dependOns,
+			DependedPullRequest: dependedPullRequest,
+			Error:               Skipf("depended PR #%d was closed without merging, so this one is abandoned unless --retarget-closed is given", dependOn),
+		}
+	}
+
+	if dependedPullRequest.State != "MERGED" && dependedPullRequest.State != "CLOSED" {
+		processed := ProcessedPullRequest{
+			PullRequest:         pr,
+			DependOns:           dependOns,
+			DependedPullRequest: dependedPullRequest,
+			Error:               Skipf("depended PR #%d is not merged", dependOn),
+		}
+		if opts.CheckMergeQueue {
+			queue, err := GetMergeQueueStatus(ctx, dependOn)
+			switch {
+			case err != nil:
+				processed.Warnings = append(processed.Warnings, fmt.Errorf("failed to check the merge queue for depended PR #%d: %w", dependOn, err))
+			case queue.State == MergeQueueMerging:
+				processed.Error = Skipf("depended PR #%d is being merged by the merge queue", dependOn)
+			case queue.State == MergeQueueQueued:
+				processed.Error = Skipf("depended PR #%d is not merged yet, at position %d in the merge queue", dependOn, queue.Position)
+			}
+			processed.DependencyMergeQueue = queue
+		}
+		return processed
+	}
+
+	if opts.RequireChecks && dependedPullRequest.State == "MERGED" && SummarizeChecks(dependedPullRequest.StatusCheckRollup) == CheckStateFailure {
+		return ProcessedPullRequest{
+			PullRequest:         pr,
+			DependOns:           dependOns,
+			DependedPullRequest: dependedPullRequest,
+			Error:               Skipf("checks of depended PR #%d failed", dependOn),
+		}
+	}
+
+	return ProcessedPullRequest{
+		PullRequest:         pr,
+		DependOns:           dependOns,
+		DependedPullRequest: dependedPullRequest,
+		Warnings:            warnings,
+	}
+}
+
+// leftBehind returns the head parent had before an earlier run rebased it, if
+// processed is still on it rather than on the head of parent.
+func leftBehind(ctx context.Context, processed, parent ProcessedPullRequest) (string, bool) {
+	if on, err := IsAncestor(ctx, parent.HeadRefOid, processed.HeadRefOid); err != nil || on {
+		return "", false
+	}
+	old, err := RevParse(ctx, backupRefPrefix+PullRequestBranch(parent.Number))
+	if err != nil || old == parent.HeadRefOid {
+		return "", false
+	}
+	on, err := IsAncestor(ctx, old, processed.HeadRefOid)
+	return old, err == nil && on
+}
+
+// Rebase rebases a pull request planned by Plan on the branch returned by
+// PullRequestBranch and pushes it, then runs the follow-up actions enabled in
+// opts. It checks the branch out, unless StrategyMergeTree has nothing to run
+// in the working tree, so the workspace should be prepared with
+// PrepareWorkspace. A pull request whose head branch was pushed to since it
+// was listed is planned and rebased once more rather than overwritten.
+// Chained pull requests are to be passed to Restack first.
+func Rebase(ctx context.Context, opts *Options, defaultBranch string, processed ProcessedPullRequest) ProcessedPullRequest {
+	return rebase(ctx, opts, defaultBranch, processed, false)
+}
+
+func rebase(ctx context.Context, opts *Options, defaultBranch string, processed ProcessedPullRequest, replanned bool) ProcessedPullRequest {
+	var (
+		pr                  = processed.PullRequest
+		dependOn            = processed.DependOns[0]
+		dependedPullRequest = processed.DependedPullRequest
+		branch              = PullRequestBranch(pr.Number)
+		err                 error
+	)
+
+	if processed.Onto == "" {
+		processed.Error = fmt.Errorf("not planned onto the new head of depended PR #%d, see Restack", dependOn)
+		return processed
+	}
+
+	metadata := metadataOf(pr)
+	verify := opts.Verify
+	if metadata.Verify != "" {
+		if opts.MetadataVerify {
+			verify = metadata.Verify
+		} else {
+			processed.Warnings = append(processed.Warnings, fmt.Errorf("ignored verify command %q of the cascade block, see --metadata-verify", metadata.Verify))
+		}
+	}
+
+	// StrategyMergeTree leaves the working tree alone unless something is to
+	// run in it.
+	worktree := opts.Strategy != StrategyMergeTree || verify != "" || opts.Hooks[HookPreRebase] != "" || opts.Hooks[HookPostRebase] != ""
+	if worktree {
+		err = CheckoutPullRequest(ctx, pr)
+	} else {
+		err = ResetBranch(ctx, branch, pr.HeadRefOid)
+	}
+	opts.AuditLog.Record(AuditEntry{Action: AuditCheckout, PullRequest: pr.Number, Branch: branch, New: pr.HeadRefOid, Error: errorString(err)})
+	if err != nil {
+		processed.Error = fmt.Errorf("failed to checkout PR #%d: %w", pr.Number, err)
+		return processed
+	}
+	if worktree && opts.Submodules {
+		if err = UpdateSubmodules(ctx); err != nil {
+			processed.Error = fmt.Errorf("failed to update submodules of PR #%d: %w", pr.Number, err)
+			return processed
+		}
+	}
+
+	if err = BackupBranch(ctx, branch); err != nil {
+		processed.Error = fmt.Errorf("failed to back up %s: %w", branch, err)
+		return processed
+	}
+
+	if err = runHook(ctx, opts, HookPreRebase, processed, ""); err != nil {
+		processed.Error = err
+		return processed
+	}
+
+	rebaseOpts := RebaseOptions{
+		Rerere:       opts.Rerere,
+		RebaseMerges: opts.RebaseMerges,
+		Autosquash:   opts.Autosquash,
+		Sign:         opts.Sign,
+	}
+	var resolved bool
+	switch opts.Strategy {
+	case StrategyCherryPick:
+		resolved, err = CherryPickOntoPullRequest(ctx, processed.Onto, dependedPullRequest.HeadRefOid, branch, rebaseOpts)
+	case StrategyMergeTree:
+		resolved, err = replayOrRebase(ctx, processed.Onto, dependedPullRequest.HeadRefOid, pr, rebaseOpts, worktree)
+	default:
+		resolved, err = RebaseOntoPullRequest(ctx, processed.Onto, dependedPullRequest.HeadRefOid, branch, rebaseOpts)
+	}
+	// Conflicts outside of a sparse checkout are written to the working tree,
+	// whether or not they were resolved.
+	if sparseErr := ReapplySparseCheckout(ctx); sparseErr != nil {
+		processed.Warnings = append(processed.Warnings, fmt.Errorf("failed to reapply sparse checkout: %w", sparseErr))
+	}
+	if err != nil {
+		opts.AuditLog.Record(AuditEntry{Action: AuditRebase, PullRequest: pr.Number, Branch: branch, Old: pr.HeadRefOid, Error: errorString(err)})
+		processed.Error = fmt.Errorf("failed to rebase depended PR #%d: %w", dependOn, err)
+		if errors.Is(err, ErrRebaseConflict) {
+			if err = WriteMarker(ctx, pr.HeadRefOid, Marker{Onto: processed.Onto, Dependency: dependedPullRequest.HeadRefOid, Conflicted: true}); err != nil {
+				processed.Warnings = append(processed.Warnings, fmt.Errorf("failed to record marker: %w", err))
+			}
+			if err = runHook(ctx, opts, HookOnConflict, processed, ""); err != nil {
+				processed.Warnings = append(processed.Warnings, err)
+			}
+		}
+		return processed
+	}
+	if resolved {
+		processed.Warnings = append(processed.Warnings, errors.New("resolved conflicts with recorded resolutions, review the result"))
+	}
+	if worktree && opts.Submodules {
+		if err = UpdateSubmodules(ctx); err != nil {
+			processed.Error = fmt.Errorf("failed to update submodules after rebasing: %w", err)
+			return processed
+		}
+	}
+
+	rebased, err := RevParse(ctx, branch)
+	opts.AuditLog.Record(AuditEntry{Action: AuditRebase, PullRequest: pr.Number, Branch: branch, Old: pr.HeadRefOid, New: rebased})
+	if err != nil {
+		processed.Warnings = append(processed.Warnings, fmt.Errorf("failed to compare commits: %w", err))
+	} else if processed.RangeDiff, err = GetRangeDiff(ctx, dependedPullRequest.HeadRefOid, pr.HeadRefOid, processed.Onto, rebased); err != nil {
+		processed.Warnings = append(processed.Warnings, fmt.Errorf("failed to compare commits: %w", err))
+	}
+
+	if err = runHook(ctx, opts, HookPostRebase, processed, rebased); err != nil {
+		processed.Error = err
+		return processed
+	}
+
+	if verify != "" {
+		if output, err := runShell(ctx, verify, nil); err != nil {
+			if line := lastLine(output); line != "" {
+				err = fmt.Errorf("%w: %s", err, line)
+			}
+			processed.Error = fmt.Errorf("verification failed: %w", err)
+			return processed
+		}
+	}
+
+	if opts.Push {
+		remote, err := HeadRemote(ctx, pr, opts.FetchRemote, opts.PushRemote)
+		if err == nil {
+			// A post_rebase hook may have committed on top of the rebase.
+			if pushed, err := RevParse(ctx, branch); err == nil {
+				rebased = pushed
+			}
+			err = PushBranch(ctx, remote, pr.HeadRefName, branch, pr.HeadRefOid)
+			opts.AuditLog.Record(AuditEntry{Action: AuditPush, PullRequest: pr.Number, Remote: remote, Branch: pr.HeadRefName, Old: pr.HeadRefOid, New: rebased, Error: errorString(err)})
+		}
+		if err != nil {
+			processed.Error = fmt.Errorf("failed to push %s: %w", pr.HeadRefName, err)
+			if errors.Is(err, ErrStaleLease) && !replanned {
+				return replan(ctx, opts, defaultBranch, processed)
+			}
+			return processed
+		}
+		processed.Pushed = true
+
+		if err = runHook(ctx, opts, HookPostPush, processed, rebased); err != nil {
+			processed.Warnings = append(processed.Warnings, err)
+		}
+
+		if err = BackupRemoteBranch(ctx, branch, pr.HeadRefOid); err != nil {
+			processed.Warnings = append(processed.Warnings, fmt.Errorf("failed to back up remote tip: %w", err))
+		}
+
+		// A pull request based on the branch of its abandoned dependency
+		// would otherwise still show the dropped commits, and one rebased onto
+		// another branch than its base the commits of its base.
+		_, overridden := opts.ontoBranch(processed, defaultBranch)
+		abandoned := dependedPullRequest.State == "CLOSED" && pr.BaseRefName == dependedPullRequest.HeadRefName
+		if pr.BaseRefName != processed.Base && (abandoned || overridden || opts.Retarget) {
+			err = RetargetPullRequest(ctx, pr.Number, processed.Base)
+			opts.AuditLog.Record(AuditEntry{Action: AuditRetarget, PullRequest: pr.Number, Old: pr.BaseRefName, New: processed.Base, Error: errorString(err)})
+			if err != nil {
+				processed.Warnings = append(processed.Warnings, fmt.Errorf("failed to retarget onto %s: %w", processed.Base, err))
+			} else {
+				processed.BaseRefName = processed.Base
+			}
+		}
+	} else if tip, err := RevParse(ctx, branch); err == nil {
+		if err = WriteMarker(ctx, pr.HeadRefOid, Marker{Onto: processed.Onto, Dependency: dependedPullRequest.HeadRefOid, Tip: tip}); err != nil {
+			processed.Warnings = append(processed.Warnings, fmt.Errorf("failed to record marker: %w", err))
+		}
+	}
+
+	if opts.Comment {
+		body := fmt.Sprintf("Rebased onto %s at %s because #%d was merged.", processed.Base, processed.Onto, dependOn)
+		if processed.Chained() {
+			body = fmt.Sprintf("Rebased onto %s at %s because #%d was rebased.", processed.Base, processed.Onto, dependOn)
+		} else if dependedPullRequest.State == "CLOSED" {
+			body = fmt.Sprintf("Rebased onto %s at %s, dropping the commits of #%d because it was closed without merging.", processed.Base, processed.Onto, dependOn)
+		}
+		err = UpsertCascadeComment(ctx, pr.Number, body)
+		opts.AuditLog.Record(AuditEntry{Action: AuditComment, PullRequest: pr.Number, Error: errorString(err)})
+		if err != nil {
+			processed.Warnings = append(processed.Warnings, fmt.Errorf("failed to comment: %w", err))
+		}
+	}
+
+	if opts.UpdateBody && dependedPullRequest.State == "MERGED" {
+		if body, changed := MarkDependencySatisfied(pr.Body, dependOn); changed {
+			err = UpdatePullRequestBody(ctx, pr.Number, body)
+			opts.AuditLog.Record(AuditEntry{Action: AuditUpdateBody, PullRequest: pr.Number, Error: errorString(err)})
+			if err != nil {
+				processed.Warnings = append(processed.Warnings, fmt.Errorf("failed to update body: %w", err))
+			}
+		}
+	}
+
+	if opts.Ready && pr.IsDraft {
+		if err = MarkPullRequestReady(ctx, pr.Number); err != nil {
+			processed.Warnings = append(processed.Warnings, fmt.Errorf("failed to mark ready for review: %w", err))
+		} else {
+			processed.IsDraft = false
+		}
+	}
+
+	autoMerge := opts.AutoMerge
+	if opts.Push && metadata.AutoMerge != "" {
+		autoMerge = metadata.AutoMerge
+	}
+	if autoMerge != "" && autoMerge != AutoMergeOff {
+		if err = enableAutoMerge(ctx, pr, autoMerge); err != nil {
+			processed.Warnings = append(processed.Warnings, fmt.Errorf("failed to enable auto-merge: %w", err))
+		}
+	}
+
+	return processed
+}
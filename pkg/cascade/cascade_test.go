@@ -0,0 +1,257 @@
+package cascade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestResolveDependency(t *testing.T) {
+	merged := &PullRequest{Number: 1, State: "MERGED", BaseRefName: "main"}
+	merged.MergeCommit.Oid = "merge1"
+
+	tests := []struct {
+		name     string
+		opts     Options
+		pr       PullRequest
+		want     string
+		wantSkip bool
+	}{
+		{
+			name:     "no dependency",
+			pr:       PullRequest{Number: 10, Body: "Fixes things"},
+			want:     ErrNoDependOn.Error(),
+			wantSkip: true,
+		},
+		{
+			name: "merged dependency",
+			pr:   PullRequest{Number: 10, Body: "Depends on: #1"},
+		},
+		{
+			name:     "open dependency",
+			pr:       PullRequest{Number: 10, Body: "Depends on: #2"},
+			want:     "depended PR #2 is not merged",
+			wantSkip: true,
+		},
+		{
+			name:     "closed dependency",
+			pr:       PullRequest{Number: 10, Body: "Depends on: #3"},
+			want:     "depended PR #3 was closed without merging, so this one is abandoned unless --retarget-closed is given",
+			wantSkip: true,
+		},
+		{
+			name: "closed dependency with RetargetClosed",
+			opts: Options{RetargetClosed: true},
+			pr:   PullRequest{Number: 10, Body: "Depends on: #3"},
+		},
+		{
+			name: "open dependency assumed merged",
+			opts: Options{AssumeMerged: map[int]string{2: "merge2"}},
+			pr:   PullRequest{Number: 10, Body: "Depends on: #2"},
+		},
+		{
+			name:     "multiple dependencies",
+			pr:       PullRequest{Number: 10, Body: "Depends on: #1\nDepends on: #2"},
+			want:     "multiple dependencies found: [1 2]",
+			wantSkip: true,
+		},
+		{
+			name: "dependency on itself",
+			pr:   PullRequest{Number: 10, Body: "Depends on: #10"},
+			want: "invalid dependency: #10 depends on itself",
+		},
+		{
+			name:     "excluded branch",
+			opts:     Options{Exclude: []string{"wip/*"}},
+			pr:       PullRequest{Number: 10, HeadRefName: "wip/feature", Body: "Depends on: #1"},
+			want:     `branch wip/feature is excluded by "wip/*"`,
+			wantSkip: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeForge(t, &fakeForge{pullRequests: map[int]*PullRequest{
+				1: merged,
+				2: {Number: 2, State: "OPEN", BaseRefName: "main"},
+				3: {Number: 3, State: "CLOSED", BaseRefName: "main"},
+			}})
+
+			got := ResolveDependency(context.Background(), &tt.opts, tt.pr)
+			if errorString(got.Error) != tt.want {
+				t.Fatalf("Error = %q, want %q", errorString(got.Error), tt.want)
+			}
+			var skipErr *SkipError
+			if isSkip := errors.As(got.Error, &skipErr); isSkip != tt.wantSkip {
+				t.Errorf("skipped = %t, want %t", isSkip, tt.wantSkip)
+			}
+			if tt.want == "" && got.DependedPullRequest == nil {
+				t.Error("DependedPullRequest is not set")
+			}
+		})
+	}
+}
+
+func TestRestack(t *testing.T) {
+	const (
+		head      = "head10"
+		oldParent = "old1"
+		newParent = "new1"
+	)
+	processed := ProcessedPullRequest{
+		PullRequest:         PullRequest{Number: 10, HeadRefOid: head},
+		DependedPullRequest: &PullRequest{Number: 1, HeadRefOid: oldParent},
+	}
+
+	tests := []struct {
+		name      string
+		parent    ProcessedPullRequest
+		responses map[string]fakeGitResponse
+		want      string
+		wantOnto  string
+		// wantDependencyHead is the head of the dependency the pull request
+		// is rebased from.
+		wantDependencyHead string
+	}{
+		{
+			name:   "dependency rebased",
+			parent: ProcessedPullRequest{PullRequest: PullRequest{Number: 1, HeadRefOid: oldParent}},
+			responses: map[string]fakeGitResponse{
+				"rev-parse --verify cascade/1":          {stdout: newParent + "\n"},
+				"merge-base --is-ancestor new1 " + head: {exitCode: 1},
+			},
+			wantOnto:           newParent,
+			wantDependencyHead: oldParent,
+		},
+		{
+			name:   "already on the rebased dependency",
+			parent: ProcessedPullRequest{PullRequest: PullRequest{Number: 1, HeadRefOid: oldParent}},
+			responses: map[string]fakeGitResponse{
+				"rev-parse --verify cascade/1":          {stdout: newParent + "\n"},
+				"merge-base --is-ancestor new1 " + head: {},
+			},
+			want: ErrUpToDate.Error(),
+		},
+		{
+			name:   "dependency failed",
+			parent: ProcessedPullRequest{PullRequest: PullRequest{Number: 1}, Error: errors.New("conflict")},
+			want:   "depended PR #1 is not merged, and was not rebased: conflict",
+		},
+		{
+			name:   "dependency up to date",
+			parent: ProcessedPullRequest{PullRequest: PullRequest{Number: 1, HeadRefOid: newParent}, Error: ErrUpToDate},
+			responses: map[string]fakeGitResponse{
+				"merge-base --is-ancestor new1 " + head: {},
+			},
+			want: ErrUpToDate.Error(),
+		},
+		{
+			name:   "left behind by an earlier run",
+			parent: ProcessedPullRequest{PullRequest: PullRequest{Number: 1, HeadRefOid: newParent}, Error: ErrUpToDate},
+			responses: map[string]fakeGitResponse{
+				"merge-base --is-ancestor new1 " + head:            {exitCode: 1},
+				"rev-parse --verify refs/cascade/backup/cascade/1": {stdout: "backup1\n"},
+				"merge-base --is-ancestor backup1 " + head:         {},
+			},
+			wantOnto:           newParent,
+			wantDependencyHead: "backup1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeGitRunner(t, &fakeGitRunner{responses: tt.responses})
+
+			got := Restack(context.Background(), &Options{}, processed, tt.parent)
+			if errorString(got.Error) != tt.want {
+				t.Fatalf("Error = %q, want %q", errorString(got.Error), tt.want)
+			}
+			if tt.want != "" {
+				return
+			}
+			if got.Onto != tt.wantOnto {
+				t.Errorf("Onto = %q, want %q", got.Onto, tt.wantOnto)
+			}
+			if got.DependedPullRequest.HeadRefOid != tt.wantDependencyHead {
+				t.Errorf("DependedPullRequest.HeadRefOid = %q, want %q", got.DependedPullRequest.HeadRefOid, tt.wantDependencyHead)
+			}
+		})
+	}
+}
+
+func TestSkipCycles(t *testing.T) {
+	dependingOn := func(number int, body string) ProcessedPullRequest {
+		return ProcessedPullRequest{PullRequest: PullRequest{Number: number, Body: body}}
+	}
+
+	tests := []struct {
+		name string
+		plan []ProcessedPullRequest
+		// want maps pull requests to their error, which is "" for those left
+		// alone.
+		want map[int]string
+	}{
+		{
+			name: "no cycle",
+			plan: []ProcessedPullRequest{dependingOn(10, "Depends on: #1"), dependingOn(11, "Depends on: #10")},
+			want: map[int]string{10: "", 11: ""},
+		},
+		{
+			name: "two pull requests",
+			plan: []ProcessedPullRequest{dependingOn(11, "Depends on: #10"), dependingOn(10, "Depends on: #11")},
+			want: map[int]string{10: "dependency cycle #10 → #11 → #10", 11: "dependency cycle #10 → #11 → #10"},
+		},
+		{
+			name: "depending on a cycle",
+			plan: []ProcessedPullRequest{dependingOn(10, "Depends on: #11"), dependingOn(11, "Depends on: #10"), dependingOn(12, "Depends on: #10")},
+			want: map[int]string{10: "dependency cycle #10 → #11 → #10", 11: "dependency cycle #10 → #11 → #10", 12: ""},
+		},
+		{
+			name: "through a dependency outside of the plan",
+			plan: []ProcessedPullRequest{
+				{
+					PullRequest:         PullRequest{Number: 10, Body: "Depends on: #11"},
+					DependedPullRequest: &PullRequest{Number: 11, Body: "Depends on: #12"},
+				},
+				dependingOn(12, "Depends on: #10"),
+			},
+			want: map[int]string{10: "dependency cycle #10 → #11 → #12 → #10", 12: "dependency cycle #10 → #11 → #12 → #10"},
+		},
+		{
+			name: "dependencies found through linked issues",
+			plan: []ProcessedPullRequest{
+				{PullRequest: PullRequest{Number: 10, Body: "Fixes #5"}, DependOns: []int{11}},
+				dependingOn(11, "Depends on: #10"),
+			},
+			want: map[int]string{10: "dependency cycle #10 → #11 → #10", 11: "dependency cycle #10 → #11 → #10"},
+		},
+		{
+			name: "commit trailers",
+			plan: []ProcessedPullRequest{
+				{PullRequest: PullRequest{Number: 10, Commits: []Commit{{MessageBody: "Depends-On: #11"}}}},
+				dependingOn(11, "Depends on: #10"),
+			},
+			want: map[int]string{10: "dependency cycle #10 → #11 → #10", 11: "dependency cycle #10 → #11 → #10"},
+		},
+		{
+			name: "depending on itself",
+			plan: []ProcessedPullRequest{
+				{PullRequest: PullRequest{Number: 10, Body: "Depends on: #10"}, Error: fmt.Errorf("%w: #10 depends on itself", ErrInvalidDependOn)},
+			},
+			want: map[int]string{10: "invalid dependency: #10 depends on itself"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			skipCycles(tt.plan)
+
+			for _, processed := range tt.plan {
+				if got := errorString(processed.Error); got != tt.want[processed.Number] {
+					t.Errorf("#%d: Error = %q, want %q", processed.Number, got, tt.want[processed.Number])
+				}
+			}
+		})
+	}
+}
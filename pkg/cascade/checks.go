@@ -0,0 +1,105 @@
+package cascade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type CheckState string
+
+const (
+	CheckStateNone    CheckState = "NONE"
+	CheckStatePending CheckState = "PENDING"
+	CheckStateSuccess CheckState = "SUCCESS"
+	CheckStateFailure CheckState = "FAILURE"
+)
+
+// StatusCheck is an entry of a pull request's statusCheckRollup. Check runs
+// report Status and Conclusion, commit statuses report State.
+type StatusCheck struct {
+	TypeName   string `json:"__typename"`
+	Name       string `json:"name"`
+	Context    string `json:"context"`
+	Status     string `json:"status"`
+	Conclusion string `json:"conclusion"`
+	State      string `json:"state"`
+}
+
+// SummarizeChecks folds a statusCheckRollup into a single state. Any failure
+// wins over pending checks, which win over success.
+func SummarizeChecks(checks []StatusCheck) CheckState {
+	if len(checks) == 0 {
+		return CheckStateNone
+	}
+
+	state := CheckStateSuccess
+	for _, check := range checks {
+		switch check.TypeName {
+		case "StatusContext":
+			switch check.State {
+			case "SUCCESS":
+			case "PENDING", "EXPECTED":
+				state = CheckStatePending
+			default:
+				return CheckStateFailure
+			}
+		default:
+			if check.Status != "COMPLETED" {
+				state = CheckStatePending
+				continue
+			}
+			switch check.Conclusion {
+			case "SUCCESS", "NEUTRAL", "SKIPPED":
+			default:
+				return CheckStateFailure
+			}
+		}
+	}
+
+	return state
+}
+
+// checksGracePeriod is how long WaitForChecks waits for checks to be reported
+// before assuming the repository has none configured.
+const checksGracePeriod = time.Minute
+
+// WaitForChecks polls the checks of the pull request until all of them pass,
+// one of them fails, or timeout elapses. When headOid is set, checks reported
+// for any other commit are ignored, so a stale green rollup from before a
+// force-push is never mistaken for the new one.
+func WaitForChecks(ctx context.Context, number int, headOid string, interval, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	started := time.Now()
+	for {
+		pr, err := GetPullRequest(ctx, number)
+		if err != nil {
+			return err
+		}
+
+		if headOid == "" || pr.HeadRefOid == headOid {
+			switch SummarizeChecks(pr.StatusCheckRollup) {
+			case CheckStateSuccess:
+				return nil
+			case CheckStateFailure:
+				return errors.New("checks failed")
+			case CheckStateNone:
+				if time.Since(started) > checksGracePeriod {
+					return nil
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("timed out after %s waiting for checks", timeout)
+			}
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
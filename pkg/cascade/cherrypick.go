@@ -0,0 +1,95 @@
+package cascade
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// How pull requests are moved onto their new base, see Options.Strategy.
+const (
+	StrategyRebase     = "rebase"
+	StrategyCherryPick = "cherry-pick"
+	StrategyMergeTree  = "merge-tree"
+)
+
+// CherryPickOntoPullRequest recreates topicBranch from targetBase and
+// cherry-picks the commits of topicBranch after oldParent onto it, one by
+// one. Only first parents are followed, so merge commits and the commits they
+// brought in are left out, and commits whose change is already in targetBase
+// or that end up empty are dropped.
+// Conflicts are handled as by RebaseOntoPullRequest. Of opts, only Rerere and
+// Sign apply.
+func CherryPickOntoPullRequest(ctx context.Context, targetBase, oldParent, topicBranch string, opts RebaseOptions) (bool, error) {
+	tip, err := RevParse(ctx, topicBranch)
+	if err != nil {
+		return false, err
+	}
+
+	stdout, stderr, err := runGit(ctx, "rev-list", "--reverse", "--first-parent", "--no-merges", oldParent+".."+tip)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+	upstream, err := ListUpstreamCommits(ctx, targetBase, tip, oldParent)
+	if err != nil {
+		return false, err
+	}
+	var commits []string
+	for _, commit := range strings.Fields(stdout.String()) {
+		if !upstream[commit] {
+			commits = append(commits, commit)
+		}
+	}
+
+	if _, stderr, err = runGit(ctx, "checkout", "--quiet", "-B", topicBranch, targetBase); err != nil {
+		return false, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+	if len(commits) == 0 {
+		return false, nil
+	}
+
+	config := []string{"-c", "core.editor=true"}
+	if opts.Rerere {
+		config = append(config, "-c", "rerere.enabled=true", "-c", "rerere.autoUpdate=true")
+	}
+	if opts.Sign {
+		config = append(config, "-c", "commit.gpgSign=true")
+	}
+
+	_, stderr, err = runGit(ctx, append(config, append([]string{"cherry-pick"}, commits...)...)...)
+
+	resolved := false
+	for err != nil {
+		if strings.Contains(stderr.String(), "is now empty") {
+			_, stderr, err = runGit(ctx, append(config, "cherry-pick", "--skip")...)
+			continue
+		}
+		if !opts.Rerere || !strings.Contains(stderr.String(), "could not apply") {
+			break
+		}
+		unmerged, unmergedErr := ListUnmergedPaths(ctx)
+		if unmergedErr != nil || len(unmerged) > 0 {
+			break
+		}
+
+		resolved = true
+		_, stderr, err = runGit(ctx, append(config, "cherry-pick", "--continue")...)
+	}
+
+	if err != nil {
+		// As with an aborted rebase, the branch is left at its old tip, even
+		// when ctx was cancelled by Ctrl-C.
+		ctx := context.WithoutCancel(ctx)
+		_, _, _ = runGit(ctx, "cherry-pick", "--abort")
+		_, _, _ = runGit(ctx, "checkout", "--quiet", "-B", topicBranch, tip)
+
+		if isSigningFailure(stderr.String()) {
+			return false, signingError(stderr.String(), err)
+		} else if strings.Contains(stderr.String(), "could not apply") {
+			return false, fmt.Errorf("%w while cherry-picking %s onto %s (old parent: %s)", ErrRebaseConflict, topicBranch, targetBase, oldParent[:7])
+		}
+		return false, fmt.Errorf("%s: %w", stderr.String(), err)
+	}
+
+	return resolved, nil
+}
@@ -0,0 +1,87 @@
+package cascade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// tokenCredentialHelper is the git credential helper that answers with the
+// token in GH_TOKEN, read when git asks rather than stored in the
+// configuration.
+const tokenCredentialHelper = `!f() { test "$1" = get && echo username=x-access-token && echo "password=$GH_TOKEN"; }; f`
+
+// The identity GitHub uses for commits made with the Actions token.
+const (
+	actionsBotName  = "github-actions[bot]"
+	actionsBotEmail = "41898282+github-actions[bot]@users.noreply.github.com"
+)
+
+// SetupCI prepares a fresh, non-interactive checkout (typically in GitHub
+// Actions) for a run: gh authenticates from the environment, git can push with
+// the same token, and rebased commits have a committer.
+func SetupCI(ctx context.Context, remote string) error {
+	if os.Getenv("GH_TOKEN") == "" {
+		token := os.Getenv("GITHUB_TOKEN")
+		if token == "" {
+			return errors.New("GH_TOKEN or GITHUB_TOKEN must be set in --ci mode")
+		}
+		if err := os.Setenv("GH_TOKEN", token); err != nil {
+			return err
+		}
+	}
+
+	if os.Getenv("GITHUB_ACTIONS") == "true" {
+		// Lets git authenticate through gh even when the checkout didn't
+		// persist credentials.
+		if err := setupGitCredentials(ctx); err != nil {
+			return fmt.Errorf("configure git credentials: %w", err)
+		}
+	}
+
+	// Rebasing rewrites committers, which fails on runners without an identity.
+	// Shallow checkouts are deepened by Plan as far as rebasing needs.
+	if _, _, err := runGit(ctx, "config", "user.email"); err != nil {
+		for key, value := range map[string]string{
+			"GIT_COMMITTER_NAME":  actionsBotName,
+			"GIT_COMMITTER_EMAIL": actionsBotEmail,
+		} {
+			if os.Getenv(key) == "" {
+				if err = os.Setenv(key, value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// setupGitCredentials has git authenticate to the host of the base repository
+// with GH_TOKEN, through gh auth setup-git or, without gh, with
+// tokenCredentialHelper in the configuration of the repository.
+func setupGitCredentials(ctx context.Context) error {
+	if !useAPI() {
+		if _, stderr, err := ghExec(ctx, "auth", "setup-git"); err != nil {
+			return fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+		}
+		return nil
+	}
+
+	host := apiHost
+	if host == "" {
+		host = "github.com"
+	}
+	key := "credential.https://" + host + ".helper"
+	// The empty helper drops those configured globally, as gh auth setup-git
+	// does.
+	for _, args := range [][]string{{"config", "--replace-all", key, ""}, {"config", "--add", key, tokenCredentialHelper}} {
+		if _, stderr, err := runGit(ctx, args...); err != nil {
+			return fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+		}
+	}
+
+	return nil
+}
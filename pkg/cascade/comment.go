@@ -0,0 +1,138 @@
+package cascade
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// cascadeCommentMarker identifies comments left by gh-cascade so that later
+// runs update them instead of posting new ones.
+const cascadeCommentMarker = "<!-- gh-cascade -->"
+
+type IssueComment struct {
+	ID   int64  `json:"id"`
+	Body string `json:"body"`
+	User struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// review is a pull request review as the REST API returns it.
+type review struct {
+	ID   int64  `json:"id"`
+	Body string `json:"body"`
+	User struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	SubmittedAt time.Time `json:"submitted_at"`
+}
+
+// reviewComments merges the reviews with a body and the review comments of a
+// pull request into comments, oldest first.
+func reviewComments(reviews []review, comments []IssueComment) []IssueComment {
+	for _, r := range reviews {
+		if strings.TrimSpace(r.Body) == "" {
+			continue
+		}
+		comment := IssueComment{ID: r.ID, Body: r.Body, CreatedAt: r.SubmittedAt}
+		comment.User.Login = r.User.Login
+		comments = append(comments, comment)
+	}
+	sort.SliceStable(comments, func(i, j int) bool {
+		return comments[i].CreatedAt.Before(comments[j].CreatedAt)
+	})
+	return comments
+}
+
+// UpsertCascadeComment replaces the body of the previous cascade comment on the
+// pull request, or creates one if there is none yet.
+func UpsertCascadeComment(ctx context.Context, number int, body string) error {
+	login, err := GetViewerLogin(ctx)
+	if err != nil {
+		return fmt.Errorf("resolve current user: %w", err)
+	}
+
+	comments, err := ListIssueComments(ctx, number)
+	if err != nil {
+		return fmt.Errorf("list comments: %w", err)
+	}
+
+	body = cascadeCommentMarker + "\n" + body
+
+	for _, comment := range comments {
+		if comment.User.Login != login || !strings.Contains(comment.Body, cascadeCommentMarker) {
+			continue
+		}
+
+		return UpdateIssueComment(ctx, comment.ID, body)
+	}
+
+	return CreateIssueComment(ctx, number, body)
+}
+
+// CreateIssueComment comments on an issue or pull request.
+func CreateIssueComment(ctx context.Context, number int, body string) error {
+	return forge.CreateIssueComment(ctx, number, body)
+}
+
+// UpdateIssueComment replaces the body of a comment.
+func UpdateIssueComment(ctx context.Context, id int64, body string) error {
+	return forge.UpdateIssueComment(ctx, id, body)
+}
+
+func ListIssueComments(ctx context.Context, number int) ([]IssueComment, error) {
+	return forge.ListIssueComments(ctx, number)
+}
+
+func ListReviewComments(ctx context.Context, number int) ([]IssueComment, error) {
+	return forge.ListReviewComments(ctx, number)
+}
+
+// CommentDependOns returns the dependencies declared by the newest comment on
+// a pull request that declares any, as ParseCommentDependOns finds them, or
+// nil if none does. Both its comments and its reviews count. Comments left by
+// gh-cascade are ignored.
+func CommentDependOns(ctx context.Context, number int) ([]int, error) {
+	comments, err := ListIssueComments(ctx, number)
+	if err != nil {
+		return nil, fmt.Errorf("list comments of #%d: %w", number, err)
+	}
+	reviews, err := ListReviewComments(ctx, number)
+	if err != nil {
+		return nil, fmt.Errorf("list review comments of #%d: %w", number, err)
+	}
+	comments = append(comments, reviews...)
+	sort.SliceStable(comments, func(i, j int) bool {
+		return comments[i].CreatedAt.Before(comments[j].CreatedAt)
+	})
+
+	for i := len(comments) - 1; i >= 0; i-- {
+		if strings.Contains(comments[i].Body, cascadeCommentMarker) {
+			continue
+		}
+		if dependOns := ParseCommentDependOns(comments[i].Body); len(dependOns) > 0 {
+			return dependOns, nil
+		}
+	}
+	return nil, nil
+}
+
+var viewerLogin string
+
+func GetViewerLogin(ctx context.Context) (string, error) {
+	if viewerLogin != "" {
+		return viewerLogin, nil
+	}
+
+	login, err := forge.GetViewerLogin(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	viewerLogin = login
+	return viewerLogin, nil
+}
@@ -0,0 +1,100 @@
+package cascade
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseCommentDependOns(t *testing.T) {
+	tests := []struct {
+		body string
+		want []int
+	}{
+		{"This now depends on #456", []int{456}},
+		{"Depends on: #12", []int{12}},
+		{"depending on #3 and then on #4", []int{3}},
+		{"It is independent on #5", nil},
+		{"> this depends on #6", nil},
+		{"`depends on #7`", nil},
+		{"No dependency here", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			if got := ParseCommentDependOns(tt.body); !slices.Equal(got, tt.want) {
+				t.Errorf("ParseCommentDependOns(%q) = %v, want %v", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommentDependOns(t *testing.T) {
+	at := func(minutes int) time.Time {
+		return time.Date(2026, 1, 1, 0, minutes, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name           string
+		issueComments  []IssueComment
+		reviewComments []IssueComment
+		want           []int
+	}{
+		{
+			name: "no comments",
+		},
+		{
+			name:          "newest comment wins",
+			issueComments: []IssueComment{{Body: "depends on #1", CreatedAt: at(1)}, {Body: "depends on #2", CreatedAt: at(2)}},
+			want:          []int{2},
+		},
+		{
+			name:           "review newer than comment",
+			issueComments:  []IssueComment{{Body: "depends on #1", CreatedAt: at(1)}},
+			reviewComments: []IssueComment{{Body: "this now depends on #3", CreatedAt: at(3)}},
+			want:           []int{3},
+		},
+		{
+			name:           "comment newer than review",
+			issueComments:  []IssueComment{{Body: "depends on #4", CreatedAt: at(4)}},
+			reviewComments: []IssueComment{{Body: "depends on #3", CreatedAt: at(3)}},
+			want:           []int{4},
+		},
+		{
+			name:          "comments of gh cascade are ignored",
+			issueComments: []IssueComment{{Body: "depends on #1", CreatedAt: at(1)}, {Body: cascadeCommentMarker + "\nRebased, depends on #2", CreatedAt: at(2)}},
+			want:          []int{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeForge(t, &fakeForge{
+				issueComments:  map[int][]IssueComment{1: tt.issueComments},
+				reviewComments: map[int][]IssueComment{1: tt.reviewComments},
+			})
+
+			got, err := CommentDependOns(context.Background(), 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("CommentDependOns() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReviewComments(t *testing.T) {
+	reviews := []review{{ID: 1, Body: "depends on #2", SubmittedAt: time.Unix(20, 0)}, {ID: 2, Body: " ", SubmittedAt: time.Unix(5, 0)}}
+	comments := []IssueComment{{ID: 3, CreatedAt: time.Unix(10, 0)}}
+
+	var ids []int64
+	for _, comment := range reviewComments(reviews, comments) {
+		ids = append(ids, comment.ID)
+	}
+	if want := []int64{3, 1}; !slices.Equal(ids, want) {
+		t.Errorf("reviewComments() = %v, want %v", ids, want)
+	}
+}
@@ -0,0 +1,100 @@
+package cascade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// What to do with pull requests predicted to conflict, see Options.OnConflict.
+const (
+	OnConflictRebase = "rebase"
+	OnConflictSkip   = "skip"
+	OnConflictStop   = "stop"
+)
+
+// PullRequestHeadRef is the ref GitHub keeps the head of a pull request
+// under, including pull requests from forks.
+func PullRequestHeadRef(number int) string {
+	return "refs/pull/" + strconv.Itoa(number) + "/head"
+}
+
+// RemoteBranchRef is the remote-tracking ref of branch on remote.
+func RemoteBranchRef(remote, branch string) string {
+	return "refs/remotes/" + remote + "/" + branch
+}
+
+// FetchRefs fetches all refspecs from remote with a single fetch.
+func FetchRefs(ctx context.Context, remote string, refspecs ...string) error {
+	args := append([]string{"fetch", "--no-tags", remote}, refspecs...)
+
+	_, stderr, err := runGit(ctx, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return nil
+}
+
+// MissingRemoteBranches returns the branches that do not exist on remote.
+func MissingRemoteBranches(ctx context.Context, remote string, branches ...string) ([]string, error) {
+	args := []string{"ls-remote", "--heads", remote}
+	for _, branch := range branches {
+		args = append(args, "refs/heads/"+branch)
+	}
+
+	stdout, stderr, err := runGit(ctx, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	found := map[string]bool{}
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		// <oid>\trefs/heads/<branch>
+		if _, ref, ok := strings.Cut(line, "\t"); ok {
+			found[strings.TrimPrefix(ref, "refs/heads/")] = true
+		}
+	}
+
+	var missing []string
+	for _, branch := range branches {
+		if !found[branch] {
+			missing = append(missing, branch)
+		}
+	}
+	return missing, nil
+}
+
+// PredictConflicts returns the files that replaying the commits between
+// oldParent and tip onto targetBase would conflict in. It merges the whole
+// range with merge-ort instead of replaying it commit by commit, so nothing is
+// checked out, at the cost of missing conflicts that a later commit resolves.
+// It requires git 2.40 or later.
+func PredictConflicts(ctx context.Context, targetBase, oldParent, tip string) ([]string, error) {
+	stdout, stderr, err := runGit(ctx, "merge-tree", "--write-tree", "--name-only", "--no-messages", "--merge-base="+oldParent, targetBase, tip)
+	if err == nil {
+		return nil, nil
+	}
+
+	// merge-tree exits with 1 when the merge is not clean, and prints the
+	// tree followed by the conflicted files.
+	if exitCode(err) != 1 {
+		if strings.Contains(stderr.String(), "unknown option") {
+			return nil, errors.New("git 2.40 or later is required")
+		}
+		return nil, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	lines := strings.Split(stdout.String(), "\n")
+	var files []string
+	for _, line := range lines[1:] {
+		if line == "" {
+			break
+		}
+		files = append(files, line)
+	}
+
+	return files, nil
+}
@@ -0,0 +1,106 @@
+package cascade
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// NewPullRequest describes a pull request to open.
+type NewPullRequest struct {
+	// Head is the branch to merge, prefixed with "<owner>:" when it lives in
+	// a fork.
+	Head  string
+	Base  string
+	Title string
+	Body  string
+	Draft bool
+}
+
+func CreatePullRequest(ctx context.Context, pr NewPullRequest) (*PullRequest, error) {
+	return forge.CreatePullRequest(ctx, pr)
+}
+
+// InferBranchStack returns the local branches tip is stacked on, bottom
+// first and ending with tip: starting from tip, each branch is stacked on the
+// local branch whose tip is its nearest ancestor, until none is left that is
+// not already contained in base. The branches cascade rebases pull requests on
+// are not considered. It fails if a branch has more than one nearest ancestor.
+func InferBranchStack(ctx context.Context, tip, base string) ([]string, error) {
+	refs, err := listRefs(ctx, "refs/heads/")
+	if err != nil {
+		return nil, err
+	}
+
+	oids := map[string]string{}
+	var candidates []string
+	for _, ref := range refs {
+		branch := strings.TrimPrefix(ref[0], "refs/heads/")
+		if _, ok := ParsePullRequestBranch(branch); ok {
+			continue
+		}
+		oids[branch] = ref[1]
+		if branch == tip {
+			continue
+		}
+		merged, err := IsAncestor(ctx, ref[1], base)
+		if err != nil {
+			return nil, err
+		}
+		if !merged {
+			candidates = append(candidates, branch)
+		}
+	}
+	if _, ok := oids[tip]; !ok {
+		return nil, fmt.Errorf("branch %s not found", tip)
+	}
+
+	stack := []string{tip}
+	for current := tip; ; {
+		var ancestors []string
+		for _, branch := range candidates {
+			if oids[branch] == oids[current] {
+				continue
+			}
+			ok, err := IsAncestor(ctx, oids[branch], oids[current])
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				ancestors = append(ancestors, branch)
+			}
+		}
+
+		// The nearest ancestors are those no other ancestor descends from.
+		var nearest []string
+		for _, branch := range ancestors {
+			below := false
+			for _, other := range ancestors {
+				if other == branch || oids[other] == oids[branch] {
+					continue
+				}
+				ok, err := IsAncestor(ctx, oids[branch], oids[other])
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					below = true
+					break
+				}
+			}
+			if !below {
+				nearest = append(nearest, branch)
+			}
+		}
+
+		switch len(nearest) {
+		case 0:
+			return stack, nil
+		case 1:
+			current = nearest[0]
+			stack = append([]string{current}, stack...)
+		default:
+			return nil, fmt.Errorf("%s is stacked on more than one branch: %s", current, strings.Join(nearest, ", "))
+		}
+	}
+}
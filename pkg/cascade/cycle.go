@@ -0,0 +1,95 @@
+package cascade
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// findCycles returns the cycles of graph, which maps pull requests to the
+// pull requests they depend on. Each cycle is the path from its lowest
+// numbered member around to the member it closes on, e.g. [12 13] for #12
+// depending on #13 and #13 on #12. Cycles are returned in order of their first
+// member.
+func findCycles(graph map[int][]int) [][]int {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	nodes := make([]int, 0, len(graph))
+	for node := range graph {
+		nodes = append(nodes, node)
+	}
+	sort.Ints(nodes)
+
+	var (
+		cycles [][]int
+		seen   = map[string]bool{}
+		state  = map[int]int{}
+		path   []int
+		visit  func(node int)
+	)
+	visit = func(node int) {
+		state[node] = visiting
+		path = append(path, node)
+
+		edges := append([]int(nil), graph[node]...)
+		sort.Ints(edges)
+		for _, next := range edges {
+			switch state[next] {
+			case unvisited:
+				visit(next)
+			case visiting:
+				// next is on the path, so the path from it back to node closes
+				// a cycle.
+				for i := len(path) - 1; i >= 0; i-- {
+					if path[i] == next {
+						cycle := rotateCycle(path[i:])
+						if key := fmt.Sprint(cycle); !seen[key] {
+							seen[key] = true
+							cycles = append(cycles, cycle)
+						}
+						break
+					}
+				}
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[node] = visited
+	}
+
+	for _, node := range nodes {
+		if state[node] == unvisited {
+			visit(node)
+		}
+	}
+
+	sort.SliceStable(cycles, func(i, j int) bool {
+		return cycles[i][0] < cycles[j][0]
+	})
+
+	return cycles
+}
+
+// rotateCycle returns a copy of cycle starting at its lowest member.
+func rotateCycle(cycle []int) []int {
+	lowest := 0
+	for i, node := range cycle {
+		if node < cycle[lowest] {
+			lowest = i
+		}
+	}
+	return append(append([]int(nil), cycle[lowest:]...), cycle[:lowest]...)
+}
+
+// formatCycle formats a cycle returned by findCycles as "#12 → #13 → #12".
+func formatCycle(cycle []int) string {
+	parts := make([]string, 0, len(cycle)+1)
+	for _, node := range append(cycle, cycle[0]) {
+		parts = append(parts, fmt.Sprintf("#%d", node))
+	}
+	return strings.Join(parts, " → ")
+}
@@ -0,0 +1,324 @@
+package cascade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/cli/go-gh/v2/pkg/auth"
+	"github.com/cli/go-gh/v2/pkg/repository"
+	"github.com/cli/safeexec"
+)
+
+var (
+	// minGitVersion is the oldest git every command works with, the first
+	// to drop commits a rebase empties when asked to.
+	minGitVersion = [3]int{2, 26, 0}
+	// predictGitVersion is the oldest git that can predict conflicts, see
+	// Options.PredictConflicts.
+	predictGitVersion = [3]int{2, 40, 0}
+	// minGhVersion is the oldest gh every command works with.
+	minGhVersion = [3]int{2, 0, 0}
+)
+
+// CheckError is a problem with the environment gh cascade runs in, along with
+// how to fix it.
+type CheckError struct {
+	Err error
+	Fix string
+}
+
+func (e *CheckError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CheckError) Unwrap() error {
+	return e.Err
+}
+
+// CheckGit returns the version of git, and a *CheckError if it is missing or
+// too old. warning is set for a git every command but conflict prediction
+// works with.
+func CheckGit(ctx context.Context) (version, warning string, err error) {
+	stdout, stderr, err := runGit(ctx, "version")
+	if errors.Is(err, exec.ErrNotFound) {
+		return "", "", &CheckError{Err: errors.New("git is not installed"), Fix: "install git: https://git-scm.com/downloads"}
+	} else if err != nil {
+		return "", "", fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	// git version 2.43.0, or 2.39.3 (Apple Git-146), or 2.43.0.windows.1
+	version = strings.TrimPrefix(strings.TrimSpace(stdout.String()), "git version ")
+	parsed, ok := parseVersion(version)
+	if !ok {
+		return version, "", nil
+	}
+	if olderThan(parsed, minGitVersion) {
+		return version, "", &CheckError{Err: fmt.Errorf("git %s is too old", version), Fix: "upgrade git to " + formatVersion(minGitVersion) + " or later: https://git-scm.com/downloads"}
+	}
+	if olderThan(parsed, predictGitVersion) {
+		warning = "conflict prediction of --dry-run and --on-conflict requires git " + formatVersion(predictGitVersion) + " or later"
+	}
+
+	return version, warning, nil
+}
+
+// CheckGh returns the version of gh, and a *CheckError if it is missing or
+// too old.
+func CheckGh(ctx context.Context) (string, error) {
+	stdout, stderr, err := ghExec(ctx, "--version")
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return "", &CheckError{Err: errors.New("gh is not installed"), Fix: "install the GitHub CLI: https://cli.github.com"}
+		}
+		return "", fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	// gh version 2.40.1 (2023-12-13)
+	fields := strings.Fields(stdout.String())
+	if len(fields) < 3 {
+		return "", nil
+	}
+	version := fields[2]
+	if parsed, ok := parseVersion(version); ok && olderThan(parsed, minGhVersion) {
+		return version, &CheckError{Err: fmt.Errorf("gh %s is too old", version), Fix: "upgrade gh to " + formatVersion(minGhVersion) + " or later: https://cli.github.com"}
+	}
+
+	return version, nil
+}
+
+// CheckWorkTree returns the root of the working tree, and a *CheckError if the
+// working directory is not inside one.
+func CheckWorkTree(ctx context.Context) (string, error) {
+	root, err := RepositoryRoot(ctx)
+	if err != nil {
+		return "", &CheckError{Err: errors.New("not a git repository"), Fix: "run gh cascade in a clone of the repository whose pull requests to cascade"}
+	}
+
+	return root, nil
+}
+
+// CheckRemoteHost returns the host of the repository to operate on, taken
+// from GH_REPO or else the git remotes, and a *CheckError if neither names a
+// GitHub repository.
+func CheckRemoteHost(ctx context.Context) (string, error) {
+	repo, err := currentRepository(ctx)
+	return repo.Host, err
+}
+
+// currentRepository returns the repository GH_REPO names, or else that of the
+// preferred git remote, as CheckRemoteHost describes.
+func currentRepository(ctx context.Context) (repository.Repository, error) {
+	if override := os.Getenv("GH_REPO"); override != "" {
+		return parseRepository(override)
+	}
+
+	remotes, err := ListRemotes(ctx)
+	if err != nil {
+		return repository.Repository{}, fmt.Errorf("list remotes: %w", err)
+	}
+	if len(remotes) == 0 {
+		return repository.Repository{}, &CheckError{Err: errors.New("no git remote points to a GitHub repository"), Fix: "add one with git remote add origin https://github.com/OWNER/REPO.git, or set GH_REPO=OWNER/REPO"}
+	}
+
+	name := preferredRemote(remotes)
+	for _, remote := range remotes {
+		if remote.Name == name {
+			return remote.Repository, nil
+		}
+	}
+	return remotes[0].Repository, nil
+}
+
+// CheckAuth returns a *CheckError if gh is not logged in to host, or its token
+// is no longer valid. Without gh, it checks that there is a token for host for
+// an APIForge to use instead.
+func CheckAuth(ctx context.Context, host string) error {
+	if useAPI() {
+		if token, _ := auth.TokenForHost(host); token == "" {
+			return &CheckError{Err: fmt.Errorf("gh is not installed, and no token for %s is set", host), Fix: "set GH_TOKEN, or install the GitHub CLI: https://cli.github.com"}
+		}
+		return nil
+	}
+
+	if _, _, err := ghExec(ctx, "auth", "status", "--hostname", host); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return &CheckError{Err: errors.New("gh is not installed"), Fix: "install the GitHub CLI: https://cli.github.com"}
+		} else if ctx.Err() != nil {
+			return err
+		}
+		return &CheckError{Err: fmt.Errorf("gh is not logged in to %s", host), Fix: "run gh auth login --hostname " + host + ", or set GH_TOKEN"}
+	}
+
+	return nil
+}
+
+// CheckPushAccess returns a *CheckError if pushing to remote is refused. It
+// pushes with --dry-run, so nothing is sent.
+func CheckPushAccess(ctx context.Context, remote string) error {
+	_, stderr, err := runGit(ctx, "push", "--dry-run", "--quiet", remote, "HEAD:refs/heads/cascade/doctor")
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		return &CheckError{
+			Err: fmt.Errorf("cannot push to %s: %s", remote, lastLine(stderr.Bytes())),
+			Fix: "ask for write access, or fork the repository with gh repo fork --remote and push to the fork",
+		}
+	}
+
+	return nil
+}
+
+// IsRerereEnabled reports whether git records the resolutions of conflicts,
+// which --rerere replays.
+func IsRerereEnabled(ctx context.Context) (bool, error) {
+	enabled, err := getConfig(ctx, "--bool", "rerere.enabled")
+	return enabled == "true", err
+}
+
+// CheckSigning returns the format rebased commits are signed in, or "" if
+// they are not, and a *CheckError if they are to be signed, because of sign or
+// commit.gpgSign, but cannot be: the signing program is missing or, for SSH,
+// no key is configured.
+func CheckSigning(ctx context.Context, sign bool) (string, error) {
+	if !sign {
+		enabled, err := getConfig(ctx, "--bool", "commit.gpgSign")
+		if err != nil || enabled != "true" {
+			return "", err
+		}
+	}
+
+	format, err := getConfig(ctx, "gpg.format")
+	if err != nil {
+		return "", err
+	}
+	if format == "" {
+		format = "openpgp"
+	}
+
+	program, err := getConfig(ctx, "gpg."+format+".program")
+	if err == nil && program == "" && format == "openpgp" {
+		program, err = getConfig(ctx, "gpg.program")
+	}
+	if err != nil {
+		return "", err
+	}
+	if program == "" {
+		program = map[string]string{"openpgp": "gpg", "x509": "gpgsm", "ssh": "ssh-keygen"}[format]
+	}
+	if _, err := safeexec.LookPath(program); program != "" && err != nil {
+		return format, &CheckError{
+			Err: fmt.Errorf("cannot sign commits: %s is not installed", program),
+			Fix: fmt.Sprintf("install %s, or point git config gpg.%s.program to it", program, format),
+		}
+	}
+
+	if format == "ssh" {
+		key, err := getConfig(ctx, "user.signingKey")
+		if err != nil {
+			return format, err
+		}
+		if key == "" {
+			return format, &CheckError{
+				Err: errors.New("cannot sign commits: no SSH key is configured"),
+				Fix: "git config user.signingKey ~/.ssh/id_ed25519.pub",
+			}
+		}
+	}
+
+	return format, nil
+}
+
+// getConfig returns the value of a git configuration key, or "" if it is not
+// set. args are passed to git config before the key, e.g. --bool.
+func getConfig(ctx context.Context, args ...string) (string, error) {
+	stdout, stderr, err := runGit(ctx, append([]string{"config"}, args...)...)
+	if exitCode(err) == 1 {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// CheckWorktrees returns a *CheckError if git worktree does not work, e.g.
+// when the repository is bare.
+func CheckWorktrees(ctx context.Context) error {
+	if _, stderr, err := runGit(ctx, "worktree", "list", "--porcelain"); err != nil {
+		return &CheckError{Err: fmt.Errorf("git worktree is unavailable: %s", lastLine(stderr.Bytes())), Fix: "upgrade git, or use a regular clone"}
+	}
+
+	return nil
+}
+
+// Preflight checks that the working directory is inside a git repository,
+// that it or GH_REPO names a GitHub repository and that gh is logged in to
+// its host, so that commands report a missing login or repository as such
+// rather than as a failed command halfway through. Errors are *CheckError.
+// Without gh, it sets up an APIForge, see SetupForge.
+func Preflight(ctx context.Context) error {
+	if _, err := CheckWorkTree(ctx); err != nil {
+		return err
+	}
+	host, err := CheckRemoteHost(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := CheckAuth(ctx, host); err != nil {
+		return err
+	}
+
+	return SetupForge(ctx)
+}
+
+// parseRepository parses a repository given as GH_REPO is.
+func parseRepository(s string) (repository.Repository, error) {
+	repo, err := repository.Parse(s)
+	if err != nil {
+		return repository.Repository{}, &CheckError{Err: fmt.Errorf("invalid GH_REPO %q: %w", s, err), Fix: "set GH_REPO to OWNER/REPO or HOST/OWNER/REPO"}
+	}
+
+	return repo, nil
+}
+
+// parseVersion parses the leading major.minor.patch of a version.
+func parseVersion(s string) ([3]int, bool) {
+	var version [3]int
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return version, false
+	}
+	parts := strings.SplitN(fields[0], ".", 4)
+	if len(parts) < 2 {
+		return version, false
+	}
+	for i := 0; i < len(parts) && i < 3; i++ {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return version, false
+		}
+		version[i] = n
+	}
+
+	return version, true
+}
+
+func olderThan(a, b [3]int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+func formatVersion(v [3]int) string {
+	return fmt.Sprintf("%d.%d", v[0], v[1])
+}
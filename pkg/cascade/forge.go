@@ -0,0 +1,73 @@
+package cascade
+
+import (
+	"context"
+
+	"github.com/cli/go-gh/v2/pkg/repository"
+)
+
+// Forge is the code host pull requests live on. Every call the package makes
+// to it goes through the Forge set with SetForge, which defaults to
+// GitHubForge, so it can be replaced with a fake in tests or with a client of
+// another API. It must be safe for concurrent use.
+type Forge interface {
+	// GetBaseRepository returns the repository pull requests are listed in.
+	GetBaseRepository(ctx context.Context) (repository.Repository, error)
+	GetDefaultBranch(ctx context.Context) (string, error)
+	// GetViewerLogin returns the login of the authenticated user.
+	GetViewerLogin(ctx context.Context) (string, error)
+	// CompareCommits compares head with base, which may be commits or
+	// branches.
+	CompareCommits(ctx context.Context, base, head string) (Comparison, error)
+
+	// ListPullRequests returns the open pull requests that match filter,
+	// newest first.
+	ListPullRequests(ctx context.Context, filter PullRequestFilter) ([]PullRequest, error)
+	// GetPullRequest returns a pull request in any state, or an error
+	// wrapping ErrPullRequestNotFound if there is none with number.
+	GetPullRequest(ctx context.Context, number int) (*PullRequest, error)
+	// CreatePullRequest opens a pull request and returns it.
+	CreatePullRequest(ctx context.Context, pr NewPullRequest) (*PullRequest, error)
+	UpdatePullRequestBody(ctx context.Context, number int, body string) error
+	UpdatePullRequestTitle(ctx context.Context, number int, title string) error
+	// RetargetPullRequest changes the base branch of a pull request.
+	RetargetPullRequest(ctx context.Context, number int, base string) error
+	MarkPullRequestReady(ctx context.Context, number int) error
+	// EnableAutoMerge takes the ID of the pull request rather than its
+	// number, and a merge method of merge, squash or rebase, or empty for a
+	// base branch with a merge queue, which merges as it is configured to.
+	EnableAutoMerge(ctx context.Context, pullRequestID, mergeMethod string) error
+	MergePullRequest(ctx context.Context, number int, method string) error
+	GetMergeQueueStatus(ctx context.Context, number int) (MergeQueueStatus, error)
+	// EnqueuePullRequest adds a pull request to the merge queue of its base
+	// branch, provided its head is still expectedHeadOid, unless that is
+	// empty.
+	EnqueuePullRequest(ctx context.Context, pullRequestID, expectedHeadOid string) error
+
+	// GetIssue returns an issue in any state, or an error wrapping
+	// ErrIssueNotFound if there is none with number.
+	GetIssue(ctx context.Context, number int) (*Issue, error)
+	// ListClosingIssues returns the issues a pull request is linked to in
+	// its Development sidebar or closes with a closing keyword.
+	ListClosingIssues(ctx context.Context, number int) ([]int, error)
+	// ListLinkedPullRequests returns the pull requests of the repository
+	// linked to an issue, the other way around, in any state.
+	ListLinkedPullRequests(ctx context.Context, issue int) ([]int, error)
+
+	// ListIssueComments returns every comment of an issue or pull request.
+	ListIssueComments(ctx context.Context, number int) ([]IssueComment, error)
+	// ListReviewComments returns the reviews of a pull request that have a
+	// body and the comments of its reviews on lines of the diff, as
+	// comments, oldest first.
+	ListReviewComments(ctx context.Context, number int) ([]IssueComment, error)
+	CreateIssueComment(ctx context.Context, number int, body string) error
+	UpdateIssueComment(ctx context.Context, id int64, body string) error
+}
+
+var forge Forge = GitHubForge{}
+
+// SetForge replaces the Forge the package talks to.
+func SetForge(f Forge) {
+	forge = f
+	viewerLogin = ""
+}
@@ -0,0 +1,42 @@
+package cascade
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// fakeForge is a Forge for tests that answers from its fields. Calls it does
+// not implement panic on the nil Forge it embeds.
+type fakeForge struct {
+	Forge
+
+	pullRequests   map[int]*PullRequest
+	issueComments  map[int][]IssueComment
+	reviewComments map[int][]IssueComment
+}
+
+// useFakeForge makes the package talk to f until the test ends.
+func useFakeForge(t *testing.T, f *fakeForge) {
+	t.Helper()
+	previous := forge
+	SetForge(f)
+	t.Cleanup(func() { SetForge(previous) })
+}
+
+func (f *fakeForge) GetPullRequest(ctx context.Context, number int) (*PullRequest, error) {
+	pr, ok := f.pullRequests[number]
+	if !ok {
+		return nil, fmt.Errorf("#%d: %w", number, ErrPullRequestNotFound)
+	}
+	copied := *pr
+	return &copied, nil
+}
+
+func (f *fakeForge) ListIssueComments(ctx context.Context, number int) ([]IssueComment, error) {
+	return f.issueComments[number], nil
+}
+
+func (f *fakeForge) ListReviewComments(ctx context.Context, number int) ([]IssueComment, error) {
+	return f.reviewComments[number], nil
+}
@@ -0,0 +1,48 @@
+package cascade
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// HeadRemote returns the remote, or the URL, to push the head branch of pr to:
+// pushRemote for a pull request from the base repository, the remote of its
+// fork if there is one, or else the URL of fetchRemote with the fork in place
+// of the base repository. A pull request from a fork whose author does not
+// allow edits from maintainers cannot be pushed to, for which it returns a
+// SkipError.
+func HeadRemote(ctx context.Context, pr PullRequest, fetchRemote, pushRemote string) (string, error) {
+	if !pr.IsCrossRepository {
+		return pushRemote, nil
+	}
+	owner, name := pr.HeadRepositoryOwner.Login, pr.HeadRepository.Name
+
+	remotes, err := ListRemotes(ctx)
+	if err != nil {
+		return "", fmt.Errorf("list remotes: %w", err)
+	}
+	var fetch *Remote
+	for i, remote := range remotes {
+		if strings.EqualFold(remote.Repository.Owner, owner) && strings.EqualFold(remote.Repository.Name, name) {
+			return remote.Name, nil
+		}
+		if remote.Name == fetchRemote {
+			fetch = &remotes[i]
+		}
+	}
+
+	if !pr.MaintainerCanModify {
+		return "", Skipf("is from the fork %s/%s, whose author does not allow edits from maintainers", owner, name)
+	}
+	if fetch == nil {
+		return "", fmt.Errorf("no remote for the fork %s/%s, add one with git remote add %s <url>", owner, name, owner)
+	}
+
+	// https://github.com/OWNER/REPO.git or git@github.com:OWNER/REPO.git
+	base := fetch.Repository.Owner + "/" + fetch.Repository.Name
+	if !strings.Contains(fetch.URL, base) {
+		return "https://" + fetch.Repository.Host + "/" + owner + "/" + name + ".git", nil
+	}
+	return strings.Replace(fetch.URL, base, owner+"/"+name, 1), nil
+}
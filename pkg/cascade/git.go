@@ -0,0 +1,465 @@
+package cascade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var ErrDirtyWorkspace = errors.New("current branch is dirty")
+
+// ErrRebaseConflict is returned by RebaseOntoPullRequest when the rebase
+// stopped on a conflict and was aborted.
+var ErrRebaseConflict = errors.New("conflicted")
+
+// ErrStaleLease is returned by PushBranch when the remote branch is no longer
+// at the expected commit, e.g. because someone pushed to it since.
+var ErrStaleLease = errors.New("the remote branch moved since it was fetched")
+
+// ErrBranchProtected and ErrNoPushAccess are returned by the Push functions
+// when the remote refused the push, along with how to fix it.
+var (
+	ErrBranchProtected = errors.New("cannot push: branch protected")
+	ErrNoPushAccess    = errors.New("cannot push: no write access")
+)
+
+func FetchBranch(ctx context.Context, remote, branch string) error {
+	if _, _, err := runGit(ctx, "fetch", remote, branch); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// IsCurrentBranchDirty reports whether the working tree or the index has
+// changes. Submodules that are only checked out at another commit than the one
+// recorded do not count, since checking out a branch does not move them, and
+// neither do the files outside a sparse checkout, which git status leaves out.
+func IsCurrentBranchDirty(ctx context.Context) (bool, error) {
+	stdout, _, err := runGit(ctx, "status", "--porcelain=v2")
+	if err != nil {
+		return false, err
+	}
+
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if line != "" && !isMovedSubmodule(line) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// PrepareWorkspace makes sure the working tree is clean and returns a function
+// that checks the original branch (or detached HEAD) back out, as sparse as
+// it was, and its submodules if UpdateSubmodules moved them.
+func PrepareWorkspace(ctx context.Context) (func() error, error) {
+	isDirty, err := IsCurrentBranchDirty(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if isDirty {
+		return nil, ErrDirtyWorkspace
+	}
+
+	originalRef, err := GetCurrentRef(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("resolve current branch: %w", err)
+	}
+
+	return func() error {
+		// ctx may already be cancelled by Ctrl-C, so the restore must not depend on it.
+		ctx := context.WithoutCancel(ctx)
+
+		// A rebase killed before it could be aborted would keep the branch
+		// it stopped on checked out.
+		if inProgress, err := IsRebaseInProgress(ctx); err == nil && inProgress {
+			if _, stderr, err := runGit(ctx, "rebase", "--abort"); err != nil {
+				return fmt.Errorf("abort rebase: %s: %w", strings.TrimSpace(stderr.String()), err)
+			}
+		}
+
+		if err := CheckoutRef(ctx, originalRef); err != nil {
+			return fmt.Errorf("restore %s: %w", originalRef, err)
+		}
+		if err := ReapplySparseCheckout(ctx); err != nil {
+			return fmt.Errorf("restore sparse checkout: %w", err)
+		}
+		if submodulesUpdated.Swap(false) {
+			if err := updateSubmodules(ctx); err != nil {
+				return fmt.Errorf("restore submodules: %w", err)
+			}
+		}
+		return nil
+	}, nil
+}
+
+// GetCurrentRef returns the name of the checked out branch, or the commit SHA
+// when HEAD is detached.
+func GetCurrentRef(ctx context.Context) (string, error) {
+	stdout, _, err := runGit(ctx, "symbolic-ref", "--quiet", "--short", "HEAD")
+	if err == nil {
+		return strings.TrimSpace(stdout.String()), nil
+	}
+
+	stdout, _, err = runGit(ctx, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func RevParse(ctx context.Context, rev string) (string, error) {
+	stdout, _, err := runGit(ctx, "rev-parse", "--verify", rev)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func CheckoutRef(ctx context.Context, ref string) error {
+	_, stderr, err := runGit(ctx, "checkout", "--quiet", ref)
+	if err != nil {
+		return fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return nil
+}
+
+// SwitchBranch checks branch out. A branch that does not exist locally is
+// created from the branch of the same name on remote, and tracks it.
+func SwitchBranch(ctx context.Context, remote, branch string) error {
+	if _, _, err := runGit(ctx, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch); err == nil {
+		return CheckoutRef(ctx, branch)
+	}
+
+	if _, stderr, err := runGit(ctx, "fetch", "--no-tags", remote, "+refs/heads/"+branch+":"+RemoteBranchRef(remote, branch)); err != nil {
+		return fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+	if _, stderr, err := runGit(ctx, "checkout", "--quiet", "--track", "-b", branch, RemoteBranchRef(remote, branch)); err != nil {
+		return fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+	return nil
+}
+
+// pullRequestBranchPrefix is where cascade keeps the local branches it
+// rebases pull requests on, so that they never collide with branches of the
+// user or of other forks.
+const pullRequestBranchPrefix = "cascade/"
+
+// PullRequestBranch is the local branch cascade rebases a pull request on.
+func PullRequestBranch(number int) string {
+	return pullRequestBranchPrefix + strconv.Itoa(number)
+}
+
+// ParsePullRequestBranch returns the number of the pull request a branch
+// returned by PullRequestBranch belongs to.
+func ParsePullRequestBranch(branch string) (int, bool) {
+	number, err := strconv.Atoi(strings.TrimPrefix(branch, pullRequestBranchPrefix))
+	return number, err == nil && strings.HasPrefix(branch, pullRequestBranchPrefix)
+}
+
+// CheckoutPullRequest checks out the head of a pull request, which must have
+// been fetched already, on the branch returned by PullRequestBranch, resetting
+// that branch if it exists.
+func CheckoutPullRequest(ctx context.Context, pr PullRequest) error {
+	_, stderr, err := runGit(ctx, "checkout", "--quiet", "-B", PullRequestBranch(pr.Number), pr.HeadRefOid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return nil
+}
+
+// RebaseOptions are how RebaseOntoPullRequest rebases.
+type RebaseOptions struct {
+	// Rerere resolves conflicts that have a recorded resolution with it and
+	// goes on with the rebase.
+	Rerere bool
+	// RebaseMerges recreates merge commits rather than flattening them.
+	RebaseMerges bool
+	// Autosquash folds fixup! and squash! commits into the commits they
+	// amend, keeping the messages as git combines them.
+	Autosquash bool
+	// Sign signs the rebased commits, as commit.gpgSign does.
+	Sign bool
+}
+
+// RebaseOntoPullRequest rebases the commits of topicBranch after oldParent
+// onto targetBase. Commits that end up empty are dropped, as are those whose
+// change is already in targetBase but conflict, e.g. because it was amended
+// there later. It reports whether a conflict was resolved with
+// RebaseOptions.Rerere.
+func RebaseOntoPullRequest(ctx context.Context, targetBase, oldParent, topicBranch string, opts RebaseOptions) (bool, error) {
+	// The editors are no-ops so that nothing waits for input: the todo list
+	// of --autosquash is taken as git arranged it, and messages as given.
+	config := []string{"-c", "core.editor=true", "-c", "sequence.editor=true"}
+	if opts.Rerere {
+		config = append(config, "-c", "rerere.enabled=true", "-c", "rerere.autoUpdate=true")
+	}
+
+	upstream, err := ListUpstreamCommits(ctx, targetBase, topicBranch, oldParent)
+	if err != nil {
+		return false, err
+	}
+
+	args := append(config, "rebase", "--empty=drop")
+	if opts.Autosquash {
+		args = append(args, "--interactive", "--autosquash")
+	}
+	if opts.RebaseMerges {
+		args = append(args, "--rebase-merges")
+	}
+	if opts.Sign {
+		args = append(args, "--gpg-sign")
+	}
+	_, stderr, err := runGit(ctx, append(args, "--onto", targetBase, oldParent, topicBranch)...)
+
+	resolved := false
+	for err != nil && isConflict(stderr.String()) {
+		if stopped, stoppedErr := RevParse(ctx, "REBASE_HEAD"); stoppedErr == nil && upstream[stopped] {
+			_, stderr, err = runGit(ctx, append(config, "rebase", "--skip")...)
+			continue
+		}
+		if !opts.Rerere {
+			break
+		}
+		unmerged, unmergedErr := ListUnmergedPaths(ctx)
+		if unmergedErr != nil || len(unmerged) > 0 {
+			break
+		}
+
+		resolved = true
+		_, stderr, err = runGit(ctx, append(config, "rebase", "--continue")...)
+	}
+
+	if err != nil {
+		// ctx may have been cancelled by Ctrl-C, which must not leave the
+		// rebase in progress.
+		_, _, _ = runGit(context.WithoutCancel(ctx), "rebase", "--abort")
+
+		// A commit that failed to be signed is also reported as one that
+		// could not be applied.
+		if isSigningFailure(stderr.String()) {
+			return false, signingError(stderr.String(), err)
+		} else if isConflict(stderr.String()) {
+			return false, fmt.Errorf("%w while rebasing %s onto %s (old parent: %s)", ErrRebaseConflict, topicBranch, targetBase, oldParent[:7])
+		} else {
+			return false, fmt.Errorf("%s: %w", stderr.String(), err)
+		}
+	}
+
+	return resolved, nil
+}
+
+// isConflict reports whether a rebase or cherry-pick stopped on a conflict,
+// for a commit or, with --rebase-merges, a merge commit.
+func isConflict(stderr string) bool {
+	return strings.Contains(stderr, "could not apply") || strings.Contains(stderr, "could not merge")
+}
+
+// isSigningFailure reports whether git failed to sign a commit.
+func isSigningFailure(stderr string) bool {
+	return strings.Contains(stderr, "failed to sign")
+}
+
+// signingError describes a failure to sign a commit, which would otherwise
+// read as a failure to write or apply it.
+func signingError(stderr string, err error) error {
+	reason := "failed to sign the data"
+	for _, line := range strings.Split(stderr, "\n") {
+		if isSigningFailure(line) {
+			reason = strings.TrimPrefix(line, "error: ")
+			break
+		}
+	}
+	return fmt.Errorf("failed to sign the rebased commits, check that git commit -S works here: %s: %w", reason, err)
+}
+
+// ListUpstreamCommits returns the commits after base up to tip whose change
+// is already in upstream, as told by their patch ID, see git cherry.
+func ListUpstreamCommits(ctx context.Context, upstream, tip, base string) (map[string]bool, error) {
+	stdout, stderr, err := runGit(ctx, "cherry", upstream, tip, base)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	commits := map[string]bool{}
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if commit, ok := strings.CutPrefix(line, "- "); ok {
+			commits[commit] = true
+		}
+	}
+	return commits, nil
+}
+
+// CountMerges returns the number of merge commits after base up to tip.
+func CountMerges(ctx context.Context, base, tip string) (int, error) {
+	stdout, stderr, err := runGit(ctx, "rev-list", "--count", "--merges", base+".."+tip)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return strconv.Atoi(strings.TrimSpace(stdout.String()))
+}
+
+// IsRebaseInProgress reports whether a rebase stopped in the middle, e.g.
+// on a conflict or because git was killed.
+func IsRebaseInProgress(ctx context.Context) (bool, error) {
+	for _, dir := range []string{"rebase-merge", "rebase-apply"} {
+		stdout, stderr, err := runGit(ctx, "rev-parse", "--git-path", dir)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+		}
+		if _, err := os.Stat(strings.TrimSpace(stdout.String())); err == nil {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// IsAncestor reports whether ancestor is reachable from rev.
+func IsAncestor(ctx context.Context, ancestor, rev string) (bool, error) {
+	_, stderr, err := runGit(ctx, "merge-base", "--is-ancestor", ancestor, rev)
+	if exitCode(err) == 1 {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return true, nil
+}
+
+// ListUnmergedPaths returns the paths with unresolved conflicts in the index.
+func ListUnmergedPaths(ctx context.Context) ([]string, error) {
+	stdout, stderr, err := runGit(ctx, "diff", "--name-only", "--diff-filter=U")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return strings.Fields(stdout.String()), nil
+}
+
+// PushBranch pushes rev to branch on remote, provided the remote branch is
+// still at expected.
+func PushBranch(ctx context.Context, remote, branch, rev, expected string) error {
+	_, stderr, err := runGit(ctx, "push", "--force-with-lease=refs/heads/"+branch+":"+expected, remote, rev+":refs/heads/"+branch)
+	if err != nil {
+		// ! [rejected]        cascade/2 -> feature (stale info)
+		if strings.Contains(stderr.String(), "(stale info)") {
+			return fmt.Errorf("%w: expected it at %s", ErrStaleLease, expected[:min(7, len(expected))])
+		}
+		return pushError(remote, stderr.String(), err)
+	}
+
+	return nil
+}
+
+// DeleteBranch deletes the local branch, provided it is still at expected, so
+// that commits that were never pushed are kept. It reports whether the branch
+// existed.
+func DeleteBranch(ctx context.Context, branch, expected string) (bool, error) {
+	oid, err := RevParse(ctx, "refs/heads/"+branch)
+	if err != nil {
+		return false, nil
+	}
+	if oid != expected {
+		return true, fmt.Errorf("%s has commits that are not in its pull request", branch)
+	}
+
+	if _, stderr, err := runGit(ctx, "branch", "--delete", "--force", branch); err != nil {
+		return true, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+	return true, nil
+}
+
+// DeleteRemoteBranch deletes branch on remote, provided it is still at
+// expected. It reports whether the branch existed, as GitHub may have deleted
+// it when the pull request merged.
+func DeleteRemoteBranch(ctx context.Context, remote, branch, expected string) (bool, error) {
+	_, stderr, err := runGit(ctx, "ls-remote", "--exit-code", remote, "refs/heads/"+branch)
+	if exitCode(err) == 2 {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	_, stderr, err = runGit(ctx, "push", "--force-with-lease=refs/heads/"+branch+":"+expected, remote, ":refs/heads/"+branch)
+	if err != nil {
+		if strings.Contains(stderr.String(), "(stale info)") {
+			return true, fmt.Errorf("%w: expected it at %s", ErrStaleLease, expected[:min(7, len(expected))])
+		}
+		return true, pushError(remote, stderr.String(), err)
+	}
+
+	return true, nil
+}
+
+// ResetBranch points branch at oid. It refuses to move the checked out
+// branch.
+func ResetBranch(ctx context.Context, branch, oid string) error {
+	_, stderr, err := runGit(ctx, "branch", "--force", branch, oid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return nil
+}
+
+func RepositoryRoot(ctx context.Context) (string, error) {
+	stdout, _, err := runGit(ctx, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+
+	// git prints C:/path/to/repo on Windows.
+	return filepath.FromSlash(strings.TrimSpace(stdout.String())), nil
+}
+
+// GetCommitMessage returns the subject and the body of the message of rev.
+func GetCommitMessage(ctx context.Context, rev string) (subject, body string, err error) {
+	stdout, stderr, err := runGit(ctx, "log", "-1", "--format=%s%x00%b", rev)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	subject, body, _ = strings.Cut(stdout.String(), "\x00")
+	return subject, strings.TrimSpace(body), nil
+}
+
+// pushError tells a push refused by branch protection or for lack of access
+// from other failures, with what the remote said and how to fix it.
+func pushError(remote, stderr string, err error) error {
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(strings.TrimPrefix(line, "remote:"))
+		switch {
+		// remote: error: GH006: Protected branch update failed for refs/heads/main.
+		// remote: error: GH013: Repository rule violations found for refs/heads/main.
+		case strings.Contains(line, "GH006") || strings.Contains(line, "GH013") || strings.Contains(line, "protected branch hook declined"):
+			return fmt.Errorf("%w (%s); allow force pushes to it in the branch protection rules or rulesets of the repository", ErrBranchProtected, strings.TrimPrefix(line, "error: "))
+		// remote: Permission to owner/repo.git denied to user.
+		// fatal: unable to access '...': The requested URL returned error: 403
+		case (strings.Contains(line, "Permission to") && strings.Contains(line, "denied")) || strings.Contains(line, "returned error: 403"):
+			return fmt.Errorf("%w to %s (%s); ask for write access or, for a pull request from a fork, for its author to allow edits from maintainers", ErrNoPushAccess, remote, strings.TrimPrefix(line, "fatal: "))
+		}
+	}
+
+	return fmt.Errorf("%s: %w", strings.TrimSpace(stderr), err)
+}
+
+// PushNewBranch pushes the local branch to the branch of the same name on
+// remote. Unlike PushBranch, it never overwrites commits on the remote.
+func PushNewBranch(ctx context.Context, remote, branch string) error {
+	_, stderr, err := runGit(ctx, "push", remote, "refs/heads/"+branch+":refs/heads/"+branch)
+	if err != nil {
+		return pushError(remote, stderr.String(), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,264 @@
+package cascade
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeGitRunner is a GitRunner for tests that answers each command with the
+// response for its arguments, joined with spaces, and records the commands it
+// was asked to run. Commands without a response fail.
+type fakeGitRunner struct {
+	responses map[string]fakeGitResponse
+
+	mu       sync.Mutex
+	commands []string
+}
+
+type fakeGitResponse struct {
+	stdout, stderr string
+	// exitCode, if not 0, makes the command fail with it.
+	exitCode int
+}
+
+// fakeExitError is the error of a command that exited with code.
+type fakeExitError struct {
+	code int
+}
+
+func (e *fakeExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+func (e *fakeExitError) ExitCode() int {
+	return e.code
+}
+
+// useFakeGitRunner makes the package run git commands with r until the test
+// ends.
+func useFakeGitRunner(t *testing.T, r *fakeGitRunner) {
+	t.Helper()
+	previous := gitRunner
+	SetGitRunner(r)
+	t.Cleanup(func() { SetGitRunner(previous) })
+}
+
+func (r *fakeGitRunner) Run(ctx context.Context, args ...string) (stdout, stderr bytes.Buffer, err error) {
+	command := strings.Join(args, " ")
+	r.mu.Lock()
+	r.commands = append(r.commands, command)
+	r.mu.Unlock()
+
+	response, ok := r.responses[command]
+	if !ok {
+		stderr.WriteString("fatal: unexpected command git " + command)
+		return stdout, stderr, &fakeExitError{code: 128}
+	}
+	stdout.WriteString(response.stdout)
+	stderr.WriteString(response.stderr)
+	if response.exitCode != 0 {
+		err = &fakeExitError{code: response.exitCode}
+	}
+	return stdout, stderr, err
+}
+
+func TestGitArgs(t *testing.T) {
+	tests := []struct {
+		goos string
+		args []string
+		want []string
+	}{
+		{"linux", []string{"status"}, []string{"status"}},
+		{"darwin", []string{"rev-parse", "HEAD"}, []string{"rev-parse", "HEAD"}},
+		{"windows", []string{"status"}, []string{"-c", "core.longpaths=true", "status"}},
+		{"windows", nil, []string{"-c", "core.longpaths=true"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.goos+" "+strings.Join(tt.args, " "), func(t *testing.T) {
+			if got := gitArgs(tt.goos, tt.args); !slices.Equal(got, tt.want) {
+				t.Errorf("gitArgs(%q, %q) = %q, want %q", tt.goos, tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunGitGoesThroughGitRunner(t *testing.T) {
+	r := &fakeGitRunner{responses: map[string]fakeGitResponse{
+		"branch --force cascade/12 abc123": {},
+	}}
+	useFakeGitRunner(t, r)
+
+	if err := ResetBranch(context.Background(), "cascade/12", "abc123"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"branch --force cascade/12 abc123"}; !slices.Equal(r.commands, want) {
+		t.Errorf("ran %q, want %q", r.commands, want)
+	}
+}
+
+func TestRepositoryRoot(t *testing.T) {
+	tests := []struct {
+		name     string
+		response fakeGitResponse
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "unix path",
+			response: fakeGitResponse{stdout: "/home/user/repo\n"},
+			want:     filepath.FromSlash("/home/user/repo"),
+		},
+		{
+			name:     "windows path",
+			response: fakeGitResponse{stdout: "C:/Users/user/repo\n"},
+			want:     filepath.FromSlash("C:/Users/user/repo"),
+		},
+		{
+			name:     "path with spaces",
+			response: fakeGitResponse{stdout: "/home/user/my repo\n"},
+			want:     filepath.FromSlash("/home/user/my repo"),
+		},
+		{
+			name:     "not a repository",
+			response: fakeGitResponse{stderr: "fatal: not a git repository", exitCode: 128},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeGitRunner(t, &fakeGitRunner{responses: map[string]fakeGitResponse{
+				"rev-parse --show-toplevel": tt.response,
+			}})
+
+			got, err := RepositoryRoot(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RepositoryRoot() error = %v, want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("RepositoryRoot() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsAncestor(t *testing.T) {
+	tests := []struct {
+		name     string
+		response fakeGitResponse
+		want     bool
+		wantErr  string
+	}{
+		{name: "ancestor", want: true},
+		{name: "not an ancestor", response: fakeGitResponse{exitCode: 1}},
+		{name: "unknown commit", response: fakeGitResponse{stderr: "fatal: Not a valid commit name abc\n", exitCode: 128}, wantErr: "fatal: Not a valid commit name abc: exit status 128"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeGitRunner(t, &fakeGitRunner{responses: map[string]fakeGitResponse{
+				"merge-base --is-ancestor abc def": tt.response,
+			}})
+
+			got, err := IsAncestor(context.Background(), "abc", "def")
+			if tt.wantErr != "" {
+				var exitErr *fakeExitError
+				if err == nil || err.Error() != tt.wantErr || !errors.As(err, &exitErr) {
+					t.Fatalf("IsAncestor() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("IsAncestor() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+// dirGitRunner runs git in dir, for tests against a scratch repository.
+type dirGitRunner struct {
+	dir string
+}
+
+func (r dirGitRunner) Run(ctx context.Context, args ...string) (stdout, stderr bytes.Buffer, err error) {
+	return ExecGitRunner{}.Run(ctx, append([]string{"-C", r.dir}, args...)...)
+}
+
+// newTestRepository creates a repository with a first commit on main, makes
+// the package run git in it until the test ends and returns a function that
+// runs git in it and returns what it printed.
+func newTestRepository(t *testing.T) func(args ...string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	for _, name := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(name, "gh-cascade")
+	}
+	for _, name := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(name, "gh-cascade@example.com")
+	}
+
+	runner := dirGitRunner{dir: t.TempDir()}
+	previous := gitRunner
+	SetGitRunner(runner)
+	t.Cleanup(func() { SetGitRunner(previous) })
+
+	git := func(args ...string) string {
+		t.Helper()
+		stdout, stderr, err := runner.Run(context.Background(), args...)
+		if err != nil {
+			t.Fatalf("git %s: %s: %v", strings.Join(args, " "), strings.TrimSpace(stderr.String()), err)
+		}
+		return strings.TrimSpace(stdout.String())
+	}
+	git("init", "--quiet", "--initial-branch=main")
+	git("commit", "--quiet", "--allow-empty", "--message=initial")
+	return git
+}
+
+// chdir changes the working directory to dir until the test ends, for code
+// that resolves paths git prints relative to it.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(previous); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// commitFile commits a file with content and returns the commit.
+func commitFile(t *testing.T, git func(args ...string) string, name, content, message string) string {
+	t.Helper()
+	dir := git("rev-parse", "--show-toplevel")
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	git("add", name)
+	git("commit", "--quiet", "--message="+message)
+	return git("rev-parse", "HEAD")
+}
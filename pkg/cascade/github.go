@@ -0,0 +1,618 @@
+package cascade
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cli/go-gh/v2/pkg/repository"
+)
+
+// GitHubForge is the default Forge. It goes through gh, so it works with
+// every host gh is authenticated with and honors GH_REPO and
+// `gh repo set-default`.
+type GitHubForge struct{}
+
+var _ Forge = GitHubForge{}
+
+// pullRequestFields lists the JSON fields requested from gh for a PullRequest.
+const pullRequestFields = "id,baseRefName,body,headRefName,headRefOid,isDraft,number,title,url,mergeCommit,state,commits,statusCheckRollup,reviewDecision,additions,deletions,isCrossRepository,headRepositoryOwner,headRepository,maintainerCanModify,closedAt"
+
+// apiHost is the host gh api talks to. Unlike other gh commands, gh api does
+// not infer the host from the repository, so without it GitHub Enterprise
+// repositories would be looked up on github.com.
+var apiHost string
+
+// ghAPI runs gh api against the host of the base repository.
+func ghAPI(ctx context.Context, args ...string) (stdout, stderr bytes.Buffer, err error) {
+	if apiHost != "" {
+		args = append([]string{"--hostname", apiHost}, args...)
+	}
+	return ghExec(ctx, append([]string{"api"}, args...)...)
+}
+
+func (GitHubForge) GetBaseRepository(ctx context.Context) (repository.Repository, error) {
+	stdout, stderr, err := ghExec(ctx, "repo", "view", "--json", "url")
+	if err != nil {
+		return repository.Repository{}, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	var repo struct {
+		URL string `json:"url"`
+	}
+	if err = json.Unmarshal(stdout.Bytes(), &repo); err != nil {
+		return repository.Repository{}, err
+	}
+
+	return repository.Parse(repo.URL)
+}
+
+func (GitHubForge) GetDefaultBranch(ctx context.Context) (string, error) {
+	stdout, stderr, err := ghExec(ctx, "repo", "view", "--json", "defaultBranchRef")
+	if err != nil {
+		return "", err
+	}
+
+	if stderr.Len() > 0 {
+		return "", err
+	}
+
+	var defaultBranch struct {
+		DefaultBranchRef struct {
+			Name string `json:"name"`
+		}
+	}
+
+	if err = json.Unmarshal(stdout.Bytes(), &defaultBranch); err != nil {
+		return "", err
+	}
+
+	return defaultBranch.DefaultBranchRef.Name, nil
+}
+
+func (GitHubForge) GetViewerLogin(ctx context.Context) (string, error) {
+	stdout, stderr, err := ghAPI(ctx, "user", "--jq", ".login")
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func (GitHubForge) CompareCommits(ctx context.Context, base, head string) (Comparison, error) {
+	// The comparison comes with the commits and files in between, of which a
+	// single page of one commit is enough.
+	stdout, stderr, err := ghAPI(ctx, "repos/{owner}/{repo}/compare/"+base+"..."+head+"?per_page=1")
+	if err != nil {
+		return Comparison{}, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	var comparison struct {
+		Status   string `json:"status"`
+		AheadBy  int    `json:"ahead_by"`
+		BehindBy int    `json:"behind_by"`
+	}
+	if err = json.Unmarshal(stdout.Bytes(), &comparison); err != nil {
+		return Comparison{}, err
+	}
+
+	return Comparison{Status: comparison.Status, AheadBy: comparison.AheadBy, BehindBy: comparison.BehindBy}, nil
+}
+
+// listAllLimit is passed as --limit to gh pr list to have it go through every
+// page, since its default limit of 30 silently drops pull requests of busy
+// repositories.
+const listAllLimit = math.MaxInt32
+
+func (GitHubForge) ListPullRequests(ctx context.Context, filter PullRequestFilter) ([]PullRequest, error) {
+	return listByAuthor(filter, func(author string, limit int) ([]PullRequest, error) {
+		args := []string{"pr", "list", "--state", "open", "--limit", strconv.Itoa(limit), "--json", pullRequestFields}
+		if author != "" {
+			args = append(args, "--author", author)
+		}
+		if filter.Assignee != "" {
+			args = append(args, "--assignee", filter.Assignee)
+		}
+		for _, label := range filter.Labels {
+			args = append(args, "--label", label)
+		}
+		// gh pr list has no --milestone, unlike gh issue list.
+		var search []string
+		if filter.Search != "" {
+			search = append(search, filter.Search)
+		}
+		if filter.Milestone != "" {
+			search = append(search, "milestone:"+strconv.Quote(filter.Milestone))
+		}
+		if len(search) > 0 {
+			args = append(args, "--search", strings.Join(search, " "))
+		}
+
+		stdout, stderr, err := ghExec(ctx, args...)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+		}
+
+		var listed []PullRequest
+		err = json.Unmarshal(stdout.Bytes(), &listed)
+		return listed, err
+	})
+}
+
+// listByAuthor lists the pull requests of filter with list, once for each of
+// its authors, since lists only match a single one, and returns them newest
+// first. list is passed the number of pull requests to list at most.
+func listByAuthor(filter PullRequestFilter, list func(author string, limit int) ([]PullRequest, error)) ([]PullRequest, error) {
+	authors := filter.Authors
+	if len(authors) == 0 {
+		authors = []string{""}
+	}
+	limit := listAllLimit
+	if filter.Limit > 0 {
+		limit = filter.Limit
+	}
+
+	pullRequests := []PullRequest{}
+	seen := map[int]bool{}
+	for _, author := range authors {
+		listed, err := list(author, limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, pr := range listed {
+			if !seen[pr.Number] {
+				seen[pr.Number] = true
+				pullRequests = append(pullRequests, pr)
+			}
+		}
+	}
+
+	if len(authors) > 1 {
+		sort.Slice(pullRequests, func(i, j int) bool {
+			return pullRequests[i].Number > pullRequests[j].Number
+		})
+	}
+	if filter.Limit > 0 && len(pullRequests) > filter.Limit {
+		pullRequests = pullRequests[:filter.Limit]
+	}
+
+	return pullRequests, nil
+}
+
+func (GitHubForge) GetPullRequest(ctx context.Context, number int) (*PullRequest, error) {
+	stdout, stderr, err := ghExec(ctx, "pr", "view", strconv.Itoa(number), "--json", pullRequestFields)
+
+	// GraphQL: Could not resolve to a PullRequest with the number of 999.
+	if err != nil && strings.Contains(stderr.String(), "Could not resolve to a PullRequest") {
+		return nil, fmt.Errorf("%w: #%d", ErrPullRequestNotFound, number)
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	if stderr.Len() > 0 {
+		return nil, err
+	}
+
+	pullRequest := &PullRequest{}
+	if err = json.Unmarshal(stdout.Bytes(), pullRequest); err != nil {
+		return nil, err
+	}
+
+	return pullRequest, nil
+}
+
+func (f GitHubForge) CreatePullRequest(ctx context.Context, pr NewPullRequest) (*PullRequest, error) {
+	args := []string{"pr", "create", "--head", pr.Head, "--base", pr.Base, "--title", pr.Title, "--body", pr.Body}
+	if pr.Draft {
+		args = append(args, "--draft")
+	}
+
+	stdout, stderr, err := ghExec(ctx, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	// gh pr create prints the URL of the new pull request last.
+	fields := strings.Fields(stdout.String())
+	if len(fields) == 0 {
+		return nil, errors.New("gh pr create printed no pull request")
+	}
+	url := fields[len(fields)-1]
+	number, err := strconv.Atoi(url[strings.LastIndex(url, "/")+1:])
+	if err != nil {
+		return nil, fmt.Errorf("unexpected output of gh pr create: %q", url)
+	}
+
+	return f.GetPullRequest(ctx, number)
+}
+
+func (GitHubForge) UpdatePullRequestBody(ctx context.Context, number int, body string) error {
+	_, stderr, err := ghAPI(ctx, "--method", "PATCH", "repos/{owner}/{repo}/pulls/"+strconv.Itoa(number), "-f", "body="+body)
+	if err != nil {
+		return fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return nil
+}
+
+func (GitHubForge) UpdatePullRequestTitle(ctx context.Context, number int, title string) error {
+	_, stderr, err := ghAPI(ctx, "--method", "PATCH", "repos/{owner}/{repo}/pulls/"+strconv.Itoa(number), "-f", "title="+title)
+	if err != nil {
+		return fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return nil
+}
+
+func (GitHubForge) RetargetPullRequest(ctx context.Context, number int, base string) error {
+	_, stderr, err := ghAPI(ctx, "--method", "PATCH", "repos/{owner}/{repo}/pulls/"+strconv.Itoa(number), "-f", "base="+base)
+	if err != nil {
+		return fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return nil
+}
+
+func (GitHubForge) MarkPullRequestReady(ctx context.Context, number int) error {
+	_, stderr, err := ghExec(ctx, "pr", "ready", strconv.Itoa(number))
+	if err != nil {
+		return fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return nil
+}
+
+const enableAutoMergeMutation = `mutation($pullRequestId: ID!, $mergeMethod: PullRequestMergeMethod) {
+  enablePullRequestAutoMerge(input: {pullRequestId: $pullRequestId, mergeMethod: $mergeMethod}) {
+    clientMutationId
+  }
+}`
+
+func (GitHubForge) EnableAutoMerge(ctx context.Context, pullRequestID, mergeMethod string) error {
+	args := []string{"graphql", "-f", "query=" + enableAutoMergeMutation, "-f", "pullRequestId=" + pullRequestID}
+	if mergeMethod != "" {
+		args = append(args, "-f", "mergeMethod="+strings.ToUpper(mergeMethod))
+	}
+	_, stderr, err := ghAPI(ctx, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return nil
+}
+
+func (GitHubForge) MergePullRequest(ctx context.Context, number int, method string) error {
+	_, stderr, err := ghExec(ctx, "pr", "merge", strconv.Itoa(number), "--"+method)
+	if err != nil {
+		return fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return nil
+}
+
+const mergeQueueQuery = `query($owner: String!, $name: String!, $number: Int!) {
+  repository(owner: $owner, name: $name) {
+    pullRequest(number: $number) {
+      isMergeQueueEnabled
+      mergeQueueEntry {
+        state
+        position
+      }
+    }
+  }
+}`
+
+func (GitHubForge) GetMergeQueueStatus(ctx context.Context, number int) (MergeQueueStatus, error) {
+	stdout, stderr, err := ghAPI(ctx, "graphql",
+		"-f", "query="+mergeQueueQuery,
+		"-F", "owner={owner}",
+		"-F", "name={repo}",
+		"-F", "number="+strconv.Itoa(number),
+	)
+	if err != nil {
+		return MergeQueueStatus{}, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	var result struct {
+		Data mergeQueueData `json:"data"`
+	}
+	if err = json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return MergeQueueStatus{}, err
+	}
+
+	return result.Data.status(), nil
+}
+
+// mergeQueueData is the data mergeQueueQuery returns.
+type mergeQueueData struct {
+	Repository struct {
+		PullRequest struct {
+			IsMergeQueueEnabled bool `json:"isMergeQueueEnabled"`
+			MergeQueueEntry     *struct {
+				State    string `json:"state"`
+				Position int    `json:"position"`
+			} `json:"mergeQueueEntry"`
+		} `json:"pullRequest"`
+	} `json:"repository"`
+}
+
+func (d mergeQueueData) status() MergeQueueStatus {
+	pr := d.Repository.PullRequest
+	status := MergeQueueStatus{Enabled: pr.IsMergeQueueEnabled}
+	if entry := pr.MergeQueueEntry; entry != nil {
+		// The queue locks the entry it is merging; QUEUED, AWAITING_CHECKS,
+		// MERGEABLE and UNMERGEABLE are all still waiting.
+		status.State = MergeQueueQueued
+		if entry.State == "LOCKED" {
+			status.State = MergeQueueMerging
+		}
+		status.Position = entry.Position
+	}
+
+	return status
+}
+
+const enqueuePullRequestMutation = `mutation($pullRequestId: ID!, $expectedHeadOid: GitObjectID) {
+  enqueuePullRequest(input: {pullRequestId: $pullRequestId, expectedHeadOid: $expectedHeadOid}) {
+    clientMutationId
+  }
+}`
+
+func (GitHubForge) EnqueuePullRequest(ctx context.Context, pullRequestID, expectedHeadOid string) error {
+	args := []string{"graphql", "-f", "query=" + enqueuePullRequestMutation, "-f", "pullRequestId=" + pullRequestID}
+	if expectedHeadOid != "" {
+		args = append(args, "-f", "expectedHeadOid="+expectedHeadOid)
+	}
+	_, stderr, err := ghAPI(ctx, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return nil
+}
+
+func (GitHubForge) ListIssueComments(ctx context.Context, number int) ([]IssueComment, error) {
+	return ghList[IssueComment](ctx, "repos/{owner}/{repo}/issues/"+strconv.Itoa(number)+"/comments")
+}
+
+func (GitHubForge) ListReviewComments(ctx context.Context, number int) ([]IssueComment, error) {
+	path := "repos/{owner}/{repo}/pulls/" + strconv.Itoa(number)
+	reviews, err := ghList[review](ctx, path+"/reviews")
+	if err != nil {
+		return nil, err
+	}
+	comments, err := ghList[IssueComment](ctx, path+"/comments")
+	if err != nil {
+		return nil, err
+	}
+
+	return reviewComments(reviews, comments), nil
+}
+
+// ghList returns every item of a paginated REST list.
+func ghList[T any](ctx context.Context, path string) ([]T, error) {
+	stdout, stderr, err := ghAPI(ctx, "--paginate", "--slurp", path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	var pages [][]T
+	if err = json.Unmarshal(stdout.Bytes(), &pages); err != nil {
+		return nil, err
+	}
+
+	var items []T
+	for _, page := range pages {
+		items = append(items, page...)
+	}
+
+	return items, nil
+}
+
+func (GitHubForge) CreateIssueComment(ctx context.Context, number int, body string) error {
+	_, stderr, err := ghAPI(ctx, "--method", "POST", "repos/{owner}/{repo}/issues/"+strconv.Itoa(number)+"/comments", "-f", "body="+body)
+	if err != nil {
+		return fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return nil
+}
+
+func (GitHubForge) UpdateIssueComment(ctx context.Context, id int64, body string) error {
+	_, stderr, err := ghAPI(ctx, "--method", "PATCH", fmt.Sprintf("repos/{owner}/{repo}/issues/comments/%d", id), "-f", "body="+body)
+	if err != nil {
+		return fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return nil
+}
+
+const closingIssuesQuery = `query($owner: String!, $name: String!, $number: Int!) {
+  repository(owner: $owner, name: $name) {
+    pullRequest(number: $number) {
+      closingIssuesReferences(first: 25) {
+        nodes {
+          number
+        }
+      }
+    }
+  }
+}`
+
+func (GitHubForge) GetIssue(ctx context.Context, number int) (*Issue, error) {
+	stdout, stderr, err := ghExec(ctx, "issue", "view", strconv.Itoa(number), "--json", "number,title,url,state")
+
+	// GraphQL: Could not resolve to an issue or pull request with the number of 999.
+	if err != nil && strings.Contains(stderr.String(), "Could not resolve to an issue") {
+		return nil, fmt.Errorf("%w: #%d", ErrIssueNotFound, number)
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	issue := &Issue{}
+	if err = json.Unmarshal(stdout.Bytes(), issue); err != nil {
+		return nil, err
+	}
+
+	return issue, nil
+}
+
+func (GitHubForge) ListClosingIssues(ctx context.Context, number int) ([]int, error) {
+	stdout, stderr, err := ghAPI(ctx, "graphql",
+		"-f", "query="+closingIssuesQuery,
+		"-F", "owner={owner}",
+		"-F", "name={repo}",
+		"-F", "number="+strconv.Itoa(number),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	var result struct {
+		Data closingIssuesData `json:"data"`
+	}
+	if err = json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return nil, err
+	}
+
+	return result.Data.issues(), nil
+}
+
+// closingIssuesData is the data closingIssuesQuery returns.
+type closingIssuesData struct {
+	Repository struct {
+		PullRequest struct {
+			ClosingIssuesReferences struct {
+				Nodes []struct {
+					Number int `json:"number"`
+				} `json:"nodes"`
+			} `json:"closingIssuesReferences"`
+		} `json:"pullRequest"`
+	} `json:"repository"`
+}
+
+func (d closingIssuesData) issues() []int {
+	var issues []int
+	for _, node := range d.Repository.PullRequest.ClosingIssuesReferences.Nodes {
+		issues = append(issues, node.Number)
+	}
+	return issues
+}
+
+// linkedPullRequestsQuery lists the events that link pull requests to an
+// issue: ConnectedEvent and DisconnectedEvent for the Development sidebar, and
+// CrossReferencedEvent for closing keywords.
+const linkedPullRequestsQuery = `query($owner: String!, $name: String!, $number: Int!) {
+  repository(owner: $owner, name: $name) {
+    issue(number: $number) {
+      timelineItems(first: 100, itemTypes: [CONNECTED_EVENT, DISCONNECTED_EVENT, CROSS_REFERENCED_EVENT]) {
+        nodes {
+          __typename
+          ... on ConnectedEvent {
+            isCrossRepository
+            source { ... on PullRequest { number } }
+            subject { ... on PullRequest { number } }
+          }
+          ... on DisconnectedEvent {
+            isCrossRepository
+            source { ... on PullRequest { number } }
+            subject { ... on PullRequest { number } }
+          }
+          ... on CrossReferencedEvent {
+            isCrossRepository
+            willCloseTarget
+            source { ... on PullRequest { number } }
+          }
+        }
+      }
+    }
+  }
+}`
+
+func (GitHubForge) ListLinkedPullRequests(ctx context.Context, issue int) ([]int, error) {
+	stdout, stderr, err := ghAPI(ctx, "graphql",
+		"-f", "query="+linkedPullRequestsQuery,
+		"-F", "owner={owner}",
+		"-F", "name={repo}",
+		"-F", "number="+strconv.Itoa(issue),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	var result struct {
+		Data linkedPullRequestsData `json:"data"`
+	}
+	if err = json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return nil, err
+	}
+
+	return result.Data.pullRequests(issue), nil
+}
+
+type linkedSubject struct {
+	Number int `json:"number"`
+}
+
+// linkedPullRequestsData is the data linkedPullRequestsQuery returns.
+type linkedPullRequestsData struct {
+	Repository struct {
+		Issue struct {
+			TimelineItems struct {
+				Nodes []struct {
+					Typename          string        `json:"__typename"`
+					IsCrossRepository bool          `json:"isCrossRepository"`
+					WillCloseTarget   bool          `json:"willCloseTarget"`
+					Source            linkedSubject `json:"source"`
+					Subject           linkedSubject `json:"subject"`
+				} `json:"nodes"`
+			} `json:"timelineItems"`
+		} `json:"issue"`
+	} `json:"repository"`
+}
+
+// pullRequests returns the pull requests linked to issue, in order.
+func (d linkedPullRequestsData) pullRequests(issue int) []int {
+	// Events come oldest first, so a disconnect undoes an earlier connect.
+	linked := map[int]bool{}
+	for _, node := range d.Repository.Issue.TimelineItems.Nodes {
+		if node.IsCrossRepository {
+			continue
+		}
+
+		// Either end of a sidebar link may be the pull request; the other one
+		// is the issue, which has no number in this query.
+		number := node.Source.Number
+		if number == 0 || number == issue {
+			number = node.Subject.Number
+		}
+		if number == 0 || number == issue {
+			continue
+		}
+
+		switch node.Typename {
+		case "ConnectedEvent":
+			linked[number] = true
+		case "DisconnectedEvent":
+			delete(linked, number)
+		case "CrossReferencedEvent":
+			if node.WillCloseTarget {
+				linked[number] = true
+			}
+		}
+	}
+
+	numbers := make([]int, 0, len(linked))
+	for number := range linked {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+
+	return numbers
+}
@@ -0,0 +1,55 @@
+package cascade
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// Events hooks run on, see Options.Hooks.
+const (
+	// HookPreRebase runs once a pull request is checked out, before it is
+	// rebased. If it fails, the pull request fails.
+	HookPreRebase = "pre_rebase"
+	// HookPostRebase runs after a pull request was rebased, before Verify and
+	// before it is pushed. If it fails, the pull request fails.
+	HookPostRebase = "post_rebase"
+	// HookPostPush runs after a rebased pull request was pushed.
+	HookPostPush = "post_push"
+	// HookOnConflict runs after a rebase was aborted on a conflict.
+	HookOnConflict = "on_conflict"
+)
+
+// HookEvents are the events hooks can run on.
+var HookEvents = []string{HookPreRebase, HookPostRebase, HookPostPush, HookOnConflict}
+
+// hookEnv describes a pull request to its hooks. newOid is empty until the
+// pull request is rebased.
+func hookEnv(processed ProcessedPullRequest, newOid string) []string {
+	return []string{
+		"CASCADE_PR_NUMBER=" + strconv.Itoa(processed.Number),
+		"CASCADE_PR_BRANCH=" + processed.HeadRefName,
+		"CASCADE_PR_URL=" + processed.URL,
+		"CASCADE_DEPENDENCY_NUMBER=" + strconv.Itoa(processed.DependedPullRequest.Number),
+		"CASCADE_ONTO=" + processed.Onto,
+		"CASCADE_OLD_SHA=" + processed.HeadRefOid,
+		"CASCADE_NEW_SHA=" + newOid,
+	}
+}
+
+// runHook runs the hook of event, if any.
+func runHook(ctx context.Context, opts *Options, event string, processed ProcessedPullRequest, newOid string) error {
+	command := opts.Hooks[event]
+	if command == "" {
+		return nil
+	}
+
+	if output, err := runShell(ctx, command, hookEnv(processed, newOid)); err != nil {
+		if line := lastLine(output); line != "" {
+			err = fmt.Errorf("%w: %s", err, line)
+		}
+		return fmt.Errorf("%s hook failed: %w", event, err)
+	}
+
+	return nil
+}
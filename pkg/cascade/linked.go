@@ -0,0 +1,67 @@
+package cascade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Issue is an issue a pull request may depend on instead of another pull
+// request.
+type Issue struct {
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	URL    string `json:"url"`
+	// State is OPEN or CLOSED.
+	State string `json:"state"`
+}
+
+// ErrIssueNotFound is returned by GetIssue for a number that is not an issue
+// of the repository.
+var ErrIssueNotFound = errors.New("no such issue")
+
+func GetIssue(ctx context.Context, number int) (*Issue, error) {
+	return forge.GetIssue(ctx, number)
+}
+
+func ListClosingIssues(ctx context.Context, number int) ([]int, error) {
+	return forge.ListClosingIssues(ctx, number)
+}
+
+func ListLinkedPullRequests(ctx context.Context, issue int) ([]int, error) {
+	return forge.ListLinkedPullRequests(ctx, issue)
+}
+
+// LinkedDependOns returns the dependencies of a pull request implied by the
+// issues it is linked to on GitHub rather than declared in its body: the pull
+// requests linked to the same issue form a chain in the order they were
+// opened, so a pull request depends on the one opened right before it. Each
+// linked issue contributes at most one dependency.
+func LinkedDependOns(ctx context.Context, number int) ([]int, error) {
+	issues, err := ListClosingIssues(ctx, number)
+	if err != nil {
+		return nil, fmt.Errorf("list issues linked to #%d: %w", number, err)
+	}
+
+	var dependOns []int
+	seen := map[int]bool{}
+	for _, issue := range issues {
+		linked, err := ListLinkedPullRequests(ctx, issue)
+		if err != nil {
+			return nil, fmt.Errorf("list pull requests linked to #%d: %w", issue, err)
+		}
+
+		previous := 0
+		for _, other := range linked {
+			if other < number && other > previous {
+				previous = other
+			}
+		}
+		if previous != 0 && !seen[previous] {
+			seen[previous] = true
+			dependOns = append(dependOns, previous)
+		}
+	}
+
+	return dependOns, nil
+}
@@ -0,0 +1,116 @@
+package cascade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lockFile is the name of the lock file in the git directory shared by every
+// worktree of the repository.
+const lockFile = "cascade.lock"
+
+// LockedError is returned by Lock when another run holds the lock.
+type LockedError struct {
+	Path string
+	// PID and Since are those recorded by the run holding the lock, and zero
+	// if the lock file could not be read.
+	PID   int
+	Since time.Time
+}
+
+func (e *LockedError) Error() string {
+	if e.PID == 0 {
+		return fmt.Sprintf("another gh cascade run holds %s", e.Path)
+	}
+	return fmt.Sprintf("another gh cascade run (pid %d) holds %s since %s", e.PID, e.Path, e.Since.Local().Format(time.DateTime))
+}
+
+// Lock takes the advisory lock that keeps two runs from fighting over the
+// branches and the index of the same repository, and returns a function that
+// releases it. With force, the lock is broken first, whether or not the run
+// holding it is still going, e.g. to recover from one that was killed.
+// Releasing only removes the lock file this run created, so releasing again,
+// or after another run broke the lock and took it, leaves it alone.
+func Lock(ctx context.Context, force bool) (func() error, error) {
+	// A replayed run changes no repository, and the one it names is not
+	// necessarily on this machine.
+	if isReplaying() {
+		return func() error { return nil }, nil
+	}
+
+	stdout, stderr, err := runGit(ctx, "rev-parse", "--git-common-dir")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+	path, err := filepath.Abs(filepath.Join(strings.TrimSpace(stdout.String()), lockFile))
+	if err != nil {
+		return nil, err
+	}
+
+	if force {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("remove %s: %w", path, err)
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return nil, readLock(path)
+	} else if err != nil {
+		return nil, fmt.Errorf("create %s: %w", path, err)
+	}
+
+	content := fmt.Sprintf("%d\n%s\n", os.Getpid(), time.Now().UTC().Format(time.RFC3339Nano))
+	_, err = f.WriteString(content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return nil, fmt.Errorf("write %s: %w", path, err)
+	}
+
+	return func() error {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) || err == nil && string(data) != content {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("read %s: %w", path, err)
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove %s: %w", path, err)
+		}
+		return nil
+	}, nil
+}
+
+// readLock describes the lock at path for the run that failed to take it.
+func readLock(path string) *LockedError {
+	lockedErr := &LockedError{Path: path}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return lockedErr
+	}
+	lines := strings.Split(string(data), "\n")
+	if len(lines) < 2 {
+		return lockedErr
+	}
+	pid, err := strconv.Atoi(lines[0])
+	if err != nil {
+		return lockedErr
+	}
+	since, err := time.Parse(time.RFC3339, lines[1])
+	if err != nil {
+		return lockedErr
+	}
+
+	lockedErr.PID, lockedErr.Since = pid, since
+	return lockedErr
+}
@@ -0,0 +1,50 @@
+package cascade
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLock(t *testing.T) {
+	git := newTestRepository(t)
+	chdir(t, git("rev-parse", "--show-toplevel"))
+	ctx := context.Background()
+	path, err := filepath.Abs(filepath.Join(git("rev-parse", "--git-common-dir"), lockFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err := Lock(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lockedErr *LockedError
+	if _, err := Lock(ctx, false); !errors.As(err, &lockedErr) || lockedErr.PID != os.Getpid() {
+		t.Fatalf("Lock() while locked: error = %v, want a LockedError for pid %d", err, os.Getpid())
+	}
+
+	// Another run breaks the lock and takes it.
+	forcedUnlock, err := Lock(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("releasing a broken lock removed the lock of the run that broke it: %v", err)
+	}
+
+	if err := forcedUnlock(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("lock file left behind: %v", err)
+	}
+	if err := forcedUnlock(); err != nil {
+		t.Errorf("releasing twice: %v", err)
+	}
+}
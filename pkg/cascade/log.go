@@ -0,0 +1,84 @@
+package cascade
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cli/go-gh/v2"
+)
+
+// runCommand runs cmd and logs the command line, its duration and, at debug
+// level, its output.
+func runCommand(cmd *exec.Cmd) error {
+	var stdout, stderr bytes.Buffer
+	debug := slog.Default().Enabled(context.Background(), slog.LevelDebug)
+	if debug {
+		cmd.Stdout = teeWriter(cmd.Stdout, &stdout)
+		cmd.Stderr = teeWriter(cmd.Stderr, &stderr)
+	}
+
+	started := time.Now()
+	err := cmd.Run()
+	logCommand(strings.TrimSuffix(filepath.Base(cmd.Path), ".exe"), cmd.Args[1:], time.Since(started), err, &stdout, &stderr)
+
+	return err
+}
+
+// ghExec is gh.ExecContext with logging. Commands that fail on a rate limit
+// or a transient server error are retried, see retryDelay.
+func ghExec(ctx context.Context, args ...string) (stdout, stderr bytes.Buffer, err error) {
+	for attempt := 0; ; attempt++ {
+		started := time.Now()
+		cmdCtx, cancel := commandContext(ctx)
+		stdout, stderr, err = runRecorded("gh", args, func() (stdout, stderr bytes.Buffer, err error) {
+			return gh.ExecContext(cmdCtx, args...)
+		})
+		err = timeoutError(cmdCtx, ctx, err)
+		cancel()
+		logCommand("gh", args, time.Since(started), err, &stdout, &stderr)
+		if err == nil || ctx.Err() != nil {
+			return stdout, stderr, err
+		}
+
+		wait, retry := retryDelay(ctx, stderr.String(), nil, isIdempotent(args), attempt)
+		if !retry {
+			return stdout, stderr, err
+		}
+		// A replayed run has nothing to wait for.
+		if isReplaying() {
+			wait = 0
+		}
+		slog.Warn("retrying", slog.String("cmd", Redact("gh "+strings.Join(args, " "))), slog.Duration("in", wait), slog.String("error", Redact(strings.TrimSpace(stderr.String()))))
+
+		select {
+		case <-ctx.Done():
+			return stdout, stderr, err
+		case <-time.After(wait):
+		}
+	}
+}
+
+func logCommand(name string, args []string, duration time.Duration, err error, stdout, stderr *bytes.Buffer) {
+	attrs := []any{
+		slog.String("cmd", Redact(name+" "+strings.Join(args, " "))),
+		slog.Duration("duration", duration),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", Redact(err.Error())))
+	}
+	slog.Info("exec", attrs...)
+	slog.Debug("output", slog.String("cmd", name), slog.String("stdout", Redact(stdout.String())), slog.String("stderr", Redact(stderr.String())))
+}
+
+func teeWriter(w io.Writer, buf *bytes.Buffer) io.Writer {
+	if w == nil {
+		return buf
+	}
+	return io.MultiWriter(w, buf)
+}
@@ -0,0 +1,264 @@
+package cascade
+
+import (
+	"strings"
+)
+
+// textRange is the byte range [Start, End) of a string.
+type textRange struct {
+	Start, End int
+}
+
+// inRanges reports whether offset i lies within one of ranges, which are
+// ordered.
+func inRanges(ranges []textRange, i int) bool {
+	for _, r := range ranges {
+		if i < r.Start {
+			return false
+		}
+		if i < r.End {
+			return true
+		}
+	}
+	return false
+}
+
+// nonProseRanges returns the parts of a Markdown body that are code or
+// quoted rather than written by its author for what they say, in order:
+// fenced and indented code blocks, blockquotes and inline code spans. They
+// often hold examples, such as a "Depends on: #123" in a pull request
+// template, or what someone else wrote.
+func nonProseRanges(body string) []textRange {
+	blocks := blockRanges(body)
+
+	var ranges []textRange
+	last := 0
+	for _, block := range blocks {
+		ranges = append(ranges, codeSpanRanges(body, last, block.Start)...)
+		ranges = append(ranges, block)
+		last = block.End
+	}
+	return append(ranges, codeSpanRanges(body, last, len(body))...)
+}
+
+// blockRanges returns the fenced and indented code blocks and the
+// blockquotes of body, each spanning whole lines. A fence that is never closed
+// runs to the end of body, and a blockquote goes on over the lines that lazily
+// continue it up to a blank line, as CommonMark has it. A line indented by
+// four spaces or more is code unless it continues a paragraph or is within a
+// list item, which this does not tell apart from code nested in it.
+func blockRanges(body string) []textRange {
+	var (
+		ranges  []textRange
+		fence   string
+		quoting bool
+		start   int
+		// codeEnd is the end of the last line of the indented code block
+		// being scanned, if any, which trailing blank lines are not part of.
+		codeEnd   int
+		paragraph bool
+		listing   bool
+	)
+
+	for offset := 0; offset < len(body); {
+		end := len(body)
+		if i := strings.IndexByte(body[offset:], '\n'); i >= 0 {
+			end = offset + i + 1
+		}
+		line := strings.TrimRight(body[offset:end], "\r\n")
+		blank := strings.TrimSpace(line) == ""
+
+		if codeEnd > 0 && !blank && !isIndentedCode(line) {
+			ranges = append(ranges, textRange{start, codeEnd})
+			codeEnd = 0
+		}
+
+		prose := false
+		switch {
+		case fence != "":
+			if isClosingFence(line, fence) {
+				ranges = append(ranges, textRange{start, end})
+				fence = ""
+			}
+		case codeEnd > 0:
+			if !blank {
+				codeEnd = end
+			}
+		case isIndentedCode(line) && !paragraph && !listing && !quoting:
+			start, codeEnd = offset, end
+		case openingFence(line) != "":
+			if quoting {
+				ranges = append(ranges, textRange{start, offset})
+				quoting = false
+			}
+			fence, start = openingFence(line), offset
+			listing = false
+		case isBlockquote(line):
+			if !quoting {
+				quoting, start = true, offset
+			}
+		case quoting && blank:
+			ranges = append(ranges, textRange{start, offset})
+			quoting = false
+		case !quoting && !blank:
+			prose = true
+			if isListItem(line) {
+				listing = true
+			} else if !isIndentedCode(line) && !paragraph {
+				listing = false
+			}
+		}
+		paragraph = prose
+
+		offset = end
+	}
+
+	switch {
+	case codeEnd > 0:
+		ranges = append(ranges, textRange{start, codeEnd})
+	case fence != "" || quoting:
+		ranges = append(ranges, textRange{start, len(body)})
+	}
+	return ranges
+}
+
+// isIndentedCode reports whether line is indented as a line of an indented
+// code block is, by four columns or more, a tab counting to the next
+// multiple of four.
+func isIndentedCode(line string) bool {
+	column := 0
+	for _, c := range line {
+		switch c {
+		case ' ':
+			column++
+		case '\t':
+			column += 4 - column%4
+		default:
+			return column >= 4
+		}
+		if column >= 4 {
+			return strings.TrimSpace(line) != ""
+		}
+	}
+	return false
+}
+
+// isListItem reports whether line starts an item of a bullet or ordered list,
+// as "- ", "* ", "+ ", "1. " or "1) " do.
+func isListItem(line string) bool {
+	trimmed, ok := trimIndent(line)
+	if !ok {
+		return false
+	}
+	if len(trimmed) >= 2 && strings.ContainsRune("-*+", rune(trimmed[0])) && (trimmed[1] == ' ' || trimmed[1] == '\t') {
+		return true
+	}
+	digits := len(trimmed) - len(strings.TrimLeft(trimmed, "0123456789"))
+	return digits > 0 && digits <= 9 && len(trimmed) > digits+1 &&
+		(trimmed[digits] == '.' || trimmed[digits] == ')') && (trimmed[digits+1] == ' ' || trimmed[digits+1] == '\t')
+}
+
+// openingFence returns the fence a line opens a fenced code block with, e.g.
+// "```" or "~~~~", or "" if it opens none.
+func openingFence(line string) string {
+	trimmed, ok := trimIndent(line)
+	if !ok || len(trimmed) < 3 || (trimmed[0] != '`' && trimmed[0] != '~') {
+		return ""
+	}
+	n := len(trimmed) - len(strings.TrimLeft(trimmed, trimmed[:1]))
+	if n < 3 {
+		return ""
+	}
+	// Backticks in the info string make it an inline code span instead.
+	if trimmed[0] == '`' && strings.Contains(trimmed[n:], "`") {
+		return ""
+	}
+	return trimmed[:n]
+}
+
+// isClosingFence reports whether line closes a fenced code block opened with
+// fence: with a fence of the same character at least as long, and nothing
+// else.
+func isClosingFence(line, fence string) bool {
+	trimmed, ok := trimIndent(line)
+	if !ok {
+		return false
+	}
+	trimmed = strings.TrimRight(trimmed, " \t")
+	return len(trimmed) >= len(fence) && strings.Trim(trimmed, fence[:1]) == ""
+}
+
+func isBlockquote(line string) bool {
+	trimmed, ok := trimIndent(line)
+	return ok && strings.HasPrefix(trimmed, ">")
+}
+
+// trimIndent trims the up to three spaces a block may be indented with, and
+// reports whether line was indented less than a code block is.
+func trimIndent(line string) (string, bool) {
+	trimmed := strings.TrimLeft(line, " ")
+	return trimmed, len(line)-len(trimmed) <= 3
+}
+
+// codeSpanRanges returns the inline code spans of body between start and end:
+// a run of backticks up to the next run of as many, within the same
+// paragraph. A backslash before the opening run escapes it.
+func codeSpanRanges(body string, start, end int) []textRange {
+	var ranges []textRange
+	for i := start; i < end; {
+		if body[i] != '`' {
+			i++
+			continue
+		}
+		n := backtickRun(body, i, end)
+		if i > start && body[i-1] == '\\' {
+			i += n
+			continue
+		}
+
+		closing := -1
+		for j := i + n; j < end; {
+			if body[j] == '\n' && isBlankLineAt(body, j+1, end) {
+				break
+			}
+			if body[j] != '`' {
+				j++
+				continue
+			}
+			m := backtickRun(body, j, end)
+			if m == n {
+				closing = j
+				break
+			}
+			j += m
+		}
+
+		if closing < 0 {
+			i += n
+			continue
+		}
+		ranges = append(ranges, textRange{i, closing + n})
+		i = closing + n
+	}
+	return ranges
+}
+
+// backtickRun returns the length of the run of backticks at i, before end.
+func backtickRun(s string, i, end int) int {
+	n := 0
+	for i+n < end && s[i+n] == '`' {
+		n++
+	}
+	return n
+}
+
+// isBlankLineAt reports whether the line starting at i, before end, holds
+// nothing but whitespace.
+func isBlankLineAt(s string, i, end int) bool {
+	for ; i < end && s[i] != '\n'; i++ {
+		if s[i] != ' ' && s[i] != '\t' && s[i] != '\r' {
+			return false
+		}
+	}
+	return true
+}
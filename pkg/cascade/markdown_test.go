@@ -0,0 +1,173 @@
+package cascade
+
+import (
+	"slices"
+	"testing"
+)
+
+// rangeTexts returns the parts of s that ranges cover.
+func rangeTexts(s string, ranges []textRange) []string {
+	var texts []string
+	for _, r := range ranges {
+		texts = append(texts, s[r.Start:r.End])
+	}
+	return texts
+}
+
+func TestBlockRanges(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "backtick fence",
+			body: "before\n```go\ncode\n```\nafter\n",
+			want: []string{"```go\ncode\n```\n"},
+		},
+		{
+			name: "tilde fence",
+			body: "~~~\ncode\n~~~\nafter",
+			want: []string{"~~~\ncode\n~~~\n"},
+		},
+		{
+			name: "closed by a longer fence only",
+			body: "````\n```\ncode\n`````\nafter",
+			want: []string{"````\n```\ncode\n`````\n"},
+		},
+		{
+			name: "not closed by the other character",
+			body: "```\ncode\n~~~\nstill code",
+			want: []string{"```\ncode\n~~~\nstill code"},
+		},
+		{
+			name: "unclosed fence",
+			body: "before\n```\ncode\nmore",
+			want: []string{"```\ncode\nmore"},
+		},
+		{
+			name: "indented fence",
+			body: "   ```\n   code\n  ```\nafter",
+			want: []string{"   ```\n   code\n  ```\n"},
+		},
+		{
+			name: "backticks in the info string",
+			body: "``` a ` b\nprose",
+		},
+		{
+			name: "indented code",
+			body: "before\n\n    code\n\tmore code\n\n    and more\n\nafter",
+			want: []string{"    code\n\tmore code\n\n    and more\n"},
+		},
+		{
+			name: "indented fence is indented code",
+			body: "    ```\n    code\nafter",
+			want: []string{"    ```\n    code\n"},
+		},
+		{
+			name: "paragraph continuation",
+			body: "before\n    not code\n",
+		},
+		{
+			name: "list item continuation",
+			body: "- item\n\n    not code\n",
+		},
+		{
+			name: "indented code after a list",
+			body: "- item\n\nafter\n\n    code\n",
+			want: []string{"    code\n"},
+		},
+		{
+			name: "blockquote",
+			body: "> quoted\nlazily quoted\n\nafter",
+			want: []string{"> quoted\nlazily quoted\n"},
+		},
+		{
+			name: "nested blockquote",
+			body: "> quoted\n> > nested\n>> nested too\n\nafter",
+			want: []string{"> quoted\n> > nested\n>> nested too\n"},
+		},
+		{
+			name: "fence ends a blockquote",
+			body: "> quoted\n```\ncode\n```\nafter",
+			want: []string{"> quoted\n", "```\ncode\n```\n"},
+		},
+		{
+			name: "CRLF",
+			body: "```\r\ncode\r\n```\r\nafter",
+			want: []string{"```\r\ncode\r\n```\r\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rangeTexts(tt.body, blockRanges(tt.body)); !slices.Equal(got, tt.want) {
+				t.Errorf("blockRanges(%q) = %q, want %q", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCodeSpanRanges(t *testing.T) {
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{"a `code` b", []string{"`code`"}},
+		{"`one` and `two`", []string{"`one`", "`two`"}},
+		{"``a ` b``", []string{"``a ` b``"}},
+		{"```a `` b```", []string{"```a `` b```"}},
+		{"``a `b` c`` d", []string{"``a `b` c``"}},
+		{"`unclosed", nil},
+		{"``not closed by`", nil},
+		{"`across\na line`", []string{"`across\na line`"}},
+		{"`not across\n\na blank line`", nil},
+		{"\\`escaped` `code`", []string{"` `"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			if got := rangeTexts(tt.body, codeSpanRanges(tt.body, 0, len(tt.body))); !slices.Equal(got, tt.want) {
+				t.Errorf("codeSpanRanges(%q) = %q, want %q", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNonProseRanges(t *testing.T) {
+	body := "`span`\n```\n`in fence`\n```\n> `in quote`\n\n    `in code`\n\n``after``\n"
+	want := []string{"`span`", "```\n`in fence`\n```\n", "> `in quote`\n", "    `in code`\n", "``after``"}
+	if got := rangeTexts(body, nonProseRanges(body)); !slices.Equal(got, want) {
+		t.Errorf("nonProseRanges(%q) = %q, want %q", body, got, want)
+	}
+}
+
+func TestParseDependOnsOutsideOfCode(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []int
+	}{
+		{"in a fence", "```\nDepends on: #1\n```", nil},
+		{"in a tilde fence", "~~~\nDepends on: #1\n~~~", nil},
+		{"in an unclosed fence", "```\nDepends on: #1", nil},
+		{"in an indented fence", "  ~~~\n  Depends on: #1\n  ~~~", nil},
+		{"in indented code", "Example:\n\n    Depends on: #1", nil},
+		{"in a nested blockquote", "> > Depends on: #1", nil},
+		{"in a code span", "Write `Depends on: #1`", nil},
+		{"in a multi-backtick code span", "Write ``` `` Depends on: #1 `` ```", nil},
+		{"right after a fence", "```\nexample\n```\nDepends on: #2", []int{2}},
+		{"right after a tilde fence", "~~~\nDepends on: #1\n~~~\nDepends on: #2", []int{2}},
+		{"after indented code", "    Depends on: #1\nDepends on: #2", []int{2}},
+		{"paragraph continuation", "Some text\n    Depends on: #3", []int{3}},
+		{"after a blockquote", "> Depends on: #1\n\nDepends on: #4", []int{4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseDependOns(tt.body); !slices.Equal(got, tt.want) {
+				t.Errorf("ParseDependOns(%q) = %v, want %v", tt.body, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package cascade
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// markerNotesRef holds the markers, as git notes on the head of the pull
+// request they are about.
+const markerNotesRef = "refs/notes/cascade"
+
+// Marker records how a pull request at a given head was last rebased, so that
+// a later run can tell that nothing changed since: neither the head, nor its
+// dependency, nor the commit it is rebased onto.
+type Marker struct {
+	// Onto is the commit the pull request was rebased onto, and Dependency
+	// the head of the dependency whose commits were replaced.
+	Onto       string
+	Dependency string
+	// Conflicted is set if the rebase conflicted. Otherwise Tip is the
+	// rebased branch, which was kept locally instead of pushed.
+	Conflicted bool
+	Tip        string
+}
+
+// Matches reports whether m was recorded for rebasing onto onto, with the
+// dependency at dependency.
+func (m Marker) Matches(onto, dependency string) bool {
+	return m.Onto == onto && m.Dependency == dependency
+}
+
+// ReadMarker returns the marker recorded for head, and false if there is
+// none.
+func ReadMarker(ctx context.Context, head string) (Marker, bool, error) {
+	stdout, stderr, err := runGit(ctx, "notes", "--ref="+markerNotesRef, "show", head)
+	if exitCode(err) == 1 {
+		return Marker{}, false, nil
+	} else if err != nil {
+		return Marker{}, false, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	var m Marker
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch key {
+		case "onto":
+			m.Onto = value
+		case "dependency":
+			m.Dependency = value
+		case "conflicted":
+			m.Conflicted = true
+		case "tip":
+			m.Tip = value
+		}
+	}
+	if m.Onto == "" || m.Dependency == "" {
+		return Marker{}, false, nil
+	}
+
+	return m, true, nil
+}
+
+// WriteMarker records m for head, replacing any earlier marker.
+func WriteMarker(ctx context.Context, head string, m Marker) error {
+	lines := []string{"onto " + m.Onto, "dependency " + m.Dependency}
+	if m.Conflicted {
+		lines = append(lines, "conflicted")
+	} else {
+		lines = append(lines, "tip "+m.Tip)
+	}
+
+	_, stderr, err := runGit(ctx, "notes", "--ref="+markerNotesRef, "add", "--force", "--message", strings.Join(lines, "\n"), head)
+	if err != nil {
+		return fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package cascade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// States of a pull request in a merge queue, see MergeQueueStatus.
+const (
+	// MergeQueueQueued is a pull request waiting in the queue, or whose
+	// merge group is being checked.
+	MergeQueueQueued = "queued"
+	// MergeQueueMerging is a pull request the queue is merging.
+	MergeQueueMerging = "merging"
+)
+
+// MergeQueueStatus tells whether the base branch of a pull request has a
+// merge queue, and where the pull request stands in it.
+type MergeQueueStatus struct {
+	Enabled bool
+	// State is MergeQueueQueued or MergeQueueMerging, or empty if the pull
+	// request is not in the queue. A pull request the queue removes, e.g.
+	// because the checks of its merge group failed, is open again with no
+	// state.
+	State string
+	// Position is where the pull request is in the queue, starting at 1.
+	Position int
+}
+
+func GetMergeQueueStatus(ctx context.Context, number int) (MergeQueueStatus, error) {
+	return forge.GetMergeQueueStatus(ctx, number)
+}
+
+func EnqueuePullRequest(ctx context.Context, pullRequestID, expectedHeadOid string) error {
+	return forge.EnqueuePullRequest(ctx, pullRequestID, expectedHeadOid)
+}
+
+// WaitForQueuedMerge polls a pull request added to the merge queue until
+// GitHub reports it as merged, and fails as soon as it is removed from the
+// queue instead. onState is called whenever its MergeQueueStatus changes.
+func WaitForQueuedMerge(ctx context.Context, number int, interval, timeout time.Duration, onState func(MergeQueueStatus)) (*PullRequest, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var last MergeQueueStatus
+	for {
+		pr, err := GetPullRequest(ctx, number)
+		if err != nil {
+			return nil, err
+		}
+
+		switch pr.State {
+		case "MERGED":
+			return pr, nil
+		case "CLOSED":
+			return nil, errors.New("closed without merging")
+		}
+
+		status, err := GetMergeQueueStatus(ctx, number)
+		if err != nil {
+			return nil, err
+		}
+		if status.State == "" {
+			// GitHub may report the pull request as open for a moment after
+			// the queue merged it.
+			if pr, err = GetPullRequest(ctx, number); err == nil && pr.State == "MERGED" {
+				return pr, nil
+			}
+			return nil, errors.New("removed from the merge queue without merging")
+		}
+		if status != last {
+			last = status
+			onState(status)
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, fmt.Errorf("timed out after %s waiting in the merge queue", timeout)
+			}
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// enableAutoMerge enables auto-merge on pr with method. On a base branch with
+// a merge queue the queue decides how to merge, so the pull request is
+// instead added to it once its checks pass.
+func enableAutoMerge(ctx context.Context, pr PullRequest, method string) error {
+	status, err := GetMergeQueueStatus(ctx, pr.Number)
+	if err != nil {
+		return err
+	}
+	if status.Enabled {
+		method = ""
+	}
+
+	return EnableAutoMerge(ctx, pr.ID, method)
+}
@@ -0,0 +1,192 @@
+package cascade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// ErrCannotReplay is returned by ReplayOntoPullRequest when a pull request
+// has to be rebased in a working tree instead.
+var ErrCannotReplay = errors.New("cannot replay without a working tree")
+
+// ReplayOntoPullRequest replays the commits of topicBranch after oldParent
+// onto targetBase as CherryPickOntoPullRequest does, one by one and following
+// first parents only, but at the object level: each commit is merged with git
+// merge-tree and written as a new commit with the author, date and message of
+// the old one, so that neither the working tree nor the index is touched,
+// which saves checking out large trees. It returns the new tip and leaves
+// topicBranch as it is. Commits whose change is already in targetBase or that
+// end up empty are dropped.
+// An error wrapping ErrCannotReplay is returned when the pull request has to
+// go through RebaseOntoPullRequest instead: when a commit conflicts, which
+// rerere may resolve there, when signing is asked for with Sign or
+// commit.gpgSign, with RebaseMerges or Autosquash, and with a git older than
+// 2.40.
+func ReplayOntoPullRequest(ctx context.Context, targetBase, oldParent, topicBranch string, opts RebaseOptions) (string, error) {
+	signing, err := getConfig(ctx, "--bool", "commit.gpgSign")
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case opts.Sign || signing == "true":
+		return "", fmt.Errorf("%w: commits are to be signed", ErrCannotReplay)
+	case opts.RebaseMerges:
+		return "", fmt.Errorf("%w: merge commits are to be recreated", ErrCannotReplay)
+	case opts.Autosquash:
+		return "", fmt.Errorf("%w: commits are to be autosquashed", ErrCannotReplay)
+	}
+
+	tip, err := RevParse(ctx, topicBranch)
+	if err != nil {
+		return "", err
+	}
+	base, err := RevParse(ctx, targetBase+"^{commit}")
+	if err != nil {
+		return "", err
+	}
+
+	stdout, stderr, err := runGit(ctx, "rev-list", "--reverse", "--first-parent", "--no-merges", oldParent+".."+tip)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+	commits := strings.Fields(stdout.String())
+	upstream, err := ListUpstreamCommits(ctx, targetBase, tip, oldParent)
+	if err != nil {
+		return "", err
+	}
+
+	stdout, stderr, err = runGit(ctx, "var", "GIT_COMMITTER_IDENT")
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+	committer := strings.TrimSpace(stdout.String())
+
+	head := base
+	tree, err := RevParse(ctx, base+"^{tree}")
+	if err != nil {
+		return "", err
+	}
+	for _, commit := range commits {
+		if upstream[commit] {
+			continue
+		}
+
+		merged, err := mergeCommitTree(ctx, head, commit)
+		if err != nil {
+			return "", err
+		}
+		if merged == tree {
+			continue
+		}
+
+		if head, err = writeReplayedCommit(ctx, commit, merged, head, committer); err != nil {
+			return "", err
+		}
+		tree = merged
+	}
+
+	return head, nil
+}
+
+// replayOrRebase moves pr onto targetBase with ReplayOntoPullRequest and
+// points its branch at the new tip, checking it out if checkedOut. A pull
+// request that cannot be replayed is checked out and rebased with
+// RebaseOntoPullRequest instead.
+func replayOrRebase(ctx context.Context, targetBase, oldParent string, pr PullRequest, opts RebaseOptions, checkedOut bool) (bool, error) {
+	branch := PullRequestBranch(pr.Number)
+	tip, err := ReplayOntoPullRequest(ctx, targetBase, oldParent, branch, opts)
+	if errors.Is(err, ErrCannotReplay) {
+		slog.Info("rebasing in the working tree", slog.Int("pr", pr.Number), slog.String("reason", err.Error()))
+		if !checkedOut {
+			if err := CheckoutPullRequest(ctx, pr); err != nil {
+				return false, err
+			}
+		}
+		return RebaseOntoPullRequest(ctx, targetBase, oldParent, branch, opts)
+	} else if err != nil {
+		return false, err
+	}
+
+	if checkedOut {
+		_, stderr, err := runGit(ctx, "checkout", "--quiet", "-B", branch, tip)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+		}
+		return false, nil
+	}
+	return false, ResetBranch(ctx, branch, tip)
+}
+
+// mergeCommitTree merges the change of commit onto head with git merge-tree
+// and returns the resulting tree.
+func mergeCommitTree(ctx context.Context, head, commit string) (string, error) {
+	stdout, stderr, err := runGit(ctx, "merge-tree", "--write-tree", "--no-messages", "--merge-base="+commit+"^", head, commit)
+	switch {
+	case err == nil:
+		return strings.TrimSpace(stdout.String()), nil
+	case exitCode(err) == 1:
+		return "", fmt.Errorf("%w: %s conflicts", ErrCannotReplay, commit[:7])
+	case strings.Contains(stderr.String(), "unknown option"):
+		return "", fmt.Errorf("%w: git 2.40 or later is required", ErrCannotReplay)
+	}
+	return "", fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+}
+
+// writeReplayedCommit writes a copy of commit with tree and parent, committed
+// by committer, and returns it. The headers of commit other than its tree,
+// parents, committer and signature are kept as they are, the author date
+// included, which git commit-tree would not keep without setting
+// GIT_AUTHOR_DATE.
+func writeReplayedCommit(ctx context.Context, commit, tree, parent, committer string) (string, error) {
+	stdout, stderr, err := runGit(ctx, "cat-file", "commit", commit)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+	headers, message, _ := strings.Cut(stdout.String(), "\n\n")
+
+	var object strings.Builder
+	fmt.Fprintf(&object, "tree %s\nparent %s\n", tree, parent)
+	skipping := false
+	for _, line := range strings.Split(headers, "\n") {
+		// Multi-line headers, e.g. signatures, go on with lines starting
+		// with a space.
+		if strings.HasPrefix(line, " ") {
+			if !skipping {
+				object.WriteString(line + "\n")
+			}
+			continue
+		}
+		name, _, _ := strings.Cut(line, " ")
+		skipping = name == "tree" || name == "parent" || name == "gpgsig" || name == "gpgsig-sha256" || name == "mergetag"
+		switch {
+		case name == "committer":
+			object.WriteString("committer " + committer + "\n")
+		case !skipping:
+			object.WriteString(line + "\n")
+		}
+	}
+	object.WriteString("\n" + message)
+
+	stdout, stderr, err = runGit(ctx, "rev-parse", "--git-path", "CASCADE_COMMIT")
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+	path := strings.TrimSpace(stdout.String())
+	// A replayed run only replays the git hash-object below.
+	if !isReplaying() {
+		if err := os.WriteFile(path, []byte(object.String()), 0o644); err != nil {
+			return "", err
+		}
+		defer os.Remove(path)
+	}
+
+	stdout, stderr, err = runGit(ctx, "hash-object", "-t", "commit", "-w", path)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,191 @@
+package cascade
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// metadataInfo is the info string of the fenced code block that holds the
+// Metadata of a pull request body.
+const metadataInfo = "cascade"
+
+// AutoMergeOff is the Metadata.AutoMerge of a pull request to leave
+// auto-merge off for, whatever Options.AutoMerge says.
+const AutoMergeOff = "off"
+
+// Metadata is what a fenced cascade block in the body of a pull request
+// declares, a machine-readable alternative to "Depends on" lines:
+//
+//	```cascade
+//	depends-on: 123
+//	base: release/1.2
+//	auto-merge: squash
+//	verify: make test
+//	```
+//
+// All keys are optional, and depends-on also takes a list.
+type Metadata struct {
+	// DependsOn are the pull requests depended on, given as 123, "#123" or
+	// URLs, as in "Depends on" lines. They add to those declared alongside.
+	DependsOn []int `yaml:"depends-on,omitempty"`
+	// Base is the branch to rebase onto, as Options.OntoPullRequests sets.
+	Base string `yaml:"base,omitempty"`
+	// AutoMerge is the merge method to enable auto-merge with once rebased
+	// and pushed, instead of that of Options.AutoMerge, or AutoMergeOff.
+	AutoMerge string `yaml:"auto-merge,omitempty"`
+	// Verify replaces Options.Verify, with Options.MetadataVerify.
+	Verify string `yaml:"verify,omitempty"`
+}
+
+func (m *Metadata) UnmarshalYAML(value *yaml.Node) error {
+	var raw struct {
+		DependsOn yaml.Node `yaml:"depends-on"`
+		Base      string    `yaml:"base"`
+		AutoMerge yaml.Node `yaml:"auto-merge"`
+		Verify    string    `yaml:"verify"`
+	}
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+
+	references := []*yaml.Node{&raw.DependsOn}
+	switch raw.DependsOn.Kind {
+	case 0:
+		references = nil
+	case yaml.SequenceNode:
+		references = raw.DependsOn.Content
+	}
+	for _, reference := range references {
+		number, ok := parseReference(reference.Value)
+		if reference.Kind != yaml.ScalarNode || !ok {
+			return fmt.Errorf("line %d: invalid depends-on %q: must be a pull request number or a URL of one of this repository", reference.Line, reference.Value)
+		}
+		if !slices.Contains(m.DependsOn, number) {
+			m.DependsOn = append(m.DependsOn, number)
+		}
+	}
+
+	switch raw.AutoMerge.Value {
+	case "", "merge", "squash", "rebase", AutoMergeOff:
+		m.AutoMerge = raw.AutoMerge.Value
+	case "true":
+		m.AutoMerge = "merge"
+	case "false":
+		m.AutoMerge = AutoMergeOff
+	default:
+		return fmt.Errorf("line %d: invalid auto-merge %q: must be one of merge, squash, rebase, off", raw.AutoMerge.Line, raw.AutoMerge.Value)
+	}
+
+	m.Base, m.Verify = raw.Base, raw.Verify
+	return nil
+}
+
+// metadataBlock locates the first cascade block of body, not counting the
+// code blocks of blockquotes: start and end span its fences, and content is
+// what is between them.
+func metadataBlock(body string) (start, end int, content string, ok bool) {
+	fence, contentStart := "", 0
+	for offset := 0; offset < len(body); {
+		lineEnd := len(body)
+		if i := strings.IndexByte(body[offset:], '\n'); i >= 0 {
+			lineEnd = offset + i + 1
+		}
+		line := strings.TrimRight(body[offset:lineEnd], "\r\n")
+
+		switch {
+		case fence != "":
+			if isClosingFence(line, fence) {
+				if ok {
+					return start, lineEnd, body[contentStart:offset], true
+				}
+				fence = ""
+			}
+		case openingFence(line) != "":
+			fence = openingFence(line)
+			trimmed, _ := trimIndent(line)
+			ok = strings.TrimSpace(trimmed[len(fence):]) == metadataInfo
+			start, contentStart = offset, lineEnd
+		}
+
+		offset = lineEnd
+	}
+	return 0, 0, "", false
+}
+
+// ParseMetadata returns the Metadata of the cascade block of body, or nil if
+// it has none.
+func ParseMetadata(body string) (*Metadata, error) {
+	_, _, content, ok := metadataBlock(body)
+	if !ok {
+		return nil, nil
+	}
+
+	m := &Metadata{}
+	if err := yaml.Unmarshal([]byte(content), m); err != nil {
+		return nil, fmt.Errorf("invalid cascade block: %w", err)
+	}
+	return m, nil
+}
+
+// SetMetadata writes m to the cascade block of body, replacing the one there
+// is or appending a new one. An empty m removes the block.
+func SetMetadata(body string, m Metadata) string {
+	if len(m.DependsOn) == 0 && m.Base == "" && m.AutoMerge == "" && m.Verify == "" {
+		start, end, _, ok := metadataBlock(body)
+		if !ok {
+			return body
+		}
+		if rest := body[end:]; strings.TrimSpace(rest) != "" {
+			return body[:start] + strings.TrimLeft(rest, "\r\n")
+		}
+		return strings.TrimRight(body[:start], " \t\r\n")
+	}
+
+	var b bytes.Buffer
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+	_ = encoder.Encode(m)
+	block := "```" + metadataInfo + "\n" + b.String() + "```"
+
+	if start, end, _, ok := metadataBlock(body); ok {
+		suffix := body[end:]
+		if end > 0 && body[end-1] == '\n' {
+			suffix = "\n" + suffix
+		}
+		return body[:start] + block + suffix
+	}
+	if body = strings.TrimRight(body, " \t\r\n"); body == "" {
+		return block
+	}
+	return body + "\n\n" + block
+}
+
+// AddMetadataDependOn adds number to the dependencies of the cascade block of
+// body, which is appended if there is none. A body whose block is invalid gets
+// a "Depends on" line instead, see AddDependOn.
+func AddMetadataDependOn(body string, number int) string {
+	m, err := ParseMetadata(body)
+	if err != nil {
+		return addDependOnLine(body, number)
+	}
+	if m == nil {
+		m = &Metadata{}
+	}
+	if !slices.Contains(m.DependsOn, number) {
+		m.DependsOn = append(m.DependsOn, number)
+	}
+	return SetMetadata(body, *m)
+}
+
+// metadataOf returns the Metadata of pr, empty if it has none or an invalid
+// one, which ResolveDependency fails pr for.
+func metadataOf(pr PullRequest) Metadata {
+	if m, _ := ParseMetadata(pr.Body); m != nil {
+		return *m
+	}
+	return Metadata{}
+}
@@ -0,0 +1,184 @@
+package cascade
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    *Metadata
+		wantErr bool
+	}{
+		{
+			name: "no block",
+			body: "Depends on: #1",
+		},
+		{
+			name: "other block",
+			body: "```yaml\ndepends-on: 1\n```",
+		},
+		{
+			name: "every key",
+			body: "Text\n\n```cascade\ndepends-on: 1\nbase: release/1.2\nauto-merge: squash\nverify: make test\n```\n",
+			want: &Metadata{DependsOn: []int{1}, Base: "release/1.2", AutoMerge: "squash", Verify: "make test"},
+		},
+		{
+			name: "list of dependencies",
+			body: "```cascade\ndepends-on: [1, \"#2\", 1]\n```",
+			want: &Metadata{DependsOn: []int{1, 2}},
+		},
+		{
+			name: "tilde fence",
+			body: "~~~cascade\nbase: main\n~~~",
+			want: &Metadata{Base: "main"},
+		},
+		{
+			name: "first block",
+			body: "```cascade\nbase: first\n```\n\n```cascade\nbase: second\n```",
+			want: &Metadata{Base: "first"},
+		},
+		{
+			name: "in a blockquote",
+			body: "> ```cascade\n> base: main\n> ```",
+		},
+		{
+			name: "auto-merge as a boolean",
+			body: "```cascade\nauto-merge: false\n```",
+			want: &Metadata{AutoMerge: AutoMergeOff},
+		},
+		{
+			name: "empty block",
+			body: "```cascade\n```",
+			want: &Metadata{},
+		},
+		{
+			name:    "invalid depends-on",
+			body:    "```cascade\ndepends-on: soon\n```",
+			wantErr: true,
+		},
+		{
+			name:    "invalid auto-merge",
+			body:    "```cascade\nauto-merge: always\n```",
+			wantErr: true,
+		},
+		{
+			name:    "invalid YAML",
+			body:    "```cascade\nbase: [\n```",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMetadata(tt.body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %t", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseMetadata() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetMetadata(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		m    Metadata
+		want string
+	}{
+		{
+			name: "empty body",
+			m:    Metadata{Base: "main"},
+			want: "```cascade\nbase: main\n```",
+		},
+		{
+			name: "appended",
+			body: "Text\n",
+			m:    Metadata{DependsOn: []int{1, 2}},
+			want: "Text\n\n```cascade\ndepends-on:\n  - 1\n  - 2\n```",
+		},
+		{
+			name: "replaced in place",
+			body: "Before\n\n```cascade\nbase: old\n```\n\nAfter",
+			m:    Metadata{Base: "new", AutoMerge: AutoMergeOff},
+			want: "Before\n\n```cascade\nbase: new\nauto-merge: \"off\"\n```\n\nAfter",
+		},
+		{
+			name: "removed",
+			body: "Before\n\n```cascade\nbase: old\n```\n\nAfter",
+			want: "Before\n\nAfter",
+		},
+		{
+			name: "removed at the end",
+			body: "Before\n\n```cascade\nbase: old\n```\n",
+			want: "Before",
+		},
+		{
+			name: "nothing to remove",
+			body: "Before\n",
+			want: "Before\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SetMetadata(tt.body, tt.m)
+			if got != tt.want {
+				t.Fatalf("SetMetadata() = %q, want %q", got, tt.want)
+			}
+
+			m, err := ParseMetadata(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m == nil {
+				m = &Metadata{}
+			}
+			if !reflect.DeepEqual(*m, tt.m) {
+				t.Errorf("ParseMetadata(SetMetadata()) = %+v, want %+v", *m, tt.m)
+			}
+		})
+	}
+}
+
+func TestAddMetadataDependOn(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "no block",
+			body: "Text",
+			want: "Text\n\n```cascade\ndepends-on:\n  - 2\n```",
+		},
+		{
+			name: "added to the block",
+			body: "```cascade\ndepends-on: 1\nbase: main\n```\n",
+			want: "```cascade\ndepends-on:\n  - 1\n  - 2\nbase: main\n```\n",
+		},
+		{
+			name: "already there",
+			body: "```cascade\ndepends-on: [2]\n```",
+			want: "```cascade\ndepends-on:\n  - 2\n```",
+		},
+		{
+			name: "invalid block",
+			body: "```cascade\ndepends-on: soon\n```",
+			want: "```cascade\ndepends-on: soon\n```\n\nDepends on: #2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AddMetadataDependOn(tt.body, 2); got != tt.want {
+				t.Errorf("AddMetadataDependOn(%q, 2) = %q, want %q", tt.body, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package cascade
+
+import "sort"
+
+// Prunable returns the merged dependencies of processedPullRequests whose
+// dependents were all rebased onto their new base, or already were, so that
+// their branches are no longer needed. remoteDone is false for those whose
+// dependents were not all pushed, or of which one is still based on the
+// dependency's branch, which deleting the remote branch would close.
+func Prunable(processedPullRequests []ProcessedPullRequest) (dependencies []PullRequest, remoteDone map[int]bool) {
+	byNumber := map[int]PullRequest{}
+	done := map[int]bool{}
+	remoteDone = map[int]bool{}
+	for _, processed := range processedPullRequests {
+		dependency := processed.DependedPullRequest
+		if dependency == nil || dependency.State != "MERGED" {
+			continue
+		}
+		if _, ok := byNumber[dependency.Number]; !ok {
+			byNumber[dependency.Number] = *dependency
+			done[dependency.Number] = true
+			remoteDone[dependency.Number] = true
+		}
+
+		rebased := processed.Error == nil || processed.Error == ErrUpToDate
+		done[dependency.Number] = done[dependency.Number] && rebased
+		remoteDone[dependency.Number] = remoteDone[dependency.Number] && rebased &&
+			(processed.Pushed || processed.Error == ErrUpToDate) && processed.BaseRefName != dependency.HeadRefName
+	}
+
+	for number, dependency := range byNumber {
+		if done[number] {
+			dependencies = append(dependencies, dependency)
+		} else {
+			delete(remoteDone, number)
+		}
+	}
+	sort.Slice(dependencies, func(i, j int) bool {
+		return dependencies[i].Number < dependencies[j].Number
+	})
+	return dependencies, remoteDone
+}
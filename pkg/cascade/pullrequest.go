@@ -0,0 +1,195 @@
+package cascade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type PullRequest struct {
+	ID          string `json:"id"`
+	BaseRefName string `json:"baseRefName"`
+	HeadRefName string `json:"headRefName"`
+	HeadRefOid  string `json:"headRefOid"`
+	Body        string `json:"body"`
+	IsDraft     bool   `json:"isDraft"`
+	Number      int    `json:"number"`
+	Title       string `json:"title"`
+	URL         string `json:"url"`
+	State       string `json:"state"`
+	MergeCommit struct {
+		Oid string `json:"oid"`
+	} `json:"mergeCommit,omitempty"`
+	Commits           []Commit      `json:"commits"`
+	StatusCheckRollup []StatusCheck `json:"statusCheckRollup"`
+	ReviewDecision    string        `json:"reviewDecision"`
+	Additions         int           `json:"additions"`
+	Deletions         int           `json:"deletions"`
+	// IsCrossRepository is set for a pull request from a fork, which
+	// HeadRepositoryOwner and HeadRepository name.
+	IsCrossRepository   bool `json:"isCrossRepository"`
+	HeadRepositoryOwner struct {
+		Login string `json:"login"`
+	} `json:"headRepositoryOwner"`
+	HeadRepository struct {
+		Name string `json:"name"`
+	} `json:"headRepository"`
+	// MaintainerCanModify is set when the author of a pull request from a
+	// fork allows those with write access to the base repository to push to
+	// its head branch.
+	MaintainerCanModify bool `json:"maintainerCanModify"`
+	// ClosedAt is when the pull request was merged or closed, and zero while
+	// it is open.
+	ClosedAt time.Time `json:"closedAt"`
+}
+
+func GetDefaultBranch(ctx context.Context) (string, error) {
+	return forge.GetDefaultBranch(ctx)
+}
+
+// Commit is a commit of a pull request.
+type Commit struct {
+	Oid string `json:"oid"`
+	// MessageBody is the commit message without its first line.
+	MessageBody string `json:"messageBody"`
+}
+
+// PullRequestFilter narrows down the open pull requests ListPullRequests
+// returns.
+type PullRequestFilter struct {
+	// Authors match any of them; no authors match everyone.
+	Authors  []string
+	Assignee string
+	// Labels must all be present.
+	Labels []string
+	// Milestone is the title of the milestone pull requests must be in.
+	Milestone string
+	// Search is a query in the search syntax of GitHub pull requests must
+	// match, e.g. "head:feature/ -label:blocked".
+	Search string
+	// Limit caps the number of pull requests returned; 0 returns all of them.
+	Limit int
+}
+
+// ListPullRequests returns the open pull requests that match filter, newest
+// first.
+func ListPullRequests(ctx context.Context, filter PullRequestFilter) ([]PullRequest, error) {
+	return forge.ListPullRequests(ctx, filter)
+}
+
+// ErrPullRequestNotFound is returned by GetPullRequest for a number that is
+// not a pull request of the repository, such as an issue.
+var ErrPullRequestNotFound = errors.New("no such pull request")
+
+func GetPullRequest(ctx context.Context, number int) (*PullRequest, error) {
+	return forge.GetPullRequest(ctx, number)
+}
+
+func MarkPullRequestReady(ctx context.Context, number int) error {
+	return forge.MarkPullRequestReady(ctx, number)
+}
+
+func EnableAutoMerge(ctx context.Context, pullRequestID, mergeMethod string) error {
+	return forge.EnableAutoMerge(ctx, pullRequestID, mergeMethod)
+}
+
+// ResolveChain walks from root through the open pull requests that depend on
+// it, one level at a time. It fails if any pull request in the chain has more
+// than one dependent, since the landing order would be ambiguous.
+func ResolveChain(root PullRequest, pullRequests []PullRequest) ([]PullRequest, error) {
+	children := map[int][]PullRequest{}
+	for _, pr := range pullRequests {
+		if dependOns := DependOnsOf(pr); len(dependOns) == 1 {
+			children[dependOns[0]] = append(children[dependOns[0]], pr)
+		}
+	}
+
+	chain := []PullRequest{root}
+	seen := map[int]bool{root.Number: true}
+	for current := root; ; {
+		next := children[current.Number]
+		if len(next) == 0 {
+			return chain, nil
+		}
+		if len(next) > 1 {
+			return nil, fmt.Errorf("chain forks at #%d: %d pull requests depend on it", current.Number, len(next))
+		}
+
+		current = next[0]
+		if seen[current.Number] {
+			return nil, fmt.Errorf("chain loops back to #%d", current.Number)
+		}
+		seen[current.Number] = true
+		chain = append(chain, current)
+	}
+}
+
+// Descendants returns the pull request root and those of pullRequests that
+// depend on it, directly or through others, in the order of pullRequests.
+func Descendants(root int, pullRequests []PullRequest) []PullRequest {
+	children := map[int][]int{}
+	for _, pr := range pullRequests {
+		for _, dependOn := range DependOnsOf(pr) {
+			children[dependOn] = append(children[dependOn], pr.Number)
+		}
+	}
+
+	included := map[int]bool{root: true}
+	queue := []int{root}
+	for len(queue) > 0 {
+		number := queue[0]
+		queue = queue[1:]
+		for _, child := range children[number] {
+			if !included[child] {
+				included[child] = true
+				queue = append(queue, child)
+			}
+		}
+	}
+
+	var descendants []PullRequest
+	for _, pr := range pullRequests {
+		if included[pr.Number] {
+			descendants = append(descendants, pr)
+		}
+	}
+	return descendants
+}
+
+func MergePullRequest(ctx context.Context, number int, method string) error {
+	return forge.MergePullRequest(ctx, number, method)
+}
+
+// WaitForMerge polls the pull request until GitHub reports it as merged.
+func WaitForMerge(ctx context.Context, number int, interval, timeout time.Duration) (*PullRequest, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		pr, err := GetPullRequest(ctx, number)
+		if err != nil {
+			return nil, err
+		}
+
+		switch pr.State {
+		case "MERGED":
+			return pr, nil
+		case "CLOSED":
+			return nil, errors.New("closed without merging")
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, fmt.Errorf("timed out after %s waiting for merge", timeout)
+			}
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+func RetargetPullRequest(ctx context.Context, number int, base string) error {
+	return forge.RetargetPullRequest(ctx, number, base)
+}
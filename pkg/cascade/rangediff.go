@@ -0,0 +1,121 @@
+package cascade
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RangeDiff summarizes how a rebase changed the commits of a branch.
+type RangeDiff struct {
+	Unchanged int
+	Modified  int
+	// Dropped commits are gone after the rebase, e.g. because their change
+	// was already upstream.
+	Dropped int
+	// DroppedCommits are the abbreviated hash and subject of each dropped
+	// commit.
+	DroppedCommits []string
+	// Added commits only exist after the rebase.
+	Added int
+	// Output is the full output of git range-diff.
+	Output string
+}
+
+func (r RangeDiff) String() string {
+	var parts []string
+	for _, part := range []struct {
+		count int
+		label string
+	}{
+		{r.Unchanged, "unchanged"},
+		{r.Modified, "modified"},
+		{r.Dropped, "dropped"},
+		{r.Added, "added"},
+	} {
+		if part.count > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", part.count, part.label))
+		}
+	}
+	if len(parts) == 0 {
+		return "no commits"
+	}
+	return "commits: " + strings.Join(parts, ", ")
+}
+
+// Changed reports whether any patch was modified, dropped or added.
+func (r RangeDiff) Changed() bool {
+	return r.Modified > 0 || r.Dropped > 0 || r.Added > 0
+}
+
+// GetRangeDiff compares the commits between oldBase and oldTip with those
+// between newBase and newTip.
+func GetRangeDiff(ctx context.Context, oldBase, oldTip, newBase, newTip string) (*RangeDiff, error) {
+	stdout, stderr, err := runGit(ctx, "range-diff", "--no-color", oldBase+".."+oldTip, newBase+".."+newTip)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return parseRangeDiff(stdout.String())
+}
+
+// parseRangeDiff summarizes the output of git range-diff.
+func parseRangeDiff(output string) (*RangeDiff, error) {
+	rangeDiff := &RangeDiff{Output: output}
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields, ok := rangeDiffPair(scanner.Text())
+		if !ok {
+			continue
+		}
+		switch fields[2] {
+		case "=":
+			rangeDiff.Unchanged++
+		case "!":
+			rangeDiff.Modified++
+		case "<":
+			rangeDiff.Dropped++
+			// "1:  1234567 < -:  ------- subject"
+			rangeDiff.DroppedCommits = append(rangeDiff.DroppedCommits, strings.Join(append([]string{fields[1]}, fields[5:]...), " "))
+		case ">":
+			rangeDiff.Added++
+		}
+	}
+
+	return rangeDiff, scanner.Err()
+}
+
+// rangeDiffPair returns the fields of a line of git range-diff output that
+// summarizes a commit pair, such as "1:  1234567 = 1:  89abcde subject".
+// git right-aligns the numbers of ranges of ten or more commits, as in
+// " 1:  1234567 =  1:  89abcde subject", while the patch differences below
+// each pair are indented by at least four spaces.
+func rangeDiffPair(line string) ([]string, bool) {
+	if strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t") {
+		return nil, false
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 5 || !isRangeDiffIndex(fields[0]) || !isRangeDiffIndex(fields[3]) {
+		return nil, false
+	}
+	switch fields[2] {
+	case "=", "!", "<", ">":
+		return fields, true
+	}
+	return nil, false
+}
+
+// isRangeDiffIndex reports whether field is the position of a commit in a
+// range, such as "12:", or "-:" for a commit missing from it.
+func isRangeDiffIndex(field string) bool {
+	index, ok := strings.CutSuffix(field, ":")
+	if !ok {
+		return false
+	}
+	_, err := strconv.ParseUint(index, 10, 0)
+	return index == "-" || err == nil
+}
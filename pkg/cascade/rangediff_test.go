@@ -0,0 +1,96 @@
+package cascade
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestParseRangeDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   RangeDiff
+	}{
+		{
+			name:   "no commits",
+			output: "",
+			want:   RangeDiff{},
+		},
+		{
+			name: "short range",
+			output: `1:  1234567 = 1:  89abcde first
+2:  2345678 ! 2:  9abcdef second
+    @@ Metadata
+     ## Commit message ##
+    -    second
+    +    second, reworded
+3:  3456789 < -:  ------- third
+-:  ------- > 3:  abcdef0 fourth
+`,
+			want: RangeDiff{Unchanged: 1, Modified: 1, Dropped: 1, DroppedCommits: []string{"3456789 third"}, Added: 1},
+		},
+		{
+			name: "right-aligned numbers",
+			output: ` 9:  1234567 =  9:  89abcde ninth
+10:  2345678 ! 10:  9abcdef tenth
+    @@ f10
+    -1: 2 = 3: 4 looks like a pair
+11:  3456789 <  -:  ------- eleventh subject
+ -:  ------- > 11:  abcdef0 twelfth
+`,
+			want: RangeDiff{Unchanged: 1, Modified: 1, Dropped: 1, DroppedCommits: []string{"3456789 eleventh subject"}, Added: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRangeDiff(tt.output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.want.Output = tt.output
+			if got.Unchanged != tt.want.Unchanged || got.Modified != tt.want.Modified || got.Dropped != tt.want.Dropped ||
+				got.Added != tt.want.Added || !slices.Equal(got.DroppedCommits, tt.want.DroppedCommits) || got.Output != tt.want.Output {
+				t.Errorf("parseRangeDiff() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetRangeDiff(t *testing.T) {
+	git := newTestRepository(t)
+	oldBase := git("rev-parse", "HEAD")
+
+	git("checkout", "--quiet", "-b", "topic")
+	var commits []string
+	for i := 1; i <= 12; i++ {
+		commits = append(commits, commitFile(t, git, fmt.Sprintf("f%d", i), fmt.Sprintf("%d\n", i), fmt.Sprintf("c%d", i)))
+	}
+	oldTip := git("rev-parse", "HEAD")
+
+	git("checkout", "--quiet", "main")
+	newBase := commitFile(t, git, "upstream", "upstream\n", "upstream")
+	for i, commit := range commits {
+		switch i + 1 {
+		case 5:
+			// Dropped.
+		case 7:
+			git("cherry-pick", commit)
+			git("commit", "--quiet", "--amend", "--message=c7, reworded")
+		default:
+			git("cherry-pick", commit)
+		}
+	}
+	newTip := git("rev-parse", "HEAD")
+
+	got, err := GetRangeDiff(context.Background(), oldBase, oldTip, newBase, newTip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dropped := []string{git("rev-parse", "--short", commits[4]) + " c5"}
+	if got.Unchanged != 10 || got.Modified != 1 || got.Dropped != 1 || got.Added != 0 || !slices.Equal(got.DroppedCommits, dropped) {
+		t.Errorf("GetRangeDiff() = %s, dropped %q, want 10 unchanged, 1 modified, 1 dropped, dropped %q\n%s", got, got.DroppedCommits, dropped, got.Output)
+	}
+}
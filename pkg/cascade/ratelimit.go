@@ -0,0 +1,205 @@
+package cascade
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cli/go-gh/v2"
+)
+
+const (
+	// maxRetries is how many times a failed gh command is retried.
+	maxRetries = 3
+	// maxRateLimitWait is the longest a command waits for the primary rate
+	// limit to reset; runs that would wait longer fail instead.
+	maxRateLimitWait = 15 * time.Minute
+)
+
+var (
+	// primaryRateLimitRegexp matches gh and API errors for an exhausted
+	// quota.
+	primaryRateLimitRegexp = regexp.MustCompile(`(?i)API rate limit exceeded`)
+	// secondaryRateLimitRegexp matches gh and API errors for requests made
+	// too fast.
+	secondaryRateLimitRegexp = regexp.MustCompile(`(?i)secondary rate limit|abuse detection|submitted too quickly`)
+	// serverErrorRegexp matches gh and API errors for transient server
+	// failures.
+	serverErrorRegexp = regexp.MustCompile(`HTTP 5\d\d|(?i)502 Bad Gateway|something went wrong while executing your query`)
+)
+
+// retryDelay decides whether a gh command or an API request that failed with
+// message is worth retrying, and how long to wait before attempt, which
+// counts from 0. Rate-limited requests were rejected and are always retried,
+// after as long as the headers of the failing response ask for, if there are
+// any, while server errors are only retried for idempotent requests, since
+// the request may have been carried out anyway.
+func retryDelay(ctx context.Context, message string, headers http.Header, idempotent bool, attempt int) (time.Duration, bool) {
+	if attempt >= maxRetries {
+		return 0, false
+	}
+
+	switch {
+	case primaryRateLimitRegexp.MatchString(message):
+		wait, ok := headerDelay(headers)
+		if !ok {
+			// gh does not show the headers of the response it failed on.
+			reset, err := rateLimitReset(ctx)
+			if err != nil {
+				return 0, false
+			}
+			wait = time.Until(reset) + time.Second
+		}
+		if wait > maxRateLimitWait {
+			return 0, false
+		}
+		return max(wait, time.Second), true
+	case secondaryRateLimitRegexp.MatchString(message):
+		if wait, ok := headerDelay(headers); ok {
+			if wait > maxRateLimitWait {
+				return 0, false
+			}
+			return max(wait, time.Second), true
+		}
+		// GitHub asks to wait at least a minute when it does not say how long.
+		return jitter(time.Minute << attempt), true
+	case serverErrorRegexp.MatchString(message) && idempotent:
+		return jitter(time.Second << attempt), true
+	default:
+		return 0, false
+	}
+}
+
+// headerDelay returns how long the headers of a rate-limited response ask to
+// wait: Retry-After, or else until X-RateLimit-Reset when
+// X-RateLimit-Remaining is 0. It reports false if they do not say.
+func headerDelay(headers http.Header) (time.Duration, bool) {
+	if seconds, err := strconv.Atoi(headers.Get("Retry-After")); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if headers.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(headers.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			return time.Until(time.Unix(reset, 0)) + time.Second, true
+		}
+	}
+	return 0, false
+}
+
+// jitter spreads d by up to a quarter either way, so that concurrent runs do
+// not retry in lockstep.
+func jitter(d time.Duration) time.Duration {
+	return d + time.Duration((rand.Float64()-0.5)*float64(d)/2)
+}
+
+// isIdempotent reports whether running gh with args twice has the same
+// effect as running it once.
+func isIdempotent(args []string) bool {
+	if len(args) < 2 {
+		return false
+	}
+
+	switch args[0] {
+	case "repo":
+		return args[1] == "view"
+	case "pr":
+		return args[1] == "list" || args[1] == "view"
+	case "api":
+		for i, arg := range args {
+			if arg == "--method" && i+1 < len(args) && strings.EqualFold(args[i+1], "POST") {
+				return false
+			}
+			if strings.HasPrefix(arg, "query=mutation") {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// RateLimit is the quota left of one of the GitHub API rate limits.
+type RateLimit struct {
+	Limit     int   `json:"limit"`
+	Remaining int   `json:"remaining"`
+	Reset     int64 `json:"reset"`
+}
+
+// GetRateLimits returns the quotas of the REST ("core") and GraphQL
+// ("graphql") APIs, among others. Querying them does not count against them.
+func GetRateLimits(ctx context.Context) (map[string]RateLimit, error) {
+	if f, ok := forge.(*APIForge); ok {
+		return f.rateLimits(ctx)
+	}
+
+	args := []string{"api", "rate_limit"}
+	if apiHost != "" {
+		args = []string{"api", "--hostname", apiHost, "rate_limit"}
+	}
+
+	// gh.ExecContext rather than ghExec, which would retry through here.
+	cmdCtx, cancel := commandContext(ctx)
+	defer cancel()
+	stdout, _, err := runRecorded("gh", args, func() (stdout, stderr bytes.Buffer, err error) {
+		return gh.ExecContext(cmdCtx, args...)
+	})
+	if err = timeoutError(cmdCtx, ctx, err); err != nil {
+		return nil, err
+	}
+
+	var limits struct {
+		Resources map[string]RateLimit `json:"resources"`
+	}
+	if err = json.Unmarshal(stdout.Bytes(), &limits); err != nil {
+		return nil, err
+	}
+
+	return limits.Resources, nil
+}
+
+// rateLimitReset returns when the exhausted quotas reset.
+func rateLimitReset(ctx context.Context) (time.Time, error) {
+	limits, err := GetRateLimits(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var reset time.Time
+	for _, limit := range limits {
+		if at := time.Unix(limit.Reset, 0); limit.Remaining == 0 && at.After(reset) {
+			reset = at
+		}
+	}
+	return reset, nil
+}
+
+// LogRateLimits logs the quota left of the REST and GraphQL APIs at info
+// level, if it is enabled.
+func LogRateLimits(ctx context.Context) {
+	if !slog.Default().Enabled(ctx, slog.LevelInfo) {
+		return
+	}
+
+	limits, err := GetRateLimits(ctx)
+	if err != nil {
+		slog.Info("rate limit", slog.String("error", err.Error()))
+		return
+	}
+	for _, resource := range []string{"core", "graphql"} {
+		if limit, ok := limits[resource]; ok {
+			slog.Info("rate limit",
+				slog.String("resource", resource),
+				slog.Int("remaining", limit.Remaining),
+				slog.Int("limit", limit.Limit),
+				slog.Time("reset", time.Unix(limit.Reset, 0)),
+			)
+		}
+	}
+}
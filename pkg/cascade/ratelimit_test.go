@@ -0,0 +1,108 @@
+package cascade
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	inMinutes := func(minutes int) string {
+		return strconv.FormatInt(time.Now().Add(time.Duration(minutes)*time.Minute).Unix(), 10)
+	}
+
+	tests := []struct {
+		name          string
+		message       string
+		headers       http.Header
+		idempotent    bool
+		wantRetry     bool
+		wantMin       time.Duration
+		wantMax       time.Duration
+		wantRateLimit bool
+	}{
+		{
+			name:      "primary rate limit with Retry-After",
+			message:   "API rate limit exceeded for user ID 1.",
+			headers:   http.Header{"Retry-After": {"30"}},
+			wantRetry: true,
+			wantMin:   30 * time.Second,
+			wantMax:   30 * time.Second,
+		},
+		{
+			name:      "primary rate limit with X-RateLimit-Reset",
+			message:   "API rate limit exceeded for user ID 1.",
+			headers:   http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {inMinutes(2)}},
+			wantRetry: true,
+			wantMin:   time.Minute,
+			wantMax:   2*time.Minute + time.Second,
+		},
+		{
+			name:          "primary rate limit without headers",
+			message:       "gh: API rate limit exceeded for user ID 1. (HTTP 403)",
+			wantRetry:     true,
+			wantMin:       4 * time.Minute,
+			wantMax:       5*time.Minute + time.Second,
+			wantRateLimit: true,
+		},
+		{
+			name:    "primary rate limit resetting too late",
+			message: "API rate limit exceeded for user ID 1.",
+			headers: http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {inMinutes(60)}},
+		},
+		{
+			name:      "secondary rate limit with Retry-After",
+			message:   "You have exceeded a secondary rate limit.",
+			headers:   http.Header{"Retry-After": {"5"}},
+			wantRetry: true,
+			wantMin:   5 * time.Second,
+			wantMax:   5 * time.Second,
+		},
+		{
+			name:      "secondary rate limit without headers",
+			message:   "You have exceeded a secondary rate limit.",
+			wantRetry: true,
+			wantMin:   45 * time.Second,
+			wantMax:   75 * time.Second,
+		},
+		{
+			name:       "server error",
+			message:    "HTTP 502: Bad Gateway",
+			idempotent: true,
+			wantRetry:  true,
+			wantMin:    750 * time.Millisecond,
+			wantMax:    1250 * time.Millisecond,
+		},
+		{
+			name:    "server error of a request that may have been carried out",
+			message: "HTTP 502: Bad Gateway",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rateLimits := 0
+			previous := forge
+			SetForge(newTestAPIForge(t, func(w http.ResponseWriter, r *http.Request) {
+				rateLimits++
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"resources": {"core": {"limit": 5000, "remaining": 0, "reset": %s}}}`, inMinutes(5))
+			}))
+			t.Cleanup(func() { SetForge(previous) })
+
+			wait, retry := retryDelay(context.Background(), tt.message, tt.headers, tt.idempotent, 0)
+			if retry != tt.wantRetry {
+				t.Fatalf("retry = %t, want %t", retry, tt.wantRetry)
+			}
+			if retry && (wait < tt.wantMin || wait > tt.wantMax) {
+				t.Errorf("wait = %s, want between %s and %s", wait, tt.wantMin, tt.wantMax)
+			}
+			if got := rateLimits > 0; got != tt.wantRateLimit {
+				t.Errorf("queried the rate limits: %t, want %t", got, tt.wantRateLimit)
+			}
+		})
+	}
+}
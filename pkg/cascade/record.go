@@ -0,0 +1,192 @@
+package cascade
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// recordingFile is the name of the file in a recording directory that holds
+// the commands of the run, one JSON object per line.
+const recordingFile = "commands.jsonl"
+
+// recordedCommand is a git, gh or shell command of a recording, along with
+// what it printed and how it exited.
+type recordedCommand struct {
+	// Tool is git, gh or sh.
+	Tool     string   `json:"tool"`
+	Args     []string `json:"args"`
+	Stdout   string   `json:"stdout,omitempty"`
+	Stderr   string   `json:"stderr,omitempty"`
+	Error    string   `json:"error,omitempty"`
+	ExitCode int      `json:"exit_code,omitempty"`
+	// NotFound is set when the tool is not installed.
+	NotFound bool `json:"not_found,omitempty"`
+}
+
+var (
+	recordMu sync.Mutex
+	// recording is the file commands are recorded to, see StartRecording.
+	recording *os.File
+	// replaying holds the commands of the recording being replayed that were
+	// not replayed yet, see StartReplay.
+	replaying []*recordedCommand
+	replay    bool
+)
+
+// StartRecording records every git, gh and shell command the package runs
+// from now on to dir, along with what it printed, so that the run can be
+// reproduced with StartReplay, e.g. from a bug report. Tokens and URL
+// credentials are redacted as they are in the logs. The returned function
+// stops recording.
+func StartRecording(dir string) (func() error, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(filepath.Join(dir, recordingFile))
+	if err != nil {
+		return nil, err
+	}
+
+	recordMu.Lock()
+	recording = f
+	recordMu.Unlock()
+
+	return func() error {
+		recordMu.Lock()
+		defer recordMu.Unlock()
+		recording = nil
+		return f.Close()
+	}, nil
+}
+
+// StartReplay answers every git, gh and shell command the package runs from
+// now on with the one recorded by StartRecording in dir that has the same
+// arguments, instead of running it, so that planning and rebasing take the
+// decisions they took in the recorded run without touching the repository
+// or GitHub. A command that was not recorded fails.
+func StartReplay(dir string) error {
+	f, err := os.Open(filepath.Join(dir, recordingFile))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var commands []*recordedCommand
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var command recordedCommand
+		if err := json.Unmarshal(scanner.Bytes(), &command); err != nil {
+			return fmt.Errorf("%s:%d: %w", f.Name(), line, err)
+		}
+		commands = append(commands, &command)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	recordMu.Lock()
+	replaying = commands
+	replay = true
+	recordMu.Unlock()
+	return nil
+}
+
+// isReplaying reports whether commands are answered by StartReplay.
+func isReplaying() bool {
+	recordMu.Lock()
+	defer recordMu.Unlock()
+	return replay
+}
+
+// runRecorded runs a command of tool with args through run, unless it is
+// replayed, and records it if recording. Commands run concurrently are told
+// apart by their arguments, so identical ones are replayed in the order they
+// were recorded in.
+func runRecorded(tool string, args []string, run func() (stdout, stderr bytes.Buffer, err error)) (stdout, stderr bytes.Buffer, err error) {
+	// Commands are recorded and looked up redacted, as are their outputs.
+	args = redactArgs(args)
+	if isReplaying() {
+		return replayCommand(tool, args)
+	}
+
+	stdout, stderr, err = run()
+
+	recordMu.Lock()
+	defer recordMu.Unlock()
+	if recording == nil {
+		return stdout, stderr, err
+	}
+	command := recordedCommand{
+		Tool:   tool,
+		Args:   args,
+		Stdout: Redact(stdout.String()),
+		Stderr: Redact(stderr.String()),
+	}
+	if err != nil {
+		command.Error = Redact(err.Error())
+		command.ExitCode = exitCode(err)
+		command.NotFound = errors.Is(err, exec.ErrNotFound)
+	}
+	if data, marshalErr := json.Marshal(command); marshalErr == nil {
+		_, _ = recording.Write(append(data, '\n'))
+	}
+
+	return stdout, stderr, err
+}
+
+func replayCommand(tool string, args []string) (stdout, stderr bytes.Buffer, err error) {
+	recordMu.Lock()
+	defer recordMu.Unlock()
+
+	i := slices.IndexFunc(replaying, func(command *recordedCommand) bool {
+		return command.Tool == tool && slices.Equal(command.Args, args)
+	})
+	if i < 0 {
+		return stdout, stderr, fmt.Errorf("%s %s: not in the recording", tool, strings.Join(args, " "))
+	}
+	command := replaying[i]
+	replaying = slices.Delete(replaying, i, i+1)
+
+	stdout.WriteString(command.Stdout)
+	stderr.WriteString(command.Stderr)
+	switch {
+	case command.NotFound:
+		err = fmt.Errorf("%s: %w", command.Error, exec.ErrNotFound)
+	case command.Error != "":
+		err = &replayedError{msg: command.Error, code: command.ExitCode}
+	}
+	return stdout, stderr, err
+}
+
+// replayedError is the error of a replayed command that failed, which exits
+// with the code the recorded command exited with.
+type replayedError struct {
+	msg  string
+	code int
+}
+
+func (e *replayedError) Error() string {
+	return e.msg
+}
+
+func (e *replayedError) ExitCode() int {
+	return e.code
+}
+
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		redacted[i] = Redact(arg)
+	}
+	return redacted
+}
@@ -0,0 +1,41 @@
+package cascade
+
+import (
+	"os"
+	"regexp"
+	"strings"
+)
+
+// redacted replaces what Redact masks.
+const redacted = "[REDACTED]"
+
+// tokenEnv are the environment variables gh reads tokens from.
+var tokenEnv = []string{"GH_TOKEN", "GITHUB_TOKEN", "GH_ENTERPRISE_TOKEN", "GITHUB_ENTERPRISE_TOKEN"}
+
+var (
+	tokenRegexp    = regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{20,}|github_pat_[A-Za-z0-9_]{20,})\b`)
+	userinfoRegexp = regexp.MustCompile(`(https?://)[^/\s@]+@`)
+	// authorizationRegexp matches the credentials of an Authorization header,
+	// e.g. as set by actions/checkout with http.extraheader.
+	authorizationRegexp = regexp.MustCompile(`(?i)(\bauthorization:\s*(?:(?:basic|bearer|token)\s+)?)[^\s"',]+`)
+	// tokenAssignmentRegexp matches tokens assigned to the variables of
+	// tokenEnv, e.g. in a command line.
+	tokenAssignmentRegexp = regexp.MustCompile(`\b((?:GH|GITHUB)_(?:ENTERPRISE_)?TOKEN=)[^\s"']+`)
+)
+
+// Redact masks GitHub tokens, the tokens gh is given in the environment, the
+// credentials of URLs and Authorization headers in s. Everything gh cascade
+// prints, logs or writes to a file goes through it.
+func Redact(s string) string {
+	for _, key := range tokenEnv {
+		// Too short a value would mask every word it is part of, and is no
+		// real token anyway.
+		if token := os.Getenv(key); len(token) >= 8 {
+			s = strings.ReplaceAll(s, token, redacted)
+		}
+	}
+	s = tokenRegexp.ReplaceAllString(s, redacted)
+	s = userinfoRegexp.ReplaceAllString(s, "${1}"+redacted+"@")
+	s = authorizationRegexp.ReplaceAllString(s, "${1}"+redacted)
+	return tokenAssignmentRegexp.ReplaceAllString(s, "${1}"+redacted)
+}
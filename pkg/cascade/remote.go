@@ -0,0 +1,160 @@
+package cascade
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cli/go-gh/v2/pkg/repository"
+)
+
+type Remote struct {
+	Name       string
+	URL        string
+	Repository repository.Repository
+}
+
+// ListRemotes returns the git remotes that point at a GitHub repository.
+func ListRemotes(ctx context.Context) ([]Remote, error) {
+	stdout, _, err := runGit(ctx, "remote", "-v")
+	if err != nil {
+		return nil, err
+	}
+
+	var remotes []Remote
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		// <name>\t<url> (fetch)
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[2] != "(fetch)" {
+			continue
+		}
+		repo, err := repository.Parse(fields[1])
+		if err != nil {
+			continue
+		}
+		remotes = append(remotes, Remote{Name: fields[0], URL: fields[1], Repository: repo})
+	}
+
+	return remotes, nil
+}
+
+// SetupRepository resolves the repository to operate on and the remotes to
+// use for it. API calls and dependency references are bound to the host of
+// that repository from then on.
+func SetupRepository(ctx context.Context, fetchRemote, pushRemote *string) (repository.Repository, error) {
+	base, err := SetupBaseRepository(ctx)
+	if err != nil {
+		return repository.Repository{}, err
+	}
+
+	if *fetchRemote, *pushRemote, err = ResolveRemotes(ctx, base, *fetchRemote, *pushRemote); err != nil {
+		return repository.Repository{}, err
+	}
+
+	return base, nil
+}
+
+// SetupBaseRepository is SetupRepository for commands that only talk to the
+// Forge, and so need no remotes.
+func SetupBaseRepository(ctx context.Context) (repository.Repository, error) {
+	base, err := GetBaseRepository(ctx)
+	if err != nil {
+		return repository.Repository{}, &CheckError{
+			Err: fmt.Errorf("resolve base repository: %w", err),
+			Fix: "check that the repository exists and that gh is logged in to an account that can see it, or pick another with gh repo set-default",
+		}
+	}
+	apiHost = base.Host
+	dependOnRepository = base
+
+	return base, nil
+}
+
+// ResolveRemotes fills in the remotes that were not given explicitly. Base
+// branches are fetched from the remote of the base repository, and branches
+// are pushed to the remote of the viewer's fork of it, if there is one, so
+// contributing from a fork works out of the box.
+// When GH_REPO names the base repository, as in scripts, and no remote points
+// at it, a *CheckError is returned rather than falling back on another
+// remote, whose branches would belong to another repository than the pull
+// requests.
+func ResolveRemotes(ctx context.Context, base repository.Repository, fetchRemote, pushRemote string) (string, string, error) {
+	if fetchRemote != "" && pushRemote != "" {
+		return fetchRemote, pushRemote, nil
+	}
+
+	remotes, err := ListRemotes(ctx)
+	if err != nil {
+		return "", "", fmt.Errorf("list remotes: %w", err)
+	}
+
+	if fetchRemote == "" {
+		fetchRemote = preferredRemote(remotes)
+		found := false
+		for _, remote := range remotes {
+			if sameRepository(remote.Repository, base) {
+				fetchRemote, found = remote.Name, true
+				break
+			}
+		}
+		if !found && os.Getenv("GH_REPO") != "" {
+			return "", "", &CheckError{
+				Err: fmt.Errorf("GH_REPO is %s, but no git remote of this clone points at it", RepositoryName(base)),
+				Fix: fmt.Sprintf("run gh cascade in a clone of it, add it with git remote add upstream https://%s/%s/%s.git, or give --fetch-remote", base.Host, base.Owner, base.Name),
+			}
+		}
+	}
+
+	if pushRemote == "" {
+		pushRemote = fetchRemote
+		if login, err := GetViewerLogin(ctx); err == nil {
+			for _, remote := range remotes {
+				if strings.EqualFold(remote.Repository.Owner, login) {
+					pushRemote = remote.Name
+					break
+				}
+			}
+		}
+	}
+
+	return fetchRemote, pushRemote, nil
+}
+
+// preferredRemote returns the remote to fall back on when none points at the
+// base repository, in the order gh prefers them: upstream, github, origin,
+// then the first one. It is origin if there are none, for git to report.
+func preferredRemote(remotes []Remote) string {
+	for _, name := range []string{"upstream", "github", "origin"} {
+		for _, remote := range remotes {
+			if remote.Name == name {
+				return name
+			}
+		}
+	}
+	if len(remotes) > 0 {
+		return remotes[0].Name
+	}
+	return "origin"
+}
+
+// GetBaseRepository returns the repository the Forge operates on, which for
+// GitHubForge honors GH_REPO, `gh repo set-default` and the hosts gh is
+// authenticated with.
+func GetBaseRepository(ctx context.Context) (repository.Repository, error) {
+	return forge.GetBaseRepository(ctx)
+}
+
+// RepositoryName returns OWNER/REPO, prefixed with the host unless it is
+// github.com, as GH_REPO takes it.
+func RepositoryName(repo repository.Repository) string {
+	name := repo.Owner + "/" + repo.Name
+	if !strings.EqualFold(repo.Host, "github.com") {
+		name = repo.Host + "/" + name
+	}
+	return name
+}
+
+func sameRepository(a, b repository.Repository) bool {
+	return strings.EqualFold(a.Host, b.Host) && strings.EqualFold(a.Owner, b.Owner) && strings.EqualFold(a.Name, b.Name)
+}
@@ -0,0 +1,96 @@
+package cascade
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/cli/go-gh/v2/pkg/repository"
+)
+
+// maxOwnerRepositories is how many repositories ListOwnerRepositories looks
+// at, as gh repo list needs a limit.
+const maxOwnerRepositories = 10000
+
+// ListOwnerRepositories returns the repositories of an organization or user
+// on the host gh defaults to, GH_HOST if set, that are not archived and whose
+// name matches the glob filter, or all of them if it is empty, in the order
+// gh repo list returns them.
+func ListOwnerRepositories(ctx context.Context, owner, filter string) ([]repository.Repository, error) {
+	if filter != "" {
+		if _, err := path.Match(filter, ""); err != nil {
+			return nil, fmt.Errorf("invalid filter %q: %w", filter, err)
+		}
+	}
+
+	stdout, stderr, err := ghExec(ctx, "repo", "list", owner, "--no-archived", "--limit", fmt.Sprint(maxOwnerRepositories), "--json", "name,url")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	var listed []struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	}
+	if err = json.Unmarshal(stdout.Bytes(), &listed); err != nil {
+		return nil, err
+	}
+
+	var repos []repository.Repository
+	for _, r := range listed {
+		if matched, _ := path.Match(filter, r.Name); filter != "" && !matched {
+			continue
+		}
+		repo, err := repository.Parse(r.URL)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", r.URL, err)
+		}
+		repos = append(repos, repo)
+	}
+
+	return repos, nil
+}
+
+// CloneDir returns where CloneRepository clones repo to under dir.
+func CloneDir(dir string, repo repository.Repository) string {
+	return filepath.Join(dir, strings.ToLower(repo.Host), strings.ToLower(repo.Owner), strings.ToLower(repo.Name))
+}
+
+// CloneRepository clones repo into CloneDir(dir, repo) with gh repo clone,
+// which adds the upstream remote of a fork, unless it was cloned before, and
+// returns the clone. Blobs are left out and fetched as they are needed, see
+// PartialCloneFilter, since only the pull requests rebased need them. A clone
+// is reused as it is, whatever is checked out in it, since gh cascade fetches
+// what it rebases.
+func CloneRepository(ctx context.Context, dir string, repo repository.Repository) (string, error) {
+	clone := CloneDir(dir, repo)
+	if _, err := os.Stat(filepath.Join(clone, ".git")); err == nil {
+		return clone, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	// A clone that was interrupted is not mistaken for one to reuse.
+	partial := clone + ".partial"
+	if err := os.RemoveAll(partial); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(clone), 0o755); err != nil {
+		return "", err
+	}
+	_, stderr, err := ghExec(ctx, "repo", "clone", RepositoryName(repo), partial, "--", "--filter=blob:none", "--quiet")
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	if err = os.Rename(partial, clone); err != nil {
+		return "", err
+	}
+
+	return clone, nil
+}
@@ -0,0 +1,90 @@
+package cascade
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrNoDependOn error = &SkipError{Reason: "no dependencies found"}
+
+var ErrUpToDate error = &SkipError{Reason: "already up to date"}
+
+// ErrInvalidDependOn is the error of pull requests whose dependency
+// declaration cannot be followed, such as one on the pull request itself or on
+// a number that is not a pull request. Unlike a skip, it needs fixing.
+var ErrInvalidDependOn = errors.New("invalid dependency")
+
+// SkipError explains why a pull request was not eligible for a rebase. Unlike
+// other errors, it does not mean that anything went wrong.
+type SkipError struct {
+	Reason string
+}
+
+func (e *SkipError) Error() string {
+	return e.Reason
+}
+
+// Skipf returns a SkipError with a formatted reason.
+func Skipf(format string, a ...any) error {
+	return &SkipError{Reason: fmt.Sprintf(format, a...)}
+}
+
+type Result string
+
+const (
+	ResultRebased Result = "rebased"
+	ResultSkipped Result = "skipped"
+	ResultFailed  Result = "failed"
+)
+
+type ProcessedPullRequest struct {
+	PullRequest
+	DependOns           []int
+	DependedPullRequest *PullRequest
+	// DependencyMergeQueue is where DependedPullRequest stands in the merge
+	// queue while it is open, with Options.CheckMergeQueue.
+	DependencyMergeQueue MergeQueueStatus
+	// Base is the branch the pull request is rebased onto: its base branch,
+	// or that of its dependency if it is based on the dependency's branch,
+	// unless another is given with Options.Onto, Options.OntoPullRequests or
+	// its Metadata.
+	Base string
+	// Onto is the commit the pull request is rebased onto: the merge commit of
+	// its dependency, or the tip of Base if the dependency was closed without
+	// merging or merged into another branch. It is set once the pull request
+	// is planned.
+	Onto string
+	// RangeDiff compares the commits before and after the rebase.
+	RangeDiff *RangeDiff
+	// Depth is how many hops the pull request is below the merged, or
+	// dropped, dependency its chain is rebased after: 1 if it depends on it
+	// directly. It is 0 if no such dependency was found among those planned.
+	Depth  int
+	Pushed bool
+	Error  error
+	// Conflicts are the files rebasing is predicted to conflict in. They are
+	// only predicted with Options.PredictConflicts or an Options.OnConflict
+	// other than OnConflictRebase.
+	Conflicts []string
+	// Warnings are non-fatal problems, such as a follow-up action that failed
+	// after the rebase succeeded.
+	Warnings []error
+}
+
+// Chained reports whether the pull request depends on an open pull request,
+// which it is rebased after, onto its new head, if both are in the same plan.
+func (p ProcessedPullRequest) Chained() bool {
+	return p.DependedPullRequest != nil && p.DependedPullRequest.State == "OPEN"
+}
+
+func (p ProcessedPullRequest) Result() Result {
+	var skipErr *SkipError
+	switch {
+	case p.Error == nil:
+		return ResultRebased
+	case errors.As(p.Error, &skipErr):
+		return ResultSkipped
+	default:
+		return ResultFailed
+	}
+}
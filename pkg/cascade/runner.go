@@ -0,0 +1,117 @@
+package cascade
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"github.com/cli/safeexec"
+)
+
+// GitRunner runs git commands in the repository being cascaded. Every git
+// command the package runs goes through the GitRunner set with SetGitRunner,
+// which defaults to ExecGitRunner, so it can be replaced with a fake in tests
+// or with another implementation of git.
+type GitRunner interface {
+	// Run runs git with args and returns what it printed. An error for a
+	// command that ran but failed should implement ExitCode() int, as
+	// *exec.ExitError does, since some commands report answers through their
+	// exit code.
+	Run(ctx context.Context, args ...string) (stdout, stderr bytes.Buffer, err error)
+}
+
+// ExecGitRunner is the default GitRunner. It runs the git binary found on the
+// PATH in the working directory. On Windows, it enables core.longpaths, as
+// branches checked out of deep trees quickly exceed the 260 characters paths
+// are otherwise limited to.
+type ExecGitRunner struct{}
+
+var _ GitRunner = ExecGitRunner{}
+
+func (ExecGitRunner) Run(ctx context.Context, args ...string) (stdout, stderr bytes.Buffer, err error) {
+	gitPath, err := safeexec.LookPath("git")
+	if err != nil {
+		return stdout, stderr, err
+	}
+
+	cmd := exec.CommandContext(ctx, gitPath, gitArgs(runtime.GOOS, args)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Give git a chance to clean up, e.g. to remove its index.lock, before
+	// it is killed.
+	if runtime.GOOS != "windows" {
+		cmd.Cancel = func() error {
+			return cmd.Process.Signal(os.Interrupt)
+		}
+		cmd.WaitDelay = 10 * time.Second
+	}
+	err = runCommand(cmd)
+
+	return stdout, stderr, err
+}
+
+// gitArgs returns the arguments ExecGitRunner runs git with on goos.
+func gitArgs(goos string, args []string) []string {
+	if goos != "windows" {
+		return args
+	}
+	return append([]string{"-c", "core.longpaths=true"}, args...)
+}
+
+var gitRunner GitRunner = ExecGitRunner{}
+
+// SetGitRunner replaces the GitRunner the package runs git commands with.
+func SetGitRunner(r GitRunner) {
+	gitRunner = r
+}
+
+func runGit(ctx context.Context, args ...string) (stdout, stderr bytes.Buffer, err error) {
+	cmdCtx, cancel := commandContext(ctx)
+	defer cancel()
+
+	stdout, stderr, err = runRecorded("git", args, func() (stdout, stderr bytes.Buffer, err error) {
+		return gitRunner.Run(cmdCtx, args...)
+	})
+	return stdout, stderr, timeoutError(cmdCtx, ctx, err)
+}
+
+// commandTimeout bounds each git and gh command.
+var commandTimeout = 10 * time.Minute
+
+// SetCommandTimeout bounds how long each git and gh command may run, so that
+// a hung fetch or API call fails instead of blocking forever. It defaults to
+// ten minutes; 0 means no bound.
+func SetCommandTimeout(d time.Duration) {
+	commandTimeout = d
+}
+
+// commandContext returns the context to run a single command with.
+func commandContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if commandTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, commandTimeout)
+}
+
+// timeoutError tells apart a command that was killed because it ran into the
+// command timeout, when cmdCtx expired but the parent ctx did not.
+func timeoutError(cmdCtx, ctx context.Context, err error) error {
+	if err != nil && errors.Is(cmdCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		return fmt.Errorf("timed out after %s: %w", commandTimeout, err)
+	}
+	return err
+}
+
+// exitCode returns the exit code err reports, or -1 if it reports none.
+func exitCode(err error) int {
+	var exitErr interface{ ExitCode() int }
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
@@ -0,0 +1,149 @@
+package cascade
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// How DeepenHistory deepens a shallow repository: by deepenStep commits at
+// first, doubling each time, at most maxDeepens times.
+const (
+	deepenStep = 64
+	maxDeepens = 8
+)
+
+// IsShallowRepository reports whether the history of the repository was
+// fetched with a limited depth, e.g. by git clone --depth.
+func IsShallowRepository(ctx context.Context) (bool, error) {
+	stdout, stderr, err := runGit(ctx, "rev-parse", "--is-shallow-repository")
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return strings.TrimSpace(stdout.String()) == "true", nil
+}
+
+// PartialCloneFilter returns the filter objects are fetched from remote
+// with, e.g. blob:none for a blobless clone, or "" if remote is not the
+// remote of a partial clone. Objects left out are fetched by git as they
+// are needed.
+func PartialCloneFilter(ctx context.Context, remote string) (string, error) {
+	return getConfig(ctx, "remote."+remote+".partialCloneFilter")
+}
+
+// DeepenHistory fetches refspecs from remote again with more history, if the
+// repository is shallow, until each pair of revisions has a merge base, as
+// rebasing a pull request needs for its head and both its dependency and the
+// branch it is rebased onto. Only as many commits as that takes are fetched,
+// deepening by 64 commits at first and doubling each time. A *CheckError is
+// returned if 8 times were not enough, e.g. for a branch to rebase onto that
+// forked long ago.
+func DeepenHistory(ctx context.Context, remote string, refspecs []string, pairs [][2]string) error {
+	depth := deepenStep
+	for deepens := 0; ; deepens++ {
+		shallow, err := IsShallowRepository(ctx)
+		if err != nil || !shallow {
+			return err
+		}
+
+		pending, err := pendingPairs(ctx, pairs)
+		if err != nil {
+			return err
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		if deepens == maxDeepens {
+			return &CheckError{
+				Err: fmt.Errorf("the history fetched from %s is too shallow to tell where %s and %s forked", remote, pending[0][0], pending[0][1]),
+				Fix: "git fetch --unshallow " + remote,
+			}
+		}
+		pairs = pending
+
+		slog.Info("deepening", slog.String("remote", remote), slog.Int("depth", depth))
+		args := append([]string{"fetch", "--no-tags", "--deepen=" + strconv.Itoa(depth), remote}, refspecs...)
+		if _, stderr, err := runGit(ctx, args...); err != nil {
+			return fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+		}
+		depth *= 2
+	}
+}
+
+// fetchHistory fetches refspecs from remote, and then as much history as
+// DeepenHistory needs for pairs. In a shallow repository where a pair has no
+// merge base yet, e.g. because its commits were never fetched, the history
+// is deepened along with the fetch, so that the new commits join it within a
+// few commits rather than being fetched all the way down to the root commit of
+// a monorepo. git fetch --depth would instead cut back the history that was
+// fetched deeper before.
+func fetchHistory(ctx context.Context, remote string, refspecs []string, pairs [][2]string) error {
+	shallow, err := IsShallowRepository(ctx)
+	if err != nil {
+		return err
+	}
+	if !shallow {
+		return FetchRefs(ctx, remote, refspecs...)
+	}
+
+	ok, err := hasMergeBases(ctx, pairs)
+	if err != nil {
+		return err
+	}
+	args := []string{"fetch", "--no-tags"}
+	if !ok {
+		slog.Info("deepening", slog.String("remote", remote), slog.Int("depth", deepenStep))
+		args = append(args, "--deepen="+strconv.Itoa(deepenStep))
+	}
+	args = append(append(args, remote), refspecs...)
+	if _, stderr, err := runGit(ctx, args...); err != nil {
+		return fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+	return DeepenHistory(ctx, remote, refspecs, pairs)
+}
+
+// pendingPairs returns the pairs of revisions that have no merge base in the
+// history fetched so far.
+func pendingPairs(ctx context.Context, pairs [][2]string) ([][2]string, error) {
+	var pending [][2]string
+	for _, pair := range pairs {
+		ok, err := hasMergeBase(ctx, pair[0], pair[1])
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			pending = append(pending, pair)
+		}
+	}
+	return pending, nil
+}
+
+// hasMergeBases reports whether each pair of revisions was fetched and has a
+// merge base.
+func hasMergeBases(ctx context.Context, pairs [][2]string) (bool, error) {
+	for _, pair := range pairs {
+		for _, rev := range pair {
+			if _, _, err := runGit(ctx, "rev-parse", "--verify", "--quiet", rev+"^{commit}"); err != nil {
+				return false, nil
+			}
+		}
+	}
+	pending, err := pendingPairs(ctx, pairs)
+	return len(pending) == 0, err
+}
+
+// hasMergeBase reports whether a and b have a common ancestor in the history
+// fetched so far.
+func hasMergeBase(ctx context.Context, a, b string) (bool, error) {
+	_, stderr, err := runGit(ctx, "merge-base", a, b)
+	if exitCode(err) == 1 {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,75 @@
+package cascade
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFetchHistory(t *testing.T) {
+	tests := []struct {
+		name string
+		// allBranches clones topic along with main.
+		allBranches  bool
+		wantDeepened bool
+	}{
+		{
+			name:        "merge base fetched",
+			allBranches: true,
+		},
+		{
+			name:         "merge base missing",
+			wantDeepened: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newTestRepository(t)
+			for i := 0; i < 150; i++ {
+				upstream("commit", "--quiet", "--allow-empty", "--message=main "+strconv.Itoa(i))
+			}
+			upstream("branch", "topic", "main~10")
+			upstream("checkout", "--quiet", "topic")
+			topic := commitFile(t, upstream, "topic", "topic\n", "topic")
+
+			dir := filepath.Join(t.TempDir(), "clone")
+			args := []string{"clone", "--quiet", "--depth=20", "--branch=main"}
+			if tt.allBranches {
+				args = append(args, "--no-single-branch")
+			}
+			args = append(args, "file://"+upstream("rev-parse", "--show-toplevel"), dir)
+			if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+				t.Fatalf("git clone: %s: %v", output, err)
+			}
+			SetGitRunner(dirGitRunner{dir: dir})
+			// Fetching must not cut back the history already fetched.
+			depth := func() int {
+				t.Helper()
+				stdout, _, err := runGit(context.Background(), "rev-list", "--count", "refs/remotes/origin/main")
+				if err != nil {
+					t.Fatal(err)
+				}
+				n, _ := strconv.Atoi(strings.TrimSpace(stdout.String()))
+				return n
+			}
+			before := depth()
+
+			refspecs := []string{"+refs/heads/main:refs/remotes/origin/main", "+refs/heads/topic:refs/remotes/origin/topic"}
+			pairs := [][2]string{{"refs/remotes/origin/main", topic}}
+			if err := fetchHistory(context.Background(), "origin", refspecs, pairs); err != nil {
+				t.Fatal(err)
+			}
+
+			if ok, err := hasMergeBase(context.Background(), "refs/remotes/origin/main", topic); err != nil || !ok {
+				t.Errorf("hasMergeBase = %t, %v, want true", ok, err)
+			}
+			if after := depth(); after < before || (after > before) != tt.wantDeepened {
+				t.Errorf("%d commits of main fetched, %d before, want deepened %t", after, before, tt.wantDeepened)
+			}
+		})
+	}
+}
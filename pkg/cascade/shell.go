@@ -0,0 +1,39 @@
+package cascade
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// runShell runs command with the shell of the platform in the working
+// directory, with env added to the environment, and returns its combined
+// output.
+func runShell(ctx context.Context, command string, env []string) ([]byte, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+
+	// The combined output is recorded as the standard output.
+	output, _, err := runRecorded("sh", []string{command}, func() (output, _ bytes.Buffer, err error) {
+		cmd.Stdout = &output
+		cmd.Stderr = &output
+		cmd.Env = append(os.Environ(), env...)
+		err = runCommand(cmd)
+		return output, bytes.Buffer{}, err
+	})
+
+	return output.Bytes(), err
+}
+
+// lastLine returns the last non-empty line of output.
+func lastLine(output []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
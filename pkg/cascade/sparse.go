@@ -0,0 +1,30 @@
+package cascade
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// IsSparseCheckout reports whether only part of the tree is checked out, as
+// set up by git sparse-checkout.
+func IsSparseCheckout(ctx context.Context) (bool, error) {
+	enabled, err := getConfig(ctx, "--bool", "core.sparseCheckout")
+	return enabled == "true", err
+}
+
+// ReapplySparseCheckout removes the files outside the sparse-checkout
+// patterns from the working tree again, in a sparse checkout. A rebase or
+// cherry-pick writes the files it conflicts in even outside of them, and
+// leaves them behind once aborted.
+func ReapplySparseCheckout(ctx context.Context) error {
+	sparse, err := IsSparseCheckout(ctx)
+	if err != nil || !sparse {
+		return err
+	}
+
+	if _, stderr, err := runGit(ctx, "sparse-checkout", "reapply"); err != nil {
+		return fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package cascade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrAutostashConflict is returned by the function Autostash returns when
+// applying the stashed changes back conflicted. The changes are kept in the
+// stash.
+var ErrAutostashConflict = errors.New("applying the autostash conflicted")
+
+// autostashMessage is the message of the stash entries Autostash creates.
+const autostashMessage = "gh cascade autostash"
+
+// Autostash stashes the uncommitted changes of the working tree, untracked
+// files included, so that PrepareWorkspace finds it clean, and returns a
+// function that applies them back and drops the stash entry once the original
+// branch is checked out again, as git rebase --autostash does. If applying
+// them conflicts, the entry is kept and the error wraps ErrAutostashConflict.
+// With nothing to stash, the returned function does nothing.
+func Autostash(ctx context.Context) (func() error, error) {
+	dirty, err := IsCurrentBranchDirty(ctx)
+	if err != nil || !dirty {
+		return func() error { return nil }, err
+	}
+
+	if _, stderr, err := runGit(ctx, "stash", "push", "--include-untracked", "--message", autostashMessage); err != nil {
+		return nil, fmt.Errorf("stash: %s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+	oid, err := RevParse(ctx, "refs/stash")
+	if err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		// ctx may already be cancelled by Ctrl-C, and the changes must come
+		// back anyway.
+		ctx := context.WithoutCancel(ctx)
+
+		// Something else may have stashed since.
+		stdout, stderr, err := runGit(ctx, "stash", "list", "--format=%H")
+		if err != nil {
+			return fmt.Errorf("list stash: %s: %w", strings.TrimSpace(stderr.String()), err)
+		}
+		i := slices.Index(strings.Fields(stdout.String()), oid)
+		if i < 0 {
+			return fmt.Errorf("autostash %s is no longer in the stash", oid[:7])
+		}
+		entry := "stash@{" + strconv.Itoa(i) + "}"
+
+		if _, stderr, err := runGit(ctx, "stash", "apply", entry); err != nil {
+			if unmerged, _ := ListUnmergedPaths(ctx); len(unmerged) > 0 {
+				return fmt.Errorf("%w in %s, your changes are safe in %s", ErrAutostashConflict, strings.Join(unmerged, ", "), entry)
+			}
+			return fmt.Errorf("%w: %s, your changes are safe in %s", ErrAutostashConflict, lastLine(stderr.Bytes()), entry)
+		}
+		if _, stderr, err := runGit(ctx, "stash", "drop", "--quiet", entry); err != nil {
+			return fmt.Errorf("drop %s: %s: %w", entry, strings.TrimSpace(stderr.String()), err)
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,120 @@
+package cascade
+
+import (
+	"context"
+	"fmt"
+)
+
+// Health is where a pull request stands in its chain.
+type Health string
+
+const (
+	// HealthIndependent pull requests declare no dependency.
+	HealthIndependent Health = "independent"
+	// HealthBlocked pull requests wait for their dependency to merge.
+	HealthBlocked Health = "blocked"
+	// HealthAbandoned pull requests depend on a pull request closed without
+	// merging.
+	HealthAbandoned Health = "abandoned"
+	// HealthNeedsRebase pull requests do not contain the merge commit of their
+	// dependency yet.
+	HealthNeedsRebase Health = "needs rebase"
+	// HealthBehind pull requests contain the merge commit of their dependency,
+	// but not the tip of the default branch.
+	HealthBehind Health = "behind"
+	// HealthUpToDate pull requests contain the tip of the default branch.
+	HealthUpToDate Health = "up to date"
+)
+
+// Comparison is how a head compares to a base, as reported by the Forge.
+type Comparison struct {
+	// Status is "identical", "ahead", "behind" or "diverged", from the
+	// point of view of the head.
+	Status   string
+	AheadBy  int
+	BehindBy int
+}
+
+// Contains reports whether the head contains the base.
+func (c Comparison) Contains() bool {
+	return c.Status == "identical" || c.Status == "ahead"
+}
+
+func CompareCommits(ctx context.Context, base, head string) (Comparison, error) {
+	return forge.CompareCommits(ctx, base, head)
+}
+
+// PullRequestStatus is the health of a pull request in its chain.
+type PullRequestStatus struct {
+	ProcessedPullRequest
+	// Health is empty when Error is set and the dependency could not be
+	// resolved.
+	Health Health
+	// BehindBy is how many commits of the default branch a pull request that
+	// is HealthBehind is missing.
+	BehindBy int
+}
+
+// CheckStatus reports the health of every pull request without running git:
+// dependencies are resolved with ResolveDependencies, and heads are compared
+// with the Forge only.
+func CheckStatus(ctx context.Context, opts *Options, defaultBranch string, pullRequests []PullRequest) []PullRequestStatus {
+	statuses := make([]PullRequestStatus, 0, len(pullRequests))
+	for _, processed := range ResolveDependencies(ctx, opts, pullRequests) {
+		statuses = append(statuses, checkStatus(ctx, opts, defaultBranch, processed))
+	}
+	return statuses
+}
+
+func checkStatus(ctx context.Context, opts *Options, defaultBranch string, processed ProcessedPullRequest) PullRequestStatus {
+	status := PullRequestStatus{ProcessedPullRequest: processed}
+	dependency := processed.DependedPullRequest
+
+	switch {
+	case processed.Error == ErrNoDependOn:
+		status.Health = HealthIndependent
+		return status
+	case dependency == nil:
+		return status
+	case dependency.State == "CLOSED":
+		// With RetargetClosed, the commits of the dependency are still to be
+		// dropped, which no comparison tells about.
+		if opts.RetargetClosed {
+			status.Health = HealthNeedsRebase
+		} else {
+			status.Health = HealthAbandoned
+		}
+		return status
+	case dependency.State != "MERGED":
+		status.Health = HealthBlocked
+		return status
+	}
+
+	// The result of ResolveDependency may still be a skip, e.g. because of
+	// failed checks, which does not change where the pull request stands.
+	status.Error = nil
+
+	comparison, err := CompareCommits(ctx, dependency.MergeCommit.Oid, processed.HeadRefOid)
+	if err != nil {
+		status.Error = fmt.Errorf("compare with the merge commit of #%d: %w", dependency.Number, err)
+		return status
+	}
+	if !comparison.Contains() {
+		status.Health = HealthNeedsRebase
+		return status
+	}
+
+	comparison, err = CompareCommits(ctx, defaultBranch, processed.HeadRefOid)
+	if err != nil {
+		status.Error = fmt.Errorf("compare with %s: %w", defaultBranch, err)
+		return status
+	}
+	if comparison.Contains() {
+		status.Health = HealthUpToDate
+	} else {
+		status.Health = HealthBehind
+		status.BehindBy = comparison.BehindBy
+	}
+
+	return status
+}
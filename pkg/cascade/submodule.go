@@ -0,0 +1,36 @@
+package cascade
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// submodulesUpdated is set once UpdateSubmodules ran, so that the restore of
+// PrepareWorkspace updates the submodules of the original branch back.
+var submodulesUpdated atomic.Bool
+
+// UpdateSubmodules checks out the submodules of the checked out commit at the
+// commits it records, recursively, initializing those that are not yet.
+func UpdateSubmodules(ctx context.Context) error {
+	submodulesUpdated.Store(true)
+	return updateSubmodules(ctx)
+}
+
+func updateSubmodules(ctx context.Context) error {
+	_, stderr, err := runGit(ctx, "submodule", "update", "--init", "--recursive")
+	if err != nil {
+		return fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return nil
+}
+
+// isMovedSubmodule reports whether a line of git status --porcelain=v2 is a
+// submodule that is checked out at another commit than the one recorded, with
+// no other change, as checking out another branch leaves submodules.
+func isMovedSubmodule(line string) bool {
+	fields := strings.Fields(line)
+	return len(fields) > 2 && fields[0] == "1" && fields[1] == ".M" && fields[2] == "SC.."
+}
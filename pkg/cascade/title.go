@@ -0,0 +1,86 @@
+package cascade
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// chainPositionRegexp matches the "[2/4] " prefix NumberedTitles maintains.
+var chainPositionRegexp = regexp.MustCompile(`^\[\d+/\d+\]\s*`)
+
+func UpdatePullRequestTitle(ctx context.Context, number int, title string) error {
+	return forge.UpdatePullRequestTitle(ctx, number, title)
+}
+
+// NumberedTitles prefixes the title of every pull request that is part of a
+// chain of pullRequests with its position in the chain, e.g. "[2/4] ", and
+// strips the prefix from pull requests that are no longer part of one. A pull
+// request followed by more than one dependent counts the longest chain through
+// it. Only pull requests whose title changes are returned, mapped to their new
+// title.
+func NumberedTitles(pullRequests []PullRequest) map[int]string {
+	byNumber := map[int]PullRequest{}
+	for _, pr := range pullRequests {
+		byNumber[pr.Number] = pr
+	}
+
+	parents := map[int]int{}
+	children := map[int][]int{}
+	for _, pr := range pullRequests {
+		if dependOns := DependOnsOf(pr); len(dependOns) == 1 {
+			if _, ok := byNumber[dependOns[0]]; ok && dependOns[0] != pr.Number {
+				parents[pr.Number] = dependOns[0]
+				children[dependOns[0]] = append(children[dependOns[0]], pr.Number)
+			}
+		}
+	}
+
+	// Pull requests in a dependency cycle have no position.
+	inCycle := map[int]bool{}
+	graph := map[int][]int{}
+	for child, parent := range parents {
+		graph[child] = []int{parent}
+	}
+	for _, cycle := range findCycles(graph) {
+		for _, number := range cycle {
+			inCycle[number] = true
+		}
+	}
+
+	var depth func(number int) int
+	depth = func(number int) int {
+		if parent, ok := parents[number]; ok && !inCycle[parent] {
+			return depth(parent) + 1
+		}
+		return 0
+	}
+	var height func(number int) int
+	height = func(number int) int {
+		highest := 0
+		for _, child := range children[number] {
+			if inCycle[child] {
+				continue
+			}
+			if h := height(child) + 1; h > highest {
+				highest = h
+			}
+		}
+		return highest
+	}
+
+	titles := map[int]string{}
+	for _, pr := range pullRequests {
+		title := chainPositionRegexp.ReplaceAllString(pr.Title, "")
+		if !inCycle[pr.Number] {
+			if d, h := depth(pr.Number), height(pr.Number); d+h > 0 {
+				title = fmt.Sprintf("[%d/%d] %s", d+1, d+h+1, title)
+			}
+		}
+		if title != pr.Title {
+			titles[pr.Number] = title
+		}
+	}
+
+	return titles
+}
@@ -0,0 +1,34 @@
+#!/usr/bin/env bash
+# Builds the release binaries for cli/gh-extension-precompile, which expects
+# them in dist/ as <os>-<arch>[.exe]. The command lives in cmd/gh-cascade, so
+# the action's default build of the repository root would find nothing. The
+# action passes the tag being released, which gh cascade version reports.
+set -e
+
+ldflags="-s -w -X main.version=${1:-} -X main.commit=$(git rev-parse HEAD) -X main.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+
+platforms=(
+  darwin-amd64
+  darwin-arm64
+  freebsd-386
+  freebsd-amd64
+  freebsd-arm64
+  linux-386
+  linux-amd64
+  linux-arm
+  linux-arm64
+  windows-386
+  windows-amd64
+  windows-arm64
+)
+
+mkdir -p dist
+for platform in "${platforms[@]}"; do
+  goos="${platform%-*}"
+  goarch="${platform#*-}"
+  ext=""
+  if [ "$goos" = "windows" ]; then
+    ext=".exe"
+  fi
+  GOOS="$goos" GOARCH="$goarch" CGO_ENABLED=0 go build -trimpath -ldflags="$ldflags" -o "dist/${platform}${ext}" ./cmd/gh-cascade
+done